@@ -5,6 +5,7 @@ require (
 	github.com/britannic/mflag v0.0.0-20180122040631-112278387586
 	github.com/smartystreets/goconvey v0.0.0-20190330032615-68dc04aab96a
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	golang.org/x/sys v0.0.0-20190922100055-0a153f010e69 // indirect
 )
@@ -0,0 +1,182 @@
+// Package cidr parses IP addresses and prefixes and aggregates them into the fewest covering CIDR blocks
+package cidr
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+)
+
+// prefix is an IPv4 or IPv6 network as an integer address and prefix length
+type prefix struct {
+	addr *big.Int
+	bits int // prefix length
+	size int // address length, 32 or 128
+}
+
+// Parse returns the network for an IP address or CIDR block, e.g. 192.0.2.1, 198.51.100.0/24 or 2001:db8::/32;
+// host bits are masked off and single addresses become /32 or /128 networks
+func Parse(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+
+	ip := net.ParseIP(s)
+	switch {
+	case ip == nil:
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	case ip.To4() != nil:
+		return &net.IPNet{IP: ip.To4(), Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// Aggregate returns nets sorted, IPv4 first, with contained networks dropped and adjacent
+// networks merged into their common supernet
+func Aggregate(nets []*net.IPNet) []*net.IPNet {
+	ps := make([]prefix, 0, len(nets))
+	for _, n := range nets {
+		if n != nil {
+			ps = append(ps, fromNet(n))
+		}
+	}
+	return toNets(aggregate(ps))
+}
+
+// Exclude returns the aggregate of nets less every address in exc, splitting networks that
+// partly overlap an exclusion into the largest blocks that don't
+func Exclude(nets, exc []*net.IPNet) []*net.IPNet {
+	var (
+		ex  = make([]prefix, 0, len(exc))
+		out []prefix
+	)
+	for _, e := range exc {
+		if e != nil {
+			ex = append(ex, fromNet(e))
+		}
+	}
+	for _, n := range nets {
+		if n != nil {
+			out = append(out, subtract(fromNet(n), ex)...)
+		}
+	}
+	return toNets(aggregate(out))
+}
+
+// Count returns the number of addresses nets cover, which may exceed an int for IPv6
+func Count(nets []*net.IPNet) *big.Int {
+	t := new(big.Int)
+	for _, n := range nets {
+		p := fromNet(n)
+		t.Add(t, new(big.Int).Lsh(big.NewInt(1), uint(p.size-p.bits)))
+	}
+	return t
+}
+
+func aggregate(ps []prefix) []prefix {
+	sort.Slice(ps, func(i, j int) bool {
+		if ps[i].size != ps[j].size {
+			return ps[i].size < ps[j].size
+		}
+		if c := ps[i].addr.Cmp(ps[j].addr); c != 0 {
+			return c < 0
+		}
+		return ps[i].bits < ps[j].bits
+	})
+
+	var out []prefix
+	for _, p := range ps {
+		// sorted prefixes either nest or are disjoint, so only the last kept one can contain p
+		if len(out) > 0 && out[len(out)-1].contains(p) {
+			continue
+		}
+		out = append(out, p)
+		for len(out) > 1 {
+			parent, ok := out[len(out)-2].merge(out[len(out)-1])
+			if !ok {
+				break
+			}
+			out = append(out[:len(out)-2], parent)
+		}
+	}
+	return out
+}
+
+// subtract returns p less the exclusions in ex
+func subtract(p prefix, ex []prefix) []prefix {
+	for _, e := range ex {
+		switch {
+		case e.contains(p):
+			return nil
+		case p.contains(e):
+			lo, hi := p.halves()
+			return append(subtract(lo, ex), subtract(hi, ex)...)
+		}
+	}
+	return []prefix{p}
+}
+
+func fromNet(n *net.IPNet) prefix {
+	ip, size := n.IP.To4(), 32
+	if ip == nil {
+		ip, size = n.IP.To16(), 128
+	}
+	bits, total := n.Mask.Size()
+	if size == 32 && total == 128 {
+		bits -= 96 // IPv4-mapped mask
+	}
+	if bits < 0 {
+		bits = 0
+	}
+	return prefix{addr: new(big.Int).SetBytes(ip.Mask(net.CIDRMask(bits, size))), bits: bits, size: size}
+}
+
+func toNets(ps []prefix) []*net.IPNet {
+	nets := make([]*net.IPNet, len(ps))
+	for i, p := range ps {
+		nets[i] = p.net()
+	}
+	return nets
+}
+
+func (p prefix) net() *net.IPNet {
+	b := p.addr.Bytes()
+	ip := make(net.IP, p.size/8)
+	copy(ip[len(ip)-len(b):], b)
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(p.bits, p.size)}
+}
+
+// contains returns true if q is p or one of its subnets
+func (p prefix) contains(q prefix) bool {
+	if p.size != q.size || p.bits > q.bits {
+		return false
+	}
+	shift := uint(p.size - p.bits)
+	return new(big.Int).Rsh(p.addr, shift).Cmp(new(big.Int).Rsh(q.addr, shift)) == 0
+}
+
+// halves splits p into its two subnets
+func (p prefix) halves() (prefix, prefix) {
+	hi := new(big.Int).Lsh(big.NewInt(1), uint(p.size-p.bits-1))
+	return prefix{addr: p.addr, bits: p.bits + 1, size: p.size},
+		prefix{addr: hi.Add(hi, p.addr), bits: p.bits + 1, size: p.size}
+}
+
+// merge returns the supernet of p and q if they are its two halves
+func (p prefix) merge(q prefix) (prefix, bool) {
+	if p.size != q.size || p.bits != q.bits || p.bits == 0 || p.addr.Bit(p.size-p.bits) != 0 {
+		return prefix{}, false
+	}
+	next := new(big.Int).Lsh(big.NewInt(1), uint(p.size-p.bits))
+	if next.Add(next, p.addr).Cmp(q.addr) != 0 {
+		return prefix{}, false
+	}
+	return prefix{addr: p.addr, bits: p.bits - 1, size: p.size}, true
+}
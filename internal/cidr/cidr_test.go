@@ -0,0 +1,110 @@
+package cidr
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func nets(s ...string) (n []*net.IPNet) {
+	for _, c := range s {
+		p, err := Parse(c)
+		if err != nil {
+			panic(err)
+		}
+		n = append(n, p)
+	}
+	return n
+}
+
+func strs(n []*net.IPNet) (s []string) {
+	for _, c := range n {
+		s = append(s, c.String())
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	Convey("Testing Parse()", t, func() {
+		tests := []struct {
+			in  string
+			exp string
+			err bool
+		}{
+			{in: "192.0.2.1", exp: "192.0.2.1/32"},
+			{in: " 198.51.100.7/24 ", exp: "198.51.100.0/24"},
+			{in: "2001:db8::1", exp: "2001:db8::1/128"},
+			{in: "2001:db8::/32", exp: "2001:db8::/32"},
+			{in: "::ffff:192.0.2.1", exp: "192.0.2.1/32"},
+			{in: "192.0.2.0/33", err: true},
+			{in: "ads.com", err: true},
+			{in: "", err: true},
+		}
+
+		for _, tt := range tests {
+			n, err := Parse(tt.in)
+			if tt.err {
+				So(err, ShouldNotBeNil)
+				continue
+			}
+			So(err, ShouldBeNil)
+			So(n.String(), ShouldEqual, tt.exp)
+		}
+	})
+}
+
+func TestAggregate(t *testing.T) {
+	Convey("Testing Aggregate()", t, func() {
+		tests := []struct {
+			name string
+			in   []string
+			exp  []string
+		}{
+			{
+				name: "merges adjacent halves repeatedly",
+				in:   []string{"10.0.0.3", "10.0.0.0", "10.0.0.1", "10.0.0.2"},
+				exp:  []string{"10.0.0.0/30"},
+			},
+			{
+				name: "drops contained networks and duplicates",
+				in:   []string{"10.1.2.3", "10.1.0.0/16", "10.1.0.0/16", "10.1.255.0/24"},
+				exp:  []string{"10.1.0.0/16"},
+			},
+			{
+				name: "keeps adjacent networks that aren't siblings",
+				in:   []string{"10.0.0.1", "10.0.0.2"},
+				exp:  []string{"10.0.0.1/32", "10.0.0.2/32"},
+			},
+			{
+				name: "sorts IPv4 before IPv6 and never mixes families",
+				in:   []string{"2001:db8:0:1::/64", "2001:db8::/64", "0.0.0.0/1", "128.0.0.0/1"},
+				exp:  []string{"0.0.0.0/0", "2001:db8::/63"},
+			},
+		}
+
+		for _, tt := range tests {
+			Convey(tt.name, func() {
+				So(strs(Aggregate(nets(tt.in...))), ShouldResemble, tt.exp)
+			})
+		}
+
+		So(Aggregate(nil), ShouldBeEmpty)
+	})
+}
+
+func TestExclude(t *testing.T) {
+	Convey("Testing Exclude()", t, func() {
+		So(strs(Exclude(nets("10.0.0.0/30"), nets("10.0.0.1"))), ShouldResemble, []string{"10.0.0.0/32", "10.0.0.2/31"})
+		So(strs(Exclude(nets("10.0.0.0/24", "192.0.2.0/24"), nets("10.0.0.0/8"))), ShouldResemble, []string{"192.0.2.0/24"})
+		So(strs(Exclude(nets("2001:db8::/126"), nets("192.0.2.0/24"))), ShouldResemble, []string{"2001:db8::/126"})
+		So(Count(Exclude(nets("10.0.0.0/16"), nets("10.0.42.7"))).Int64(), ShouldEqual, 65535)
+	})
+}
+
+func TestCount(t *testing.T) {
+	Convey("Testing Count()", t, func() {
+		So(Count(nets("10.0.0.0/24", "192.0.2.1")).Int64(), ShouldEqual, 257)
+		So(Count(nets("2001:db8::/64")).String(), ShouldEqual, "18446744073709551616")
+	})
+}
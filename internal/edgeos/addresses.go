@@ -0,0 +1,286 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/britannic/blacklist/internal/cidr"
+)
+
+// addresses node leaves and values
+const (
+	setFile    = "set-file"
+	setFormat  = "set-format"
+	setName    = "set-name"
+	ipsetOut   = "ipset"
+	nftOut     = "nftables"
+	nftTable   = "blacklist"
+	ipsetLoad  = "/sbin/ipset -exist restore < %s"
+	ipsetClean = "/sbin/ipset -quiet destroy %[1]s-tmp; /sbin/ipset -quiet destroy %[1]s6-tmp; "
+	nftLoad    = "/usr/sbin/nft -f %s"
+	ipsetMax   = 1 << 20 // the addresses node's sets' maxelem, fixed so restore can reuse the live sets
+)
+
+// ipSets is the addresses node's firewall set configuration
+type ipSets struct {
+	file   string
+	format string
+	name   string
+}
+
+// setLabel sets an addresses or policy node set leaf, warning about unknown set-format values
+func (c *Config) setLabel(node, leaf, val string) {
+	x := &c.sets
+	if node == policy {
+		x = &c.route
+	}
+	if *x == nil {
+		*x = &ipSets{format: ipsetOut, name: rootNode}
+	}
+	switch leaf {
+	case setFile:
+		(*x).file = val
+	case setFormat:
+		if val != ipsetOut && val != nftOut {
+			if c.Log != nil {
+				c.Log.Warningf("Unknown %s %q, using %s", setFormat, val, ipsetOut)
+			}
+			return
+		}
+		(*x).format = val
+	case setName:
+		(*x).name = val
+	}
+}
+
+// ipSetConf returns node's configured firewall sets, with defaults for unset leaves
+func (c *Config) ipSetConf(node string) ipSets {
+	var (
+		file = rootNode
+		x    = ipSets{format: ipsetOut, name: rootNode}
+	)
+	switch {
+	case node == policy && c.route != nil:
+		x = *c.route
+	case node == addresses && c.sets != nil:
+		x = *c.sets
+	}
+	if node == policy {
+		file = policy
+	}
+	if x.file == "" {
+		x.file = "/config/user-data/" + file + "." + x.format
+	}
+	return x
+}
+
+// ipExtract returns the addresses and networks in r, one per line after the source's prefix; anything after
+// the first field, such as a Spamhaus "; SBL123" reference, is ignored and lines that don't parse are counted
+func ipExtract(r io.Reader, prefix string) (nets []*net.IPNet, extracted, rejected int) {
+	b := bufio.NewScanner(r)
+	for b.Scan() {
+		line := strings.TrimSpace(b.Text())
+		switch {
+		case line == "", strings.HasPrefix(line, "#"), strings.HasPrefix(line, ";"), strings.HasPrefix(line, "//"):
+			continue
+		case !strings.HasPrefix(line, prefix):
+			continue
+		}
+
+		f := strings.FieldsFunc(strings.TrimPrefix(line, prefix), func(r rune) bool {
+			return unicode.IsSpace(r) || r == ';' || r == '#' || r == ','
+		})
+		if len(f) == 0 {
+			continue
+		}
+
+		extracted++
+		n, err := cidr.Parse(f[0])
+		if err != nil {
+			rejected++
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets, extracted, rejected
+}
+
+// parseNets returns the networks in a node's include or exclude list, warning about invalid entries
+func (c *Config) parseNets(list []string) (nets []*net.IPNet) {
+	for _, s := range list {
+		n, err := cidr.Parse(s)
+		if err != nil {
+			c.Log.Warningf("Ignoring invalid %s entry %q", addresses, s)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// Addresses downloads or reads the addresses node's IP lists, aggregates their networks less
+// the node's excludes, and writes them to set-file as an ipset restore or nft script that
+// atomically replaces the contents of set-name's IPv4 and IPv6 sets
+func (c *Config) Addresses() error {
+	if !c.nodeExists(addresses) || c.tree[addresses].disabled {
+		return nil
+	}
+
+	var (
+		mu   sync.Mutex
+		nets = c.parseNets(c.tree[addresses].inc)
+		wg   sync.WaitGroup
+	)
+
+	for _, s := range c.validate(addresses).src {
+		wg.Add(1)
+		go func(s *source) {
+			defer wg.Done()
+			s.Env = c.Env
+			switch s.ltype {
+			case urls:
+				s = download(s)
+			case files:
+				s.r, s.err = GetFile(s.file)
+			}
+			if s.err != nil {
+				c.Log.Warningf("Skipping %s source %s: %v", addresses, s.name, s.err)
+				return
+			}
+			n, extracted, rejected := ipExtract(s.r, s.prefix)
+			if f, ok := s.r.(io.Closer); ok {
+				f.Close()
+			}
+			c.Log.Infof("%s source %s: %d extracted, %d rejected", addresses, s.name, extracted, rejected)
+
+			mu.Lock()
+			nets = append(nets, n...)
+			mu.Unlock()
+		}(s)
+	}
+	wg.Wait()
+
+	var (
+		agg    = cidr.Exclude(nets, c.parseNets(c.tree[addresses].exc))
+		sets   = c.ipSetConf(addresses)
+		v4, v6 []*net.IPNet
+	)
+
+	for _, n := range agg {
+		if n.IP.To4() != nil {
+			v4 = append(v4, n)
+			continue
+		}
+		v6 = append(v6, n)
+	}
+
+	if sets.format != nftOut && (len(v4) > ipsetMax || len(v6) > ipsetMax) {
+		return fmt.Errorf("%s: %d IPv4 and %d IPv6 networks exceed the ipset maxelem of %d",
+			addresses, len(v4), len(v6), ipsetMax)
+	}
+
+	f, err := os.Create(sets.file)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	switch sets.format {
+	case nftOut:
+		writeNft(w, sets.name, v4, v6)
+	default:
+		writeIPset(w, sets.name, v4, v6)
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	c.Log.Noticef("Wrote %d IPv4 and %d IPv6 networks (%s addresses) from %d entries to %s",
+		len(v4), len(v6), cidr.Count(agg), len(nets), sets.file)
+	return nil
+}
+
+// LoadSets loads the addresses and policy nodes' set-files into the firewall; the addresses node's
+// temporary ipsets are destroyed first, in case an interrupted load left them behind
+func (c *Config) LoadSets() (out []byte, err error) {
+	for _, n := range []string{addresses, policy} {
+		if !c.nodeExists(n) || c.tree[n].disabled {
+			continue
+		}
+		var (
+			sets = c.ipSetConf(n)
+			cmd  = fmt.Sprintf(ipsetLoad, sets.file)
+		)
+		switch {
+		case sets.format == nftOut:
+			cmd = fmt.Sprintf(nftLoad, sets.file)
+		case n == addresses:
+			cmd = fmt.Sprintf(ipsetClean, sets.name) + cmd
+		}
+		b, err := run(c, cmd)
+		out = append(out, b...)
+		if err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// writeIPset writes an ipset restore script that fills temporary hash:net sets and swaps them
+// with name (IPv4) and name6 (IPv6), so the live sets are never empty or partly loaded; every
+// set is created with the same maxelem, as -exist only ignores a create that matches the set
+func writeIPset(w io.Writer, name string, v4, v6 []*net.IPNet) {
+	for _, x := range []struct {
+		family, set string
+		nets        []*net.IPNet
+	}{
+		{family: "inet", set: name, nets: v4},
+		{family: "inet6", set: name + "6", nets: v6},
+	} {
+		tmp := x.set + "-tmp"
+		fmt.Fprintf(w, "create %s hash:net family %s maxelem %d\n", tmp, x.family, ipsetMax)
+		fmt.Fprintf(w, "flush %s\n", tmp)
+		for _, n := range x.nets {
+			fmt.Fprintf(w, "add %s %s\n", tmp, n)
+		}
+		fmt.Fprintf(w, "create %s hash:net family %s maxelem %d\n", x.set, x.family, ipsetMax)
+		fmt.Fprintf(w, "swap %s %s\n", tmp, x.set)
+		fmt.Fprintf(w, "destroy %s\n", tmp)
+	}
+}
+
+// writeNft writes an nft script that declares interval sets name (IPv4) and name6 (IPv6) in the inet
+// blacklist table and replaces their elements; nft -f applies the whole file as one transaction
+func writeNft(w io.Writer, name string, v4, v6 []*net.IPNet) {
+	fmt.Fprintf(w, "table inet %s {\n", nftTable)
+	fmt.Fprintf(w, "\tset %s {\n\t\ttype ipv4_addr\n\t\tflags interval\n\t}\n", name)
+	fmt.Fprintf(w, "\tset %s6 {\n\t\ttype ipv6_addr\n\t\tflags interval\n\t}\n", name)
+	fmt.Fprintln(w, "}")
+
+	for _, x := range []struct {
+		set  string
+		nets []*net.IPNet
+	}{
+		{set: name, nets: v4},
+		{set: name + "6", nets: v6},
+	} {
+		fmt.Fprintf(w, "flush set inet %s %s\n", nftTable, x.set)
+		if len(x.nets) == 0 {
+			continue
+		}
+		e := make([]string, len(x.nets))
+		for i, n := range x.nets {
+			e[i] = n.String()
+		}
+		fmt.Fprintf(w, "add element inet %s %s {\n\t%s\n}\n", nftTable, x.set, strings.Join(e, ",\n\t"))
+	}
+}
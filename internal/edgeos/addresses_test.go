@@ -0,0 +1,214 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func netStrings(nets []*net.IPNet) (s []string) {
+	for _, n := range nets {
+		s = append(s, n.String())
+	}
+	return s
+}
+
+func TestIPExtract(t *testing.T) {
+	Convey("Testing ipExtract()", t, func() {
+		in := `; Spamhaus DROP List
+# comment
+// comment
+
+192.0.2.0/24 ; SBL123
+198.51.100.7
+2001:db8::/32,foo
+ads.com
+10.0.0.0/33
+`
+		nets, extracted, rejected := ipExtract(strings.NewReader(in), "")
+		So(netStrings(nets), ShouldResemble, []string{"192.0.2.0/24", "198.51.100.7/32", "2001:db8::/32"})
+		So(extracted, ShouldEqual, 5)
+		So(rejected, ShouldEqual, 2)
+
+		nets, extracted, rejected = ipExtract(strings.NewReader("deny 192.0.2.1\nallow 192.0.2.2\n"), "deny ")
+		So(netStrings(nets), ShouldResemble, []string{"192.0.2.1/32"})
+		So(extracted, ShouldEqual, 1)
+		So(rejected, ShouldEqual, 0)
+	})
+}
+
+func TestSetLabel(t *testing.T) {
+	Convey("Testing setLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		So(c.ipSetConf(addresses), ShouldResemble, ipSets{file: "/config/user-data/blacklist.ipset", format: ipsetOut, name: rootNode})
+
+		c.setLabel(addresses, setFormat, "iptables")
+		c.setLabel(addresses, setName, "threats")
+		So(c.ipSetConf(addresses), ShouldResemble, ipSets{file: "/config/user-data/blacklist.ipset", format: ipsetOut, name: "threats"})
+
+		c.setLabel(addresses, setFormat, nftOut)
+		c.setLabel(addresses, setFile, "/tmp/threats.nft")
+		So(c.ipSetConf(addresses), ShouldResemble, ipSets{file: "/tmp/threats.nft", format: nftOut, name: "threats"})
+	})
+}
+
+func TestAddresses(t *testing.T) {
+	Convey("Testing Addresses()", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		feed := dir + "/drop.txt"
+		So(ioutil.WriteFile(feed, []byte("192.0.2.0/25 ; SBL1\n192.0.2.128/25 ; SBL2\n10.1.0.0/16\n2001:db8::/48\nbogus\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(Dir(dir), Logger(newLog()), Method("GET"))
+		So(c.Addresses(), ShouldBeNil)
+		b, err := c.LoadSets()
+		So(b, ShouldBeNil)
+		So(err, ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(addressesCfg, dir, feed)}), ShouldBeNil)
+		for _, f := range c.GetAll().Files().Strings() {
+			So(f, ShouldNotContainSubstring, addresses)
+		}
+		So(c.Addresses(), ShouldBeNil)
+
+		act, err := ioutil.ReadFile(dir + "/blacklist.ipset")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, `create threats-tmp hash:net family inet maxelem 1048576
+flush threats-tmp
+add threats-tmp 10.1.0.0/17
+add threats-tmp 10.1.128.0/18
+add threats-tmp 10.1.192.0/19
+add threats-tmp 10.1.224.0/20
+add threats-tmp 10.1.240.0/21
+add threats-tmp 10.1.248.0/22
+add threats-tmp 10.1.252.0/23
+add threats-tmp 10.1.254.0/24
+add threats-tmp 10.1.255.0/25
+add threats-tmp 10.1.255.128/26
+add threats-tmp 10.1.255.192/27
+add threats-tmp 10.1.255.224/28
+add threats-tmp 10.1.255.240/29
+add threats-tmp 10.1.255.248/30
+add threats-tmp 10.1.255.252/31
+add threats-tmp 10.1.255.254/32
+add threats-tmp 192.0.2.0/24
+add threats-tmp 203.0.113.0/24
+create threats hash:net family inet maxelem 1048576
+swap threats-tmp threats
+destroy threats-tmp
+create threats6-tmp hash:net family inet6 maxelem 1048576
+flush threats6-tmp
+add threats6-tmp 2001:db8::/48
+create threats6 hash:net family inet6 maxelem 1048576
+swap threats6-tmp threats6
+destroy threats6-tmp
+`)
+
+		Convey("Testing nftables output", func() {
+			c.setLabel(addresses, setFormat, nftOut)
+			c.setLabel(addresses, setFile, dir+"/blacklist.nft")
+			So(c.Addresses(), ShouldBeNil)
+
+			act, err := ioutil.ReadFile(dir + "/blacklist.nft")
+			So(err, ShouldBeNil)
+			So(string(act), ShouldStartWith, `table inet blacklist {
+	set threats {
+		type ipv4_addr
+		flags interval
+	}
+	set threats6 {
+		type ipv6_addr
+		flags interval
+	}
+}
+flush set inet blacklist threats
+add element inet blacklist threats {
+	10.1.0.0/17,
+`)
+			So(string(act), ShouldEndWith, `	192.0.2.0/24,
+	203.0.113.0/24
+}
+flush set inet blacklist threats6
+add element inet blacklist threats6 {
+	2001:db8::/48
+}
+`)
+		})
+
+		Convey("Testing LoadSets() destroys stale temporary sets first", func() {
+			c.SetOpt(Bash("/bin/cat"))
+			b, err := c.LoadSets()
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "/sbin/ipset -quiet destroy threats-tmp; /sbin/ipset -quiet destroy threats6-tmp; "+
+				"/sbin/ipset -exist restore < "+dir+"/blacklist.ipset")
+		})
+
+		Convey("Testing a missing source", func() {
+			So(os.Remove(feed), ShouldBeNil)
+			So(c.Addresses(), ShouldBeNil)
+			act, err := ioutil.ReadFile(dir + "/blacklist.ipset")
+			So(err, ShouldBeNil)
+			So(string(act), ShouldContainSubstring, "add threats-tmp 203.0.113.0/24\ncreate threats ")
+		})
+	})
+}
+
+func TestWriteIPset(t *testing.T) {
+	Convey("Testing writeIPset() creates a set with the same parameters whatever its size", t, func() {
+		creates := func(nets ...string) []string {
+			var (
+				b  strings.Builder
+				v4 []*net.IPNet
+			)
+			for _, s := range nets {
+				_, n, err := net.ParseCIDR(s)
+				So(err, ShouldBeNil)
+				v4 = append(v4, n)
+			}
+			writeIPset(&b, "threats", v4, nil)
+
+			var act []string
+			for _, l := range strings.Split(b.String(), "\n") {
+				if strings.HasPrefix(l, "create ") {
+					act = append(act, l)
+				}
+			}
+			return act
+		}
+
+		exp := []string{
+			"create threats-tmp hash:net family inet maxelem 1048576",
+			"create threats hash:net family inet maxelem 1048576",
+			"create threats6-tmp hash:net family inet6 maxelem 1048576",
+			"create threats6 hash:net family inet6 maxelem 1048576",
+		}
+		So(creates("192.0.2.0/24"), ShouldResemble, exp)
+		So(creates("192.0.2.0/24", "198.51.100.0/24", "203.0.113.0/24"), ShouldResemble, exp)
+	})
+}
+
+var addressesCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	addresses {
+		exclude 10.1.255.255
+		include 203.0.113.0/24
+		include not-an-ip
+		set-file %s/blacklist.ipset
+		set-name threats
+		source drop {
+			description "Spamhaus DROP"
+			file %s
+		}
+	}
+	domains {
+		include ads.com
+	}
+}`
@@ -0,0 +1,141 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+const (
+	backend    = "dns-backend"
+	dnsmasqOut = "dnsmasq"
+	unboundOut = "unbound"
+)
+
+// Backend is an interface for writing blacklist data in a DNS resolver's native format and reloading it
+type Backend interface {
+	entry(s *source, name string) string
+	finish(c *Config) error
+	format(s *source, l *list) io.Reader
+	preamble() string
+	reload(c *Config) ([]byte, error)
+	String() string
+}
+
+// dnsmasqBackend writes dnsmasq address=/server= lines
+type dnsmasqBackend struct{}
+
+// unboundBackend writes Unbound local-zone/local-data clauses
+type unboundBackend struct{}
+
+// backends maps dns-backend values to their Backend
+var backends = map[string]Backend{
+	dnsmasqOut: dnsmasqBackend{},
+	pdnsOut:    pdnsBackend{},
+	unboundOut: unboundBackend{},
+}
+
+// output returns the configured Backend, dnsmasq by default
+func (e *Env) output() Backend {
+	if e.out == nil {
+		return dnsmasqBackend{}
+	}
+	return e.out
+}
+
+// backendLabel sets the blacklist node's dns-backend leaf
+func (c *Config) backendLabel(val string) {
+	b, ok := backends[val]
+	if !ok {
+		if c.Log != nil {
+			c.Log.Warningf("Unknown %s %q, using %s", backend, val, dnsmasqOut)
+		}
+		return
+	}
+	if val == pdnsOut {
+		c.indexOn()
+	}
+	c.out = b
+}
+
+// Finish writes any consolidated or merged output the DNS backend needs once all sources have been processed
+func (c *Config) Finish() error {
+	if err := c.consolidate(); err != nil {
+		return err
+	}
+	return c.output().finish(c)
+}
+
+// run pipes cmd to the shell and returns its combined output
+func run(c *Config, cmd string) ([]byte, error) {
+	// nolint
+	x := exec.Command(c.Bash)
+	x.Stdin = strings.NewReader(cmd)
+	return x.CombinedOutput()
+}
+
+func (dnsmasqBackend) entry(s *source, name string) string {
+	return fmt.Sprintf(getDnsmasqPrefix(s)+"\n", name)
+}
+
+func (dnsmasqBackend) finish(c *Config) error { return nil }
+
+func (dnsmasqBackend) format(s *source, l *list) io.Reader {
+	return formatData(getDnsmasqPrefix(s), l)
+}
+
+func (dnsmasqBackend) preamble() string { return "" }
+
+func (dnsmasqBackend) reload(c *Config) ([]byte, error) {
+	return run(c, c.DNSsvc)
+}
+
+func (dnsmasqBackend) String() string { return dnsmasqOut }
+
+func (unboundBackend) entry(s *source, name string) string { return unboundZone(s, name) }
+
+func (unboundBackend) finish(c *Config) error { return nil }
+
+// format returns Unbound server clauses; blocked names become always_nxdomain or always_refuse zones, or
+// redirect zones answering with the node's dns-redirect-ip or a null address, and excluded names become
+// transparent zones
+func (unboundBackend) format(s *source, l *list) io.Reader {
+	var a sort.StringSlice
+	l.RLock()
+	for k := range l.entry {
+		a = append(a, unboundZone(s, k))
+	}
+	l.RUnlock()
+	a.Sort()
+	return strings.NewReader(unboundBackend{}.preamble() + strings.Join(a, ""))
+}
+
+func (unboundBackend) preamble() string { return "server:\n" }
+
+func (unboundBackend) reload(c *Config) ([]byte, error) {
+	return run(c, c.UnboundSvc)
+}
+
+func (unboundBackend) String() string { return unboundOut }
+
+// unboundZone returns the Unbound local-zone (and local-data) lines for name
+func unboundZone(s *source, name string) string {
+	zone := name + "."
+	switch s.nType {
+	case excDomn, excHost, excRoot:
+		return fmt.Sprintf("local-zone: %q transparent\n", zone)
+	}
+	switch action(s.mode, s.ip) {
+	case modeNXDomain:
+		return fmt.Sprintf("local-zone: %q always_nxdomain\n", zone)
+	case modeRefused:
+		return fmt.Sprintf("local-zone: %q always_refuse\n", zone)
+	}
+	z := fmt.Sprintf("local-zone: %q redirect\n", zone)
+	for _, rr := range answers(s.mode, s.ip, s.ip6) {
+		z += fmt.Sprintf("local-data: \"%s %s\"\n", zone, rr)
+	}
+	return z
+}
@@ -0,0 +1,84 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUnboundZone(t *testing.T) {
+	Convey("Testing unboundZone()", t, func() {
+		tests := []struct {
+			exp   string
+			ip    string
+			nType ntype
+		}{
+			{nType: domn, ip: "0.0.0.0", exp: "local-zone: \"ads.com.\" redirect\nlocal-data: \"ads.com. A 0.0.0.0\"\nlocal-data: \"ads.com. AAAA ::\"\n"},
+			{nType: host, ip: "", exp: "local-zone: \"ads.com.\" always_nxdomain\n"},
+			{nType: preDomn, ip: "192.168.1.1", exp: "local-zone: \"ads.com.\" redirect\nlocal-data: \"ads.com. A 192.168.1.1\"\n"},
+			{nType: root, ip: "fd00::1", exp: "local-zone: \"ads.com.\" redirect\nlocal-data: \"ads.com. AAAA fd00::1\"\n"},
+			{nType: excDomn, ip: "0.0.0.0", exp: "local-zone: \"ads.com.\" transparent\n"},
+		}
+
+		for _, tt := range tests {
+			So(unboundZone(&source{ip: tt.ip, nType: tt.nType}, "ads.com"), ShouldEqual, tt.exp)
+		}
+	})
+}
+
+func TestBackend(t *testing.T) {
+	Convey("Testing the unbound backend", t, func() {
+		c, dir := newTestConfig(
+			Bash("/bin/bash"),
+			UnboundSvc("echo unbound reloaded"),
+		)
+		defer os.RemoveAll(dir)
+
+		So(c.output().String(), ShouldEqual, dnsmasqOut)
+		So(c.Blacklist(&CFGstatic{Cfg: unboundCfg}), ShouldBeNil)
+		So(c.output().String(), ShouldEqual, unboundOut)
+
+		for _, iface := range []IFace{ExDmObj, PreDObj, PreHObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		act, err := ioutil.ReadFile(dir + "/domains.whitelisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server:\nlocal-zone: \"good.ads.com.\" transparent\n")
+
+		act, err = ioutil.ReadFile(dir + "/domains.blacklisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server:\nlocal-zone: \"ads.com.\" redirect\nlocal-data: \"ads.com. A 0.0.0.0\"\nlocal-data: \"ads.com. AAAA ::\"\n")
+
+		act, err = ioutil.ReadFile(dir + "/hosts.blacklisted-servers.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server:\nlocal-zone: \"trk.foo.com.\" redirect\nlocal-data: \"trk.foo.com. A 192.168.1.1\"\n")
+
+		out, err := c.ReloadDNS()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "unbound reloaded\n")
+
+		Convey("Testing an unknown dns-backend", func() {
+			c.backendLabel("bind")
+			So(c.output().String(), ShouldEqual, unboundOut)
+		})
+	})
+}
+
+var unboundCfg = `blacklist {
+	disabled false
+	dns-backend unbound
+	dns-redirect-ip 0.0.0.0
+	domains {
+		exclude good.ads.com
+		include ads.com
+	}
+	hosts {
+		dns-redirect-ip 192.168.1.1
+		include trk.foo.com
+	}
+}`
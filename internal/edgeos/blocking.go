@@ -0,0 +1,131 @@
+package edgeos
+
+import (
+	"fmt"
+	"net"
+)
+
+// blocking-mode leaf and values
+const (
+	blockMode    = "blocking-mode"
+	modeNXDomain = "nxdomain"
+	modeNull     = "null"
+	modeRedirect = "redirect"
+	modeRefused  = "refused"
+)
+
+// isMode returns true if m is a valid blocking-mode
+func isMode(m string) bool {
+	switch m {
+	case modeNXDomain, modeNull, modeRedirect, modeRefused:
+		return true
+	}
+	return false
+}
+
+// getMode returns node's blocking-mode, inheriting the global blocking-mode if it isn't set
+func (c tree) getMode(node string) string {
+	if c.keyExists(node) && c[node].mode != "" {
+		return c[node].mode
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].mode
+	}
+	return ""
+}
+
+// action returns how a name blocked with mode and redirect ip is answered; without a blocking-mode,
+// it's how dnsmasq answers an address line: no IP means NXDOMAIN, an unspecified IP such as 0.0.0.0
+// a null address and any other IP a redirect
+func action(mode, ip string) string {
+	if mode != "" {
+		return mode
+	}
+	a := net.ParseIP(ip)
+	switch {
+	case a == nil:
+		return modeNXDomain
+	case a.IsUnspecified():
+		return modeNull
+	}
+	return modeRedirect
+}
+
+// modeLabel sets a node or source's blocking-mode, warning about invalid values
+func (c *Config) modeLabel(val string) string {
+	if isMode(val) {
+		return val
+	}
+	if c.Log != nil {
+		c.Log.Warningf("Ignoring invalid %s %q", blockMode, val)
+	}
+	return ""
+}
+
+// checkModes warns about the blocking-modes the DNS backend or rpz-file can't answer as configured
+func (c *Config) checkModes() {
+	if c.Log == nil {
+		return
+	}
+	for _, w := range c.modeWarnings() {
+		c.Log.Warning(w)
+	}
+}
+
+// modeWarnings returns why a node or source's blocking-mode can't be honored: redirect needs a
+// dns-redirect-ip, and for refused, dnsmasq answers NXDOMAIN instead and an rpz-file drops the query
+func (c *Config) modeWarnings() (w []string) {
+	var (
+		refused  bool
+		redirect = func(name string) {
+			w = append(w, fmt.Sprintf("%s %s %s has no dns-redirect-ip to answer with", name, blockMode, modeRedirect))
+		}
+	)
+	for _, k := range c.sortKeys() {
+		n := c.tree[k]
+		refused = refused || n.mode == modeRefused
+		if n.mode == modeRedirect && c.tree.getIP(k) == "" {
+			redirect(k)
+		}
+		for _, s := range n.src {
+			refused = refused || s.mode == modeRefused
+			// a redirect inherited without an IP has already been warned about
+			if s.mode == modeRedirect && s.ip == "" && c.tree.getIP(k) == "" && c.tree.getMode(k) != modeRedirect {
+				redirect(k + "/" + s.name)
+			}
+		}
+	}
+	if !refused {
+		return w
+	}
+	if c.output().String() == dnsmasqOut {
+		w = append(w, fmt.Sprintf("%s can't answer REFUSED, %s %s answers NXDOMAIN instead", dnsmasqOut, blockMode, modeRefused))
+	}
+	if c.rpz != "" {
+		w = append(w, fmt.Sprintf("%s can't answer REFUSED, %s %s drops the query instead", rpzFile, blockMode, modeRefused))
+	}
+	return w
+}
+
+// answers returns the resource records ("A 0.0.0.0", "AAAA ::" ...) that null and redirect blocks answer with;
+// redirects answer AAAA queries with ip6 when it's set
+func answers(mode, ip, ip6 string) (rr []string) {
+	switch action(mode, ip) {
+	case modeNull:
+		return []string{"A 0.0.0.0", "AAAA ::"}
+	case modeRedirect:
+		a := net.ParseIP(ip)
+		switch {
+		case a == nil:
+			return []string{"A 0.0.0.0", "AAAA ::"}
+		case a.To4() == nil:
+			rr = append(rr, "AAAA "+a.String())
+		default:
+			rr = append(rr, "A "+a.String())
+		}
+		if a6 := net.ParseIP(ip6); a6 != nil && a6.To4() == nil && a.To4() != nil {
+			rr = append(rr, "AAAA "+a6.String())
+		}
+	}
+	return rr
+}
@@ -0,0 +1,122 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAction(t *testing.T) {
+	Convey("Testing action() and answers()", t, func() {
+		tests := []struct {
+			act  string
+			ans  []string
+			ip   string
+			mode string
+		}{
+			{ip: "0.0.0.0", act: modeNull, ans: []string{"A 0.0.0.0", "AAAA ::"}},
+			{ip: "::", act: modeNull, ans: []string{"A 0.0.0.0", "AAAA ::"}},
+			{ip: "", act: modeNXDomain},
+			{ip: "192.168.1.1", act: modeRedirect, ans: []string{"A 192.168.1.1"}},
+			{ip: "fd00::1", act: modeRedirect, ans: []string{"AAAA fd00::1"}},
+			{mode: modeNull, ip: "192.168.1.1", act: modeNull, ans: []string{"A 0.0.0.0", "AAAA ::"}},
+			{mode: modeRefused, ip: "192.168.1.1", act: modeRefused},
+			{mode: modeNXDomain, ip: "192.168.1.1", act: modeNXDomain},
+		}
+
+		for _, tt := range tests {
+			So(action(tt.mode, tt.ip), ShouldEqual, tt.act)
+			So(answers(tt.mode, tt.ip, ""), ShouldResemble, tt.ans)
+		}
+		So(isMode("drop"), ShouldBeFalse)
+	})
+}
+
+func TestBlockingMode(t *testing.T) {
+	Convey("Testing blocking-mode", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/malware.txt", []byte("bad.com\nworse.com\n"), 0644), ShouldBeNil)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(modeCfg, dir)}), ShouldBeNil)
+		So(c.tree.getMode(rootNode), ShouldEqual, modeNXDomain)
+		So(c.tree.getMode(domains), ShouldEqual, modeNXDomain)
+		So(c.tree.getMode(hosts), ShouldEqual, modeRedirect)
+		So(c.tree[domains].src[0].mode, ShouldEqual, modeNull)
+
+		for _, iface := range []IFace{PreDObj, PreHObj, FileObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		tests := []struct {
+			exp  string
+			file string
+		}{
+			{file: "/domains.blacklisted-subdomains.blacklist.conf", exp: "address=/ads.com/\n"},
+			{file: "/hosts.blacklisted-servers.blacklist.conf", exp: "address=/trk.foo.com/192.168.1.1\n"},
+			{file: "/domains.malware.blacklist.conf", exp: "address=/bad.com/0.0.0.0\naddress=/bad.com/::\naddress=/worse.com/0.0.0.0\naddress=/worse.com/::\n"},
+		}
+
+		for _, tt := range tests {
+			act, err := ioutil.ReadFile(dir + tt.file)
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, tt.exp)
+		}
+
+		Convey("Testing modeWarnings()", func() {
+			So(c.modeWarnings(), ShouldBeNil)
+
+			c.tree[hosts].mode = modeRefused
+			So(c.modeWarnings(), ShouldResemble, []string{"dnsmasq can't answer REFUSED, blocking-mode refused answers NXDOMAIN instead"})
+
+			c.out, c.rpz = unboundBackend{}, dir+"/blacklist.rpz"
+			So(c.modeWarnings(), ShouldResemble, []string{"rpz-file can't answer REFUSED, blocking-mode refused drops the query instead"})
+		})
+
+		Convey("Testing modeWarnings() with a redirect and no dns-redirect-ip", func() {
+			c.tree[rootNode].ip, c.tree[hosts].ip = "", ""
+			So(c.modeWarnings(), ShouldResemble, []string{"hosts blocking-mode redirect has no dns-redirect-ip to answer with"})
+
+			c.tree[domains].src[0].ip, c.tree[domains].src[0].mode = "", modeRedirect
+			So(c.modeWarnings(), ShouldResemble, []string{
+				"domains/malware blocking-mode redirect has no dns-redirect-ip to answer with",
+				"hosts blocking-mode redirect has no dns-redirect-ip to answer with",
+			})
+		})
+
+		Convey("Testing unboundZone() with blocking modes", func() {
+			So(unboundZone(&source{mode: modeRefused}, "ads.com"), ShouldEqual, "local-zone: \"ads.com.\" always_refuse\n")
+			So(unboundZone(&source{mode: modeNull, ip: "192.168.1.1"}, "ads.com"), ShouldEqual,
+				"local-zone: \"ads.com.\" redirect\nlocal-data: \"ads.com. A 0.0.0.0\"\nlocal-data: \"ads.com. AAAA ::\"\n")
+		})
+
+		Convey("Testing rpzRules() with blocking modes", func() {
+			So(rpzRules("ads.com", record{nType: host, mode: modeRefused}), ShouldResemble, []string{"ads.com CNAME rpz-drop."})
+			So(rpzRules("ads.com", record{nType: host, mode: modeNull}), ShouldResemble, []string{"ads.com A 0.0.0.0", "ads.com AAAA ::"})
+		})
+	})
+}
+
+var modeCfg = `blacklist {
+	blocking-mode nxdomain
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		include ads.com
+		source malware {
+			blocking-mode null
+			description "Malware domains"
+			file %s/malware.txt
+		}
+	}
+	hosts {
+		blocking-mode redirect
+		dns-redirect-ip 192.168.1.1
+		include trk.foo.com
+	}
+}`
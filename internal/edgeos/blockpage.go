@@ -0,0 +1,315 @@
+package edgeos
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const blockPage = "block-page-index"
+
+// tlsAccessDenied is a fatal TLS access_denied alert record, sent to refuse HTTPS connections
+var tlsAccessDenied = []byte{0x15, 0x03, 0x01, 0x00, 0x02, 0x02, 0x31}
+
+// blockIndex is what the block page server knows about the blacklist, written by BlockIndex at update time
+type blockIndex struct {
+	Blocked map[string]blockedName `json:"blocked"`
+	Level   string                 `json:"level"`
+	Listen  []string               `json:"listen"`
+	Sources map[string]string      `json:"sources"`
+	Updated time.Time              `json:"updated"`
+}
+
+// blockedName records the node and sources that blocked a name
+type blockedName struct {
+	Exact   bool     `json:"exact,omitempty"`
+	Node    string   `json:"node"`
+	Sources []string `json:"sources"`
+}
+
+// blockPageLabel sets the blacklist node's block-page-index leaf
+func (c *Config) blockPageLabel(val string) {
+	c.indexOn()
+	c.page = val
+}
+
+// nodeOf returns the configuration node that entries of type n belong to
+func nodeOf(n ntype) string {
+	switch n {
+	case domn, excDomn, preDomn:
+		return domains
+	case host, excHost, preHost:
+		return hosts
+	}
+	return rootNode
+}
+
+// BlockIndex writes the blocked names, with their nodes, sources and source descriptions, and the
+// redirect IPs the block page server should listen on, to block-page-index as JSON
+func (c *Config) BlockIndex() error {
+	if c.page == "" {
+		return nil
+	}
+
+	var (
+		listen = make(map[string]bool)
+		x      = blockIndex{
+			Blocked: make(map[string]blockedName),
+			Level:   c.Level,
+			Sources: make(map[string]string),
+			Updated: time.Now(),
+		}
+	)
+
+	for _, s := range c.GetAll().src {
+		x.Sources[s.name] = s.desc
+	}
+
+	for _, name := range c.idx.names() {
+		r, _ := c.idx.get(name)
+		allow, exact := exportType(r.nType)
+		if allow {
+			continue
+		}
+		if r.desc != "" {
+			x.Sources[r.src] = r.desc
+		}
+		srcs := append([]string{r.src}, r.also...)
+		sort.Strings(srcs[1:])
+		x.Blocked[name] = blockedName{Exact: exact, Node: nodeOf(r.nType), Sources: srcs}
+
+		if action(r.mode, r.ip) == modeRedirect {
+			for _, ip := range []string{r.ip, r.ip6} {
+				if a := net.ParseIP(ip); a != nil && !a.IsUnspecified() {
+					listen[a.String()] = true
+				}
+			}
+		}
+	}
+
+	for ip := range listen {
+		x.Listen = append(x.Listen, ip)
+	}
+	sort.Strings(x.Listen)
+
+	b, err := json.Marshal(x)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(c.page, b, 0644); err != nil {
+		return err
+	}
+
+	c.Log.Infof("Wrote %d blocked names to block page index %s", len(x.Blocked), c.page)
+	return nil
+}
+
+// BlockPage is an HTTP server that tells users which blacklist node and sources blocked the
+// domain they were redirected from, reloading its index whenever a blacklist update rewrites it
+type BlockPage struct {
+	*sync.RWMutex
+	file  string
+	idx   *blockIndex
+	mod   time.Time
+	ports [2]string // HTTP and HTTPS
+}
+
+// NewBlockPage returns a BlockPage serving the index in file
+func NewBlockPage(file string) (*BlockPage, error) {
+	b := &BlockPage{RWMutex: &sync.RWMutex{}, file: file, ports: [2]string{"80", "443"}}
+	return b, b.load()
+}
+
+// load (re)reads the index if it has changed since it was last read
+func (b *BlockPage) load() error {
+	fi, err := os.Stat(b.file)
+	if err != nil {
+		return err
+	}
+
+	b.RLock()
+	current := b.idx != nil && fi.ModTime().Equal(b.mod)
+	b.RUnlock()
+	if current {
+		return nil
+	}
+
+	d, err := ioutil.ReadFile(b.file)
+	if err != nil {
+		return err
+	}
+
+	x := &blockIndex{}
+	if err = json.Unmarshal(d, x); err != nil {
+		return fmt.Errorf("cannot read block page index %s: %v", b.file, err)
+	}
+
+	b.Lock()
+	b.idx, b.mod = x, fi.ModTime()
+	b.Unlock()
+	return nil
+}
+
+// lookup returns the blocked entry that matches host, either the name itself or a blocked parent domain
+func (b *BlockPage) lookup(host string) (string, blockedName, bool) {
+	b.RLock()
+	defer b.RUnlock()
+	for name := host; name != ""; {
+		if e, ok := b.idx.Blocked[name]; ok && (!e.Exact || name == host) {
+			return name, e, true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return "", blockedName{}, false
+}
+
+// blockPageData fills in the block page template
+type blockPageData struct {
+	Entry   string
+	Exclude string
+	Found   bool
+	Host    string
+	Node    string
+	Sources []blockPageSource
+	Updated string
+}
+
+// blockPageSource is a source and its configured description
+type blockPageSource struct {
+	Desc string
+	Name string
+}
+
+// ServeHTTP answers any Host with a page describing why it was blocked and how to have it whitelisted
+func (b *BlockPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := b.load(); err != nil {
+		b.RLock()
+		stale := b.idx != nil
+		b.RUnlock()
+		if !stale {
+			http.Error(w, "The blacklist index isn't available", http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	var (
+		entry, e, found = b.lookup(host)
+		p               = blockPageData{Entry: entry, Found: found, Host: host, Node: e.Node}
+	)
+
+	b.RLock()
+	p.Updated = b.idx.Updated.Format(time.RFC1123)
+	for _, s := range e.Sources {
+		p.Sources = append(p.Sources, blockPageSource{Desc: b.idx.Sources[s], Name: s})
+	}
+	node := b.idx.Level + " blacklist"
+	b.RUnlock()
+
+	if e.Node != rootNode {
+		node += " " + e.Node
+	}
+	p.Exclude = fmt.Sprintf("set %s exclude %s", node, host)
+
+	status := http.StatusForbidden
+	if !found {
+		status = http.StatusNotFound
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := blockTmpl.Execute(w, p); err != nil {
+		fmt.Fprintf(w, "%v", err)
+	}
+}
+
+// ListenAndServe serves block pages over HTTP on the index's redirect IPs, and refuses HTTPS
+// connections on them with a TLS alert, so browsers fail fast instead of timing out
+func (b *BlockPage) ListenAndServe() error {
+	b.RLock()
+	ips := b.idx.Listen
+	b.RUnlock()
+	if len(ips) == 0 {
+		return fmt.Errorf("block page index %s has no dns-redirect-ip to listen on", b.file)
+	}
+
+	errs := make(chan error, 2*len(ips))
+	for _, ip := range ips {
+		l, err := net.Listen("tcp", net.JoinHostPort(ip, b.ports[1]))
+		if err != nil {
+			return err
+		}
+		go func() { errs <- refuseTLS(l) }()
+
+		srv := &http.Server{
+			Addr:         net.JoinHostPort(ip, b.ports[0]),
+			Handler:      b,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() { errs <- srv.ListenAndServe() }()
+	}
+	return <-errs
+}
+
+// refuseTLS answers every connection accepted by l with a fatal TLS access_denied alert and closes it
+func refuseTLS(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func(c net.Conn) {
+			_ = c.SetDeadline(time.Now().Add(5 * time.Second))
+			_, _ = c.Write(tlsAccessDenied)
+			c.Close()
+		}(conn)
+	}
+}
+
+var blockTmpl = template.Must(template.New("block").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Host}}{{if .Found}} is blocked{{end}}</title>
+<style>body{font-family:sans-serif;max-width:40em;margin:3em auto;color:#333}code{background:#eee;padding:.2em .4em}</style>
+</head>
+<body>
+{{if .Found -}}
+<h1>{{.Host}} is blocked</h1>
+<p>This router's DNS blacklist blocks <strong>{{.Entry}}</strong> in its <strong>{{.Node}}</strong> node.</p>
+<p>Listed by:</p>
+<ul>
+{{range .Sources}}<li><strong>{{.Name}}</strong>{{with .Desc}}: {{.}}{{end}}</li>
+{{end -}}
+</ul>
+<h2>Need this site?</h2>
+<p>Ask your network administrator to whitelist it. On the router, they can run:</p>
+<pre><code>configure
+{{.Exclude}}
+commit; save</code></pre>
+{{- else -}}
+<h1>{{.Host}} isn't in the blacklist</h1>
+<p>It may have been whitelisted since your device looked it up; try again in a few minutes.</p>
+{{- end}}
+<p><small>Blacklist updated {{.Updated}}</small></p>
+</body>
+</html>
+`))
@@ -0,0 +1,122 @@
+package edgeos
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBlockIndex(t *testing.T) {
+	Convey("Testing BlockIndex()", t, func() {
+		c, dir := newTestConfig(Level("service dns forwarding"))
+		defer os.RemoveAll(dir)
+
+		So(c.BlockIndex(), ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: blockPageCfg}), ShouldBeNil)
+		So(c.idx, ShouldNotBeNil)
+		c.page = dir + "/blacklist.index.json"
+
+		for _, iface := range []IFace{PreDObj, PreHObj, ExDmObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+		So(c.BlockIndex(), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(c.page)
+		So(err, ShouldBeNil)
+		x := blockIndex{}
+		So(json.Unmarshal(b, &x), ShouldBeNil)
+		So(x.Level, ShouldEqual, "service dns forwarding")
+		So(x.Listen, ShouldResemble, []string{"192.168.168.1"})
+		So(x.Blocked, ShouldResemble, map[string]blockedName{
+			"ads.com":     {Node: domains, Sources: []string{PreDomns}},
+			"trk.foo.com": {Exact: true, Node: hosts, Sources: []string{PreHosts}},
+		})
+		So(x.Sources[PreDomns], ShouldEqual, getLtypeDesc(PreDomns))
+
+		Convey("Testing BlockPage", func() {
+			p, err := NewBlockPage(c.page)
+			So(err, ShouldBeNil)
+
+			tests := []struct {
+				host   string
+				status int
+				has    []string
+			}{
+				{host: "ads.com", status: http.StatusForbidden, has: []string{
+					"ads.com is blocked", "<strong>domains</strong>", PreDomns,
+					"set service dns forwarding blacklist domains exclude ads.com",
+				}},
+				{host: "WWW.Ads.com.:80", status: http.StatusForbidden, has: []string{
+					"www.ads.com is blocked", "blocks <strong>ads.com</strong>",
+					"set service dns forwarding blacklist domains exclude www.ads.com",
+				}},
+				{host: "trk.foo.com", status: http.StatusForbidden, has: []string{
+					"set service dns forwarding blacklist hosts exclude trk.foo.com",
+				}},
+				{host: "x.trk.foo.com", status: http.StatusNotFound, has: []string{"x.trk.foo.com isn't in the blacklist"}},
+				{host: "<script>", status: http.StatusNotFound, has: []string{"&lt;script&gt;"}},
+			}
+
+			for _, tt := range tests {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Host = tt.host
+				w := httptest.NewRecorder()
+				p.ServeHTTP(w, r)
+				So(w.Code, ShouldEqual, tt.status)
+				for _, s := range tt.has {
+					So(w.Body.String(), ShouldContainSubstring, s)
+				}
+			}
+
+			So(os.Remove(c.page), ShouldBeNil)
+			w := httptest.NewRecorder()
+			p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+			So(w.Code, ShouldEqual, http.StatusNotFound)
+
+			_, err = NewBlockPage(c.page)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestRefuseTLS(t *testing.T) {
+	Convey("Testing refuseTLS()", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		done := make(chan error)
+		go func() { done <- refuseTLS(l) }()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(conn)
+		So(err, ShouldBeNil)
+		So(b, ShouldResemble, tlsAccessDenied)
+		conn.Close()
+
+		l.Close()
+		So(<-done, ShouldNotBeNil)
+	})
+}
+
+var blockPageCfg = `blacklist {
+	block-page-index /tmp/blacklist.index.json
+	disabled false
+	dns-redirect-ip 192.168.168.1
+	domains {
+		exclude good.ads.com
+		include ads.com
+	}
+	hosts {
+		blocking-mode nxdomain
+		include trk.foo.com
+	}
+}`
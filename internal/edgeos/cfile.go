@@ -21,13 +21,31 @@ func (c *CFile) readDir(pattern string) ([]string, error) {
 	return f, err
 }
 
-// Remove deletes a CFile array of file names
+// Remove deletes blacklist files that aren't in the CFile array of file names, in either output-layout
 func (c *CFile) Remove() error {
-	d, err := c.readDir(fmt.Sprintf(c.FnFmt, c.Dir, c.Wildcard.Node, c.Wildcard.Name, c.Ext))
-	if err != nil {
-		return err
+	var d []string
+	for _, pattern := range []string{
+		fmt.Sprintf(c.FnFmt, c.Dir, c.Wildcard.Node, c.Wildcard.Name, c.Ext),
+		fmt.Sprintf(c.FnFmt, c.Dir, all, consolidated, c.Ext), // single output-layout
+		fmt.Sprintf(c.FnFmt, c.Dir, forwarding, c.Wildcard.Name, c.Ext),
+		fmt.Sprintf(c.FnFmt, c.Dir, policy, c.Wildcard.Name, c.Ext),
+	} {
+		f, err := c.readDir(pattern)
+		if err != nil {
+			return err
+		}
+		d = append(d, f...)
+	}
+	keep := make(map[string]bool, len(c.Names))
+	for _, n := range c.Names {
+		keep[n] = true
+	}
+	var f []string
+	for _, n := range d {
+		if !keep[n] {
+			f = append(f, n)
+		}
 	}
-	f := diffArray(c.Names, d)
 	c.Debug(fmt.Sprintf("Removing: %v", f))
 	return purgeFiles(f)
 }
@@ -7,9 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -36,22 +38,21 @@ type ctr struct {
 }
 type stat map[string]*stats
 
-type stats struct {
-	dropped   int32
-	extracted int32
-	kept      int32
-}
-
 const (
+	addresses = "addresses"
 	agent     = `curl/7.26.0`
 	all       = "all"
 	blackhole = "dns-redirect-ip"
+	blackhol6 = "dns-redirect-ipv6"
 	disabled  = "disabled"
 	domains   = "domains"
 	files     = "file"
 	hosts     = "hosts"
 	notknown  = "unknown"
+	policy    = "policy"
 	preNoun   = "pre-configured"
+	promoteAt = "promote-threshold"
+	protect   = "promote-protect"
 	roots     = "roots"
 	rootNode  = "blacklist"
 	src       = "source"
@@ -112,7 +113,9 @@ func (c *Config) addExc(n string) *Objects {
 				desc:  getLtypeDesc(iface.String()),
 				exc:   exc,
 				ip:    c.tree.getIP(n),
+				ip6:   c.tree.getIP6(n),
 				ltype: ltype,
+				mode:  c.tree.getMode(n),
 				nType: getType(ltype).(ntype),
 				name:  ltype,
 			},
@@ -153,7 +156,9 @@ func (c *Config) addInc(n string) *source {
 		inc:   inc,
 		iface: iface,
 		ip:    c.tree.getIP(n),
+		ip6:   c.tree.getIP6(n),
 		ltype: lt,
+		mode:  c.tree.getMode(n),
 		nType: nt,
 		name:  lt,
 	}
@@ -161,14 +166,8 @@ func (c *Config) addInc(n string) *source {
 
 // GetTotalStats displays aggregate statistics for processed sources
 func (c *Config) GetTotalStats() (dropped, extracted, kept int32) {
-	ctr := c.ctr.stat
-	for k := range ctr {
-		if ctr[k].kept+ctr[k].dropped != 0 {
-			dropped += ctr[k].dropped
-			extracted += ctr[k].extracted
-			kept += ctr[k].kept
-		}
-	}
+	t := c.TotalStats()
+	dropped, extracted, kept = int32(t.Dropped), int32(t.Extracted), int32(t.Kept)
 
 	if kept+dropped != 0 {
 		c.Log.Noticef("Total entries found: %d", extracted)
@@ -209,6 +208,9 @@ func (c *Config) Get(nx string) *Objects {
 	switch nx {
 	case all:
 		for _, n := range c.sortKeys() {
+			if n == addresses || n == forwarding || n == policy { // these nodes' sources aren't blacklist sources
+				continue
+			}
 			o.addObj(c, n)
 		}
 	default:
@@ -263,7 +265,7 @@ func (c *Config) Nodes() (n []string) {
 // isTnode returns true if node is a root or top node in the blacklist configuration
 func isTnode(n string) bool {
 	switch n {
-	case rootNode, domains, hosts:
+	case rootNode, domains, hosts, addresses, forwarding, policy:
 		return true
 	}
 	return false
@@ -274,12 +276,12 @@ func (c *Config) excinc(t [][]byte, n string) {
 	case "exclude":
 		if isTnode(n) {
 			c.Debug("Whitelisting %s on node %s", string(t[2]), n)
-			c.tree[n].exc = append(c.tree[n].exc, string(t[2]))
+			c.tree[n].exc = append(c.tree[n].exc, normalize(string(t[2])))
 		}
 	case "include":
 		if isTnode(n) {
 			c.Debug("Blacklisting %s on node %s", string(t[2]), n)
-			c.tree[n].inc = append(c.tree[n].inc, string(t[2]))
+			c.tree[n].inc = append(c.tree[n].inc, normalize(string(t[2])))
 		}
 	}
 }
@@ -290,6 +292,18 @@ func (c *Config) label(name [][]byte, o *source, n string) {
 		o.desc = string(name[2])
 	case blackhole:
 		o.ip = string(name[2])
+	case blackhol6:
+		o.ip6 = c.ipv6(string(name[2]))
+	case blockMode:
+		o.mode = c.modeLabel(string(name[2]))
+	case setName:
+		o.set = string(name[2])
+	case upstream:
+		o.upstream = c.upstreamLabel(string(name[2]))
+	case maxChange, minEntries:
+		c.sourceGuardLabel(o, string(name[1]), string(name[2]))
+	case refreshAt:
+		c.refreshLabel(o, string(name[2]))
 	case files:
 		o.file = string(name[2])
 		o.ltype = string(name[1])
@@ -303,6 +317,80 @@ func (c *Config) label(name [][]byte, o *source, n string) {
 	}
 }
 
+// tnodeLabel sets leaf values that belong to a top node rather than a source
+func (c *Config) tnodeLabel(name [][]byte, n string) {
+	if !isTnode(n) || !c.nodeExists(n) {
+		return
+	}
+	switch string(name[1]) {
+	case blockMode:
+		c.tree[n].mode = c.modeLabel(string(name[2]))
+	case promoteAt:
+		c.tree[n].promote, _ = strconv.Atoi(string(name[2]))
+		if c.tree[n].promote > 0 && c.tally == nil {
+			c.tally = newTally()
+		}
+	case protect:
+		c.tree[n].protect = append(c.tree[n].protect, normalize(string(name[2])))
+	case pslExempt, pslFile:
+		if n == rootNode {
+			c.pslLabel(string(name[1]), string(name[2]))
+		}
+	case idnAction, idnProtect:
+		if n == rootNode {
+			c.idnLabel(string(name[1]), string(name[2]))
+		}
+	case backend:
+		if n == rootNode {
+			c.backendLabel(string(name[2]))
+		}
+	case rpzFile:
+		if n == rootNode {
+			c.rpzLabel(string(name[2]))
+		}
+	case upstream:
+		if n == forwarding {
+			c.tree[n].upstream = c.upstreamLabel(string(name[2]))
+		}
+	case setFile, setFormat, setName:
+		if n == addresses || n == policy {
+			c.setLabel(n, string(name[1]), string(name[2]))
+		}
+	case blockPage:
+		if n == rootNode {
+			c.blockPageLabel(string(name[2]))
+		}
+	case layout:
+		if n == rootNode {
+			c.layoutLabel(string(name[2]))
+		}
+	case metricsFile:
+		if n == rootNode {
+			c.metricsLabel(string(name[2]))
+		}
+	case maxChange, minEntries:
+		if n == rootNode {
+			c.guardLabel(string(name[1]), string(name[2]))
+		}
+	case anomalyAt, histFile, histRuns:
+		if n == rootNode {
+			c.historyLabel(string(name[1]), string(name[2]))
+		}
+	case mqttBroker, mqttClientID, mqttDiscovery, mqttPassword, mqttTopic, mqttUsername:
+		if n == rootNode {
+			c.mqttLabel(string(name[1]), string(name[2]))
+		}
+	case updateAt, updateCron, updateJitter:
+		if n == rootNode {
+			c.scheduleLabel(string(name[1]), string(name[2]))
+		}
+	case healthCheck, notifyChat, notifyCommand, notifyFailures, notifyField, notifyInterval, notifyState, notifyTemplate, notifyWebhook:
+		if n == rootNode {
+			c.notifyLabel(string(name[1]), string(name[2]))
+		}
+	}
+}
+
 // mode returns a contextual VYOS API argument
 func (c *Config) mode() string {
 	if c.InSession() {
@@ -316,6 +404,9 @@ func (c *Config) addTnodeSource(n string) {
 		c.tree[n] = newSource()
 		c.tree[n].name = n
 		c.tree[n].nType = getType(n).(ntype)
+		if n == forwarding { // for blacklist conflict checks
+			c.indexOn()
+		}
 	}
 }
 
@@ -332,6 +423,23 @@ func (c *Config) redirect(line []byte, n string, find *regx.OBJ) {
 	}
 }
 
+func (c *Config) redirect6(line []byte, n string, find *regx.OBJ) {
+	if isTnode(n) {
+		c.tree[n].ip6 = c.ipv6(string(find.SubMatch(regx.IPB6, line)[1]))
+	}
+}
+
+// ipv6 returns s if it's an IPv6 address, otherwise it logs a warning and returns ""
+func (c *Config) ipv6(s string) string {
+	if ip := net.ParseIP(s); ip != nil && ip.To4() == nil {
+		return ip.String()
+	}
+	if c.Log != nil {
+		c.Log.Warningf("Ignoring invalid %s %q", blackhol6, s)
+	}
+	return ""
+}
+
 func (c *Config) sourcename(o *source, line []byte, n string, find *regx.OBJ) {
 	if isTnode(n) {
 		name := find.SubMatch(regx.NAME, line)
@@ -360,13 +468,14 @@ func (c *Config) ProcessContent(cts ...Contenter) error {
 			wg.Add(1)
 
 			go func(s *source) {
-				s.ctr.Lock()
-				s.ctr.stat[typeInt(s.nType)] = &stats{}
-				s.ctr.Unlock()
+				s.ctr.reset(s)
 
-				if err := s.process().writeFile(); err != nil {
+				err := s.process().writeFile()
+				if err != nil {
 					errs = append(errs, err.Error())
 				}
+				s.metrics.done(s, err)
+				s.notes.done(s, err)
 				wg.Done()
 			}(s)
 		}
@@ -415,6 +524,12 @@ func (c *Config) Blacklist(r ConfLoader) error {
 		case find.RX[regx.IPBH].Match(line) && isntSource(nodes): // add blackhole IP
 			c.Debug(fmt.Sprintf("Adding blackhole IP to %s: %s\n", tnode, string(line)))
 			c.redirect(line, tnode, find)
+		case find.RX[regx.IPB6].Match(line) && isntSource(nodes): // add blackhole IPv6
+			c.Debug(fmt.Sprintf("Adding blackhole IPv6 to %s: %s\n", tnode, string(line)))
+			c.redirect6(line, tnode, find)
+		case find.RX[regx.NAME].Match(line) && isntSource(nodes): // add top node leaf
+			c.Debug(fmt.Sprintf("Adding leaf to %s: %s\n", tnode, string(line)))
+			c.tnodeLabel(find.SubMatch(regx.NAME, line), tnode)
 		case find.RX[regx.NAME].Match(line): // add source name
 			c.Debug(fmt.Sprintf("Adding source to %s: %s\n", tnode, string(line)))
 			c.sourcename(o, line, tnode, find)
@@ -430,18 +545,22 @@ func (c *Config) Blacklist(r ConfLoader) error {
 	if len(c.tree) < 1 {
 		return errors.New("no blacklist configuration has been detected")
 	}
+	c.checkGuards()
+	c.checkModes()
 
 	c.Debug(fmt.Sprintf("Using router configuration %v", c.String()))
 
 	return nil
 }
 
-// ReloadDNS reloads the dnsmasq configuration
+// ReloadDNS reloads the configured DNS backend
 func (c *Config) ReloadDNS() ([]byte, error) {
-	// nolint
-	cmd := exec.Command(c.Bash)
-	cmd.Stdin = strings.NewReader(c.DNSsvc)
-	return cmd.CombinedOutput()
+	b, err := c.output().reload(c)
+	c.metrics.reloaded(err)
+	if err != nil {
+		c.notes.notify(eventReload, "", strings.TrimSpace(fmt.Sprintf("%v %s", err, b)), 0)
+	}
+	return b, err
 }
 
 // sortKeys returns a slice of keys in lexicographical sorted order.
@@ -474,6 +593,25 @@ func (c *Config) String() (s string) {
 
 		s += fmt.Sprintf("%v%q: %q,\n", tabs(indent), disabled, booltoStr(c.tree[pkey].disabled))
 		s = is(indent, s, "ip", c.tree[pkey].ip)
+		s = is(indent, s, "ipv6", c.tree[pkey].ip6)
+		s = is(indent, s, blockMode, c.tree[pkey].mode)
+		if c.tree[pkey].promote > 0 {
+			s = is(indent, s, promoteAt, strconv.Itoa(c.tree[pkey].promote))
+			s += getJSONArray(&cfgJSON{array: c.tree[pkey].protect, pk: pkey, leaf: protect, indent: indent})
+		}
+		if pkey == rootNode && len(c.exemptions()) > 0 {
+			s += getJSONArray(&cfgJSON{array: c.exemptions(), pk: pkey, leaf: pslExempt, indent: indent})
+		}
+		if pkey == rootNode && c.out != nil {
+			s = is(indent, s, backend, c.output().String())
+		}
+		if pkey == rootNode && c.rpz != "" {
+			s = is(indent, s, rpzFile, c.rpz)
+		}
+		if pkey == rootNode && c.idnMode() != "" {
+			s = is(indent, s, idnAction, c.idnMode())
+			s += getJSONArray(&cfgJSON{array: c.idnBrands(), pk: pkey, leaf: idnProtect, indent: indent})
+		}
 		s += getJSONArray(&cfgJSON{array: c.tree[pkey].exc, pk: pkey, leaf: "excludes", indent: indent})
 		s += getJSONArray(&cfgJSON{array: c.tree[pkey].inc, pk: pkey, leaf: "includes", indent: indent})
 		s += getJSONsrcArray(&cfgJSON{Config: c, pk: pkey, indent: indent})
@@ -497,12 +635,28 @@ func (c tree) getIP(node string) string {
 	return "0.0.0.0"
 }
 
+func (c tree) getIP6(node string) string {
+	if c.keyExists(node) && c[node].ip6 != "" {
+		return c[node].ip6
+	}
+	if c.keyExists(rootNode) {
+		return c[rootNode].ip6
+	}
+	return ""
+}
+
 func (c tree) validate(node string) *Objects {
 	if c.keyExists(node) {
 		for _, o := range c[node].src {
 			if o.ip == "" {
 				o.ip = c.getIP(node)
 			}
+			if o.ip6 == "" {
+				o.ip6 = c.getIP6(node)
+			}
+			if o.mode == "" {
+				o.mode = c.getMode(node)
+			}
 		}
 		return &c[node].Objects
 	}
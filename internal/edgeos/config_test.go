@@ -1152,3 +1152,48 @@ Blacklist:
               "**No entries found**"
 `
 )
+
+func TestRedirectIPv6(t *testing.T) {
+	Convey("Testing dns-redirect-ipv6", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: ipv6Cfg}), ShouldBeNil)
+		So(c.tree.getIP6(rootNode), ShouldEqual, "fd00::1")
+		So(c.tree.getIP6(domains), ShouldEqual, "fd00::1")
+		So(c.tree.getIP6(hosts), ShouldEqual, "fd00::2")
+		So(c.String(), ShouldContainSubstring, `"ipv6": "fd00::2",`)
+
+		for _, iface := range []IFace{PreDObj, PreHObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		act, err := ioutil.ReadFile(dir + "/domains.blacklisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/ads.com/0.0.0.0\naddress=/ads.com/fd00::1\n")
+
+		act, err = ioutil.ReadFile(dir + "/hosts.blacklisted-servers.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/trk.foo.com/192.168.1.1\naddress=/trk.foo.com/fd00::2\n")
+
+		So(answers(modeRedirect, "192.168.1.1", "fd00::2"), ShouldResemble, []string{"A 192.168.1.1", "AAAA fd00::2"})
+		So(c.ipv6("192.168.1.1"), ShouldEqual, "")
+		So(c.ipv6("FD00:0::1"), ShouldEqual, "fd00::1")
+	})
+}
+
+var ipv6Cfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	dns-redirect-ipv6 fd00::1
+	domains {
+		include ads.com
+	}
+	hosts {
+		dns-redirect-ip 192.168.1.1
+		dns-redirect-ipv6 fd00::2
+		include trk.foo.com
+	}
+}`
@@ -25,19 +25,10 @@ type dummyConfig struct {
 }
 
 func (d *dummyConfig) ProcessContent(cts ...Contenter) error {
-	var (
-		a, b  int32
-		area  string
-		tally = &stats{dropped: a, kept: b}
-	)
-
 	for _, ct := range cts {
 		o := ct.GetList().src
 		for _, src := range o {
-			area = typeInt(src.nType)
-			src.ctr.Lock()
-			src.ctr.stat[area] = tally
-			src.ctr.Unlock()
+			src.ctr.reset(src)
 			b, _ := ioutil.ReadAll(src.process().r)
 			d.s = append(d.s, strings.TrimSuffix(string(b), "\n"))
 		}
@@ -607,8 +598,8 @@ func TestProcessContent(t *testing.T) {
 				{
 					name:      "ExRtObj",
 					dropped:   0,
-					extracted: 1,
-					kept:      1,
+					extracted: 0,
+					kept:      0,
 					err:       nil,
 					exp: `
 Desc:         "pre-configured global whitelisted domains"
@@ -811,8 +802,8 @@ Blacklist:
 				{
 					name:      "FileObj",
 					dropped:   2,
-					extracted: 23,
-					kept:      21,
+					extracted: 22,
+					kept:      20,
 					err:       fmt.Errorf("open %v/hosts./tasty.blacklist.conf: no such file or directory", dir),
 					exp:       filesMin,
 					expDexMap: list{
@@ -949,11 +940,11 @@ func TestProcessZeroContent(t *testing.T) {
 		})
 
 		Convey("Extracted entries should match", func() {
-			So(extracted, ShouldEqual, 2)
+			So(extracted, ShouldEqual, 1)
 		})
 
 		Convey("Kept entries should match", func() {
-			So(kept, ShouldEqual, 1)
+			So(kept, ShouldEqual, 0)
 		})
 	})
 }
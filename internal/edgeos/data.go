@@ -27,6 +27,9 @@ const (
 	preHost              // Pre-configured blacklisted hosts
 	preRoot              // Pre-configured global blacklist domains
 	root                 // Topmost root node
+	addr                 // IP address and CIDR block lists
+	pol                  // Policy routed domains
+	fwd                  // Conditionally forwarded domains
 )
 
 // booltoStr converts a boolean ("true" or "false") to a string equivalent
@@ -76,13 +79,25 @@ func formatData(s string, l *list) io.Reader {
 	return strings.NewReader(strings.Join(a, ""))
 }
 
-// getDnsmasqPrefix returns the dnsmasq conf file delimiter
+// getDnsmasqPrefix returns the dnsmasq conf file delimiter for the source's blocking-mode;
+// dnsmasq can't answer REFUSED, so refused falls back to NXDOMAIN
 func getDnsmasqPrefix(s *source) string {
 	switch s.nType {
-	case domn, preDomn, preRoot, root:
-		return s.Pfx.domain + "/%v/" + s.ip
 	case excDomn, excHost, excRoot:
 		return s.Pfx.host + "/%v/#"
+	case pol:
+		return s.setDirective()
+	case fwd:
+		return s.Pfx.host + "/%v/" + s.upstream
+	}
+	switch s.mode {
+	case modeNXDomain, modeRefused:
+		return s.Pfx.domain + "/%v/"
+	case modeNull:
+		return s.Pfx.domain + "/%[1]v/0.0.0.0\n" + s.Pfx.domain + "/%[1]v/::"
+	}
+	if s.ip6 != "" {
+		return s.Pfx.domain + "/%[1]v/" + s.ip + "\n" + s.Pfx.domain + "/%[1]v/" + s.ip6
 	}
 	return s.Pfx.domain + "/%v/" + s.ip
 }
@@ -133,6 +148,12 @@ func typeInt(n ntype) string {
 		return PreRoots
 	case root:
 		return rootNode
+	case addr:
+		return addresses
+	case pol:
+		return policy
+	case fwd:
+		return forwarding
 	}
 	return notknown
 }
@@ -157,6 +178,12 @@ func typeStr(s string) ntype {
 		return preRoot
 	case rootNode:
 		return root
+	case addresses:
+		return addr
+	case policy:
+		return pol
+	case forwarding:
+		return fwd
 	}
 	return unknown
 }
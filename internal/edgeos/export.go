@@ -0,0 +1,145 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export formats for other DNS filters
+const (
+	ExportAdGuard  = "adguard"
+	ExportDNScrypt = "dnscrypt"
+	ExportPihole   = "pihole"
+)
+
+// exportFile is one of an export format's files and how it renders entries
+type exportFile struct {
+	name    string
+	comment string
+	allow   bool // includes whitelisted entries
+	block   bool // includes blacklisted entries
+	rule    func(name string, exact, allow bool) string
+}
+
+// exports maps export formats to their files
+var exports = map[string][]exportFile{
+	ExportAdGuard: {
+		{name: "adguard.txt", comment: "!", allow: true, block: true, rule: adguardRule},
+	},
+	ExportDNScrypt: {
+		{name: "blocked-names.txt", comment: "#", block: true, rule: dnscryptRule},
+		{name: "allowed-names.txt", comment: "#", allow: true, rule: dnscryptRule},
+	},
+	ExportPihole: {
+		{name: "gravity.list", comment: "#", block: true, rule: piholeRule},
+		{name: "whitelist.txt", comment: "#", allow: true, rule: piholeRule},
+	},
+}
+
+// Exporter enables the entry index so the merged lists can be exported in format after processing
+func (c *Config) Exporter(format string) error {
+	if _, ok := exports[format]; !ok {
+		return fmt.Errorf("unknown export format %q, use one of %s, %s or %s", format, ExportAdGuard, ExportDNScrypt, ExportPihole)
+	}
+	c.indexOn()
+	return nil
+}
+
+// adguardRule returns an AdGuard Home filtering rule, e.g. ||ads.com^, |trk.ads.com^ or @@||good.com^
+func adguardRule(name string, exact, allow bool) string {
+	r := "||" + name + "^"
+	if exact {
+		r = "|" + name + "^"
+	}
+	if allow {
+		r = "@@" + r
+	}
+	return r
+}
+
+// dnscryptRule returns dnscrypt-proxy patterns, e.g. ads.com and *.ads.com, or =trk.ads.com for exact names
+func dnscryptRule(name string, exact, allow bool) string {
+	if exact {
+		return "=" + name
+	}
+	return name + "\n*." + name
+}
+
+// piholeRule returns a Pi-hole gravity list entry, which is always an exact name
+func piholeRule(name string, exact, allow bool) string {
+	return name
+}
+
+// Export writes the merged blacklist and whitelist to dir in format's native files, each with a header
+// recording the generator version, timestamp and sources, and returns the files written
+func (c *Config) Export(format, dir, version string) ([]string, error) {
+	files, ok := exports[format]
+	if !ok || c.idx == nil {
+		return nil, fmt.Errorf("export %q hasn't been enabled", format)
+	}
+
+	var (
+		names   = c.idx.names()
+		sources = make(map[string]struct{})
+		srcs    []string
+		written []string
+	)
+
+	for _, n := range names {
+		r, _ := c.idx.get(n)
+		sources[r.src] = struct{}{}
+	}
+	for k := range sources {
+		srcs = append(srcs, k)
+	}
+	sort.Strings(srcs)
+
+	for _, x := range files {
+		file := filepath.Join(dir, x.name)
+		f, err := os.Create(file)
+		if err != nil {
+			return written, err
+		}
+
+		w := bufio.NewWriter(f)
+		fmt.Fprintf(w, "%s Generated by update-dnsmasq %s on %s\n", x.comment, version, time.Now().Format(time.RFC3339))
+		fmt.Fprintf(w, "%s Sources: %s\n", x.comment, strings.Join(srcs, ", "))
+
+		for _, n := range names {
+			r, _ := c.idx.get(n)
+			allow, exact := exportType(r.nType)
+			if allow && !x.allow || !allow && !x.block {
+				continue
+			}
+			fmt.Fprintln(w, x.rule(n, exact, allow))
+		}
+
+		if err = w.Flush(); err != nil {
+			f.Close()
+			return written, err
+		}
+		if err = f.Close(); err != nil {
+			return written, err
+		}
+		written = append(written, file)
+	}
+	return written, nil
+}
+
+// exportType returns whether entries of type n are whitelisted and whether they match exact names only
+func exportType(n ntype) (allow, exact bool) {
+	switch n {
+	case excDomn, excRoot:
+		return true, false
+	case excHost:
+		return true, true
+	case host, preHost:
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,77 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExportRules(t *testing.T) {
+	Convey("Testing export rules", t, func() {
+		So(adguardRule("ads.com", false, false), ShouldEqual, "||ads.com^")
+		So(adguardRule("trk.com", true, false), ShouldEqual, "|trk.com^")
+		So(adguardRule("good.com", false, true), ShouldEqual, "@@||good.com^")
+		So(dnscryptRule("ads.com", false, false), ShouldEqual, "ads.com\n*.ads.com")
+		So(dnscryptRule("trk.com", true, false), ShouldEqual, "=trk.com")
+		So(piholeRule("ads.com", false, false), ShouldEqual, "ads.com")
+	})
+}
+
+func TestExport(t *testing.T) {
+	Convey("Testing Export()", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: pdnsCfg}), ShouldBeNil)
+		So(c.Exporter("bind"), ShouldNotBeNil)
+		So(c.Exporter(ExportDNScrypt), ShouldBeNil)
+
+		for _, iface := range []IFace{PreDObj, PreHObj, ExDmObj, ExHtObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		tests := []struct {
+			exp    []string
+			file   string
+			format string
+		}{
+			{
+				format: ExportDNScrypt,
+				file:   "blocked-names.txt",
+				exp:    []string{"# Sources: blacklisted-servers, blacklisted-subdomains, whitelisted-servers, whitelisted-subdomains", "ads.com", "*.ads.com", "ads.net", "*.ads.net", "=trk.foo.com"},
+			},
+			{
+				format: ExportDNScrypt,
+				file:   "allowed-names.txt",
+				exp:    []string{"# Sources: blacklisted-servers, blacklisted-subdomains, whitelisted-servers, whitelisted-subdomains", "good.ads.com", "*.good.ads.com", "=ok.bar.com"},
+			},
+			{
+				format: ExportAdGuard,
+				file:   "adguard.txt",
+				exp:    []string{"! Sources: blacklisted-servers, blacklisted-subdomains, whitelisted-servers, whitelisted-subdomains", "||ads.com^", "||ads.net^", "@@||good.ads.com^", "@@|ok.bar.com^", "|trk.foo.com^"},
+			},
+			{
+				format: ExportPihole,
+				file:   "gravity.list",
+				exp:    []string{"# Sources: blacklisted-servers, blacklisted-subdomains, whitelisted-servers, whitelisted-subdomains", "ads.com", "ads.net", "trk.foo.com"},
+			},
+		}
+
+		for _, tt := range tests {
+			files, err := c.Export(tt.format, dir, "1.2.3")
+			So(err, ShouldBeNil)
+			So(files, ShouldContain, dir+"/"+tt.file)
+
+			b, err := ioutil.ReadFile(dir + "/" + tt.file)
+			So(err, ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			So(lines[0], ShouldStartWith, lines[1][:1]+" Generated by update-dnsmasq 1.2.3 on ")
+			So(lines[1:], ShouldResemble, tt.exp)
+		}
+	})
+}
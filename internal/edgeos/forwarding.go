@@ -0,0 +1,147 @@
+package edgeos
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// forwarding node and leaf
+const (
+	forwarding = "forwarding"
+	upstream   = "upstream"
+)
+
+// Conflict is a forwarded domain that the blacklist also blocks, either itself or through a parent domain
+type Conflict struct {
+	Domain    string `json:"domain"`     // forwarded domain
+	Source    string `json:"source"`     // forwarding source
+	Blocked   string `json:"blocked"`    // blacklist entry
+	BlockedBy string `json:"blocked_by"` // blacklist source
+}
+
+// upstreamLabel returns val if it's a resolver address with an optional port, e.g. 10.8.0.1 or fd00::53#5353,
+// otherwise it logs a warning and returns ""
+func (c *Config) upstreamLabel(val string) string {
+	addr, port := val, ""
+	if i := strings.LastIndex(val, "#"); i >= 0 {
+		addr, port = val[:i], val[i+1:]
+	}
+
+	ok := net.ParseIP(addr) != nil
+	if port != "" {
+		p, err := strconv.Atoi(port)
+		ok = ok && err == nil && p > 0 && p < 65536
+	}
+	if !ok {
+		if c.Log != nil {
+			c.Log.Warningf("Ignoring invalid %s %q", upstream, val)
+		}
+		return ""
+	}
+	return val
+}
+
+// forwardSrcs returns the forwarding node's include list, if it has one, and its sources,
+// defaulting their upstream to the node's
+func (c *Config) forwardSrcs() []*source {
+	if !c.nodeExists(forwarding) {
+		return nil
+	}
+
+	var (
+		node = c.tree[forwarding]
+		srcs []*source
+	)
+
+	if len(node.inc) > 0 {
+		srcs = append(srcs, &source{
+			Env:   c.Env,
+			desc:  getLtypeDesc(nodeIncs),
+			inc:   node.inc,
+			ltype: nodeIncs,
+			name:  nodeIncs,
+			nType: fwd,
+		})
+	}
+	srcs = append(srcs, c.validate(forwarding).src...)
+
+	for _, s := range srcs {
+		if s.upstream == "" {
+			s.upstream = node.upstream
+		}
+	}
+	return srcs
+}
+
+// Forwarding writes a dnsmasq server=/domain/upstream file for each forwarding node source, so
+// their domains are resolved by that source's upstream, then reports forwarded domains that the
+// blacklist blocks, since the block wins
+func (c *Config) Forwarding() error {
+	c.conflicts = nil
+	if !c.nodeExists(forwarding) || c.tree[forwarding].disabled {
+		return nil
+	}
+
+	var (
+		exc  = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		srcs []*source
+	)
+
+	for _, e := range c.tree[forwarding].exc {
+		exc.set([]byte(e))
+	}
+	env := c.sideEnv(exc)
+	env.idx = newIndex() // the forwarded names, to check against the blacklist
+
+	for _, s := range c.forwardSrcs() {
+		if s.upstream == "" {
+			c.Log.Warningf("Skipping %s source %s, it has no %s", forwarding, s.name, upstream)
+			continue
+		}
+		s.Env = env
+		srcs = append(srcs, s)
+	}
+
+	err := processSide(srcs)
+
+	c.conflicts = c.conflictsWith(env.idx)
+	for _, x := range c.conflicts {
+		c.Log.Warningf("Forwarded domain %s (%s) is blocked by %s (%s)", x.Domain, x.Source, x.Blocked, x.BlockedBy)
+	}
+	return err
+}
+
+// Conflicts returns the forwarded domains that the last call to Forwarding found the blacklist blocks
+func (c *Config) Conflicts() []Conflict {
+	return c.conflicts
+}
+
+// conflictsWith returns the names in fwd that the blacklist blocks, unless it whitelists them
+func (c *Config) conflictsWith(fwd *index) (x []Conflict) {
+	if c.idx == nil {
+		return nil
+	}
+	for _, name := range fwd.names() {
+		r, _ := fwd.get(name)
+		for d := name; ; {
+			if b, ok := c.idx.get(d); ok {
+				allow, exact := exportType(b.nType)
+				if allow {
+					break
+				}
+				if !exact || d == name {
+					x = append(x, Conflict{Domain: name, Source: r.src, Blocked: d, BlockedBy: b.src})
+					break
+				}
+			}
+			i := strings.IndexByte(d, '.')
+			if i < 0 {
+				break
+			}
+			d = d[i+1:]
+		}
+	}
+	return x
+}
@@ -0,0 +1,136 @@
+package edgeos
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUpstreamLabel(t *testing.T) {
+	Convey("Testing upstreamLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		tests := []struct {
+			val string
+			exp string
+		}{
+			{val: "10.8.0.1", exp: "10.8.0.1"},
+			{val: "10.8.0.1#5353", exp: "10.8.0.1#5353"},
+			{val: "fd00::53#53", exp: "fd00::53#53"},
+			{val: "10.8.0.1#0", exp: ""},
+			{val: "10.8.0.1#65536", exp: ""},
+			{val: "10.8.0.1#dns", exp: ""},
+			{val: "dns.corp.com", exp: ""},
+			{val: "", exp: ""},
+		}
+		for _, tt := range tests {
+			So(c.upstreamLabel(tt.val), ShouldEqual, tt.exp)
+		}
+	})
+}
+
+func TestForwarding(t *testing.T) {
+	Convey("Testing Forwarding()", t, func() {
+		c, dir := newTestConfig(WCard(Wildcard{Node: "*s", Name: "*"}))
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/corp.txt", []byte("corp.com\nlegacy.corp.com\nwww.corp.com\ncdn.ads.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/lab.txt", []byte("zone lab.net\nzone trk.foo.com\nzone good.ads.com\n"), 0644), ShouldBeNil)
+
+		So(c.Forwarding(), ShouldBeNil)
+		So(c.Conflicts(), ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(forwardingCfg, dir, dir)}), ShouldBeNil)
+		So(c.tree[forwarding].upstream, ShouldEqual, "10.8.0.1#5353")
+
+		stale := dir + "/forwarding.removed.blacklist.conf"
+		So(ioutil.WriteFile(stale, []byte("server=/old.com/10.8.0.1\n"), 0644), ShouldBeNil)
+		So(c.GetAll().Files().Remove(), ShouldBeNil)
+		_, err := os.Stat(stale)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		for _, iface := range []IFace{PreDObj, PreHObj, ExDmObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			for _, s := range ct.GetList().src {
+				So(s.nType, ShouldNotEqual, fwd)
+			}
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		So(c.Forwarding(), ShouldBeNil)
+
+		files, err := filepath.Glob(dir + "/forwarding.*.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(files, ShouldResemble, []string{
+			dir + "/forwarding.corp.blacklist.conf",
+			dir + "/forwarding.included-domains.blacklist.conf",
+			dir + "/forwarding.lab.blacklist.conf",
+		})
+
+		act, err := ioutil.ReadFile(dir + "/forwarding.corp.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server=/cdn.ads.com/10.8.0.1#5353\nserver=/corp.com/10.8.0.1#5353\nserver=/www.corp.com/10.8.0.1#5353\n")
+
+		act, err = ioutil.ReadFile(dir + "/forwarding.lab.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server=/good.ads.com/192.168.10.1\nserver=/lab.net/192.168.10.1\nserver=/trk.foo.com/192.168.10.1\n")
+
+		act, err = ioutil.ReadFile(dir + "/forwarding.included-domains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server=/home.arpa/10.8.0.1#5353\n")
+
+		So(c.Conflicts(), ShouldResemble, []Conflict{
+			{Domain: "cdn.ads.com", Source: "corp", Blocked: "ads.com", BlockedBy: PreDomns},
+			{Domain: "trk.foo.com", Source: "lab", Blocked: "trk.foo.com", BlockedBy: PreHosts},
+		})
+
+		Convey("Testing the run report lists the conflicts", func() {
+			c.SetOpt(Collect(true))
+			So(c.RunDone(true), ShouldBeNil)
+
+			r := c.Report("", "")
+			So(r.Conflicts, ShouldResemble, c.Conflicts())
+
+			var b bytes.Buffer
+			So(r.Encode(&b), ShouldBeNil)
+			So(b.String(), ShouldContainSubstring, `"conflicts": [
+    {
+      "domain": "cdn.ads.com",
+      "source": "corp",
+      "blocked": "ads.com",
+      "blocked_by": "blacklisted-subdomains"
+    },`)
+		})
+	})
+}
+
+var forwardingCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		exclude good.ads.com
+		include ads.com
+	}
+	hosts {
+		include trk.foo.com
+		include www.lab.net
+	}
+	forwarding {
+		exclude legacy.corp.com
+		include home.arpa
+		upstream 10.8.0.1#5353
+		source corp {
+			file %s/corp.txt
+		}
+		source lab {
+			file %s/lab.txt
+			prefix "zone "
+			upstream 192.168.10.1
+		}
+	}
+}`
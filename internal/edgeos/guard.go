@@ -0,0 +1,149 @@
+package edgeos
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+)
+
+// shrink guard leaves, set on the blacklist node for every source, or on a source to override them
+const (
+	maxChange  = "max-change"
+	minEntries = "min-entries"
+)
+
+// shrinkGuard holds the blacklist node's shrink guard and the kept counts of sources' last published runs
+type shrinkGuard struct {
+	change float64 // percent drop or growth
+	min    int
+	once   *sync.Once
+	prev   map[string]int
+}
+
+// shrinkOn creates the shrink guard on first use
+func (c *Config) shrinkOn() {
+	if c.shrink == nil {
+		c.shrink = &shrinkGuard{once: &sync.Once{}}
+	}
+}
+
+// guardLabel sets the blacklist node's min-entries and max-change leaves
+func (c *Config) guardLabel(leaf, val string) {
+	c.shrinkOn()
+	c.shrink.min, c.shrink.change, _ = c.guardLimits(leaf, val, c.shrink.min, c.shrink.change)
+}
+
+// sourceGuardLabel sets a source's min-entries and max-change leaves, which override the blacklist node's
+func (c *Config) sourceGuardLabel(o *source, leaf, val string) {
+	c.shrinkOn()
+	var ok bool
+	if o.minKeep, o.maxChange, ok = c.guardLimits(leaf, val, o.minKeep, o.maxChange); !ok {
+		return
+	}
+	switch leaf {
+	case minEntries:
+		o.minSet = true
+	case maxChange:
+		o.changeSet = true
+	}
+}
+
+// checkGuards warns if a max-change leaf is set without the history-file it needs for its baseline
+func (c *Config) checkGuards() {
+	if c.shrink == nil || c.Log == nil || (c.hist != nil && c.hist.file != "") {
+		return
+	}
+	change := c.shrink.change > 0
+	for _, node := range c.tree {
+		for _, s := range node.src {
+			change = change || (s.changeSet && s.maxChange > 0)
+		}
+	}
+	if change {
+		c.Log.Warningf("Ignoring %s, it needs a %s to compare each source's entries with", maxChange, histFile)
+	}
+}
+
+// guardLimits returns min and change with leaf set to val and true, or unchanged, false and a warning if val isn't valid
+func (c *Config) guardLimits(leaf, val string, min int, change float64) (int, float64, bool) {
+	switch leaf {
+	case minEntries:
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			return n, change, true
+		}
+	case maxChange:
+		if f, err := strconv.ParseFloat(val, 64); err == nil && f >= 0 {
+			return min, f, true
+		}
+	}
+	if c.Log != nil {
+		c.Log.Warningf("Ignoring invalid %s %q", leaf, val)
+	}
+	return min, change, false
+}
+
+// baseline returns the entries the source kept in the last run that published it, from the history-file
+func (s *source) baseline() (int, bool) {
+	g := s.shrink
+	g.once.Do(func() {
+		g.prev = make(map[string]int)
+		if s.hist == nil || s.hist.file == "" {
+			return
+		}
+		runs, err := readHistory(s.hist.file)
+		if err != nil {
+			s.Log.Warningf("Cannot read %s for %s: %v", histFile, maxChange, err)
+			return
+		}
+		for _, r := range runs {
+			for k, v := range r.Src {
+				g.prev[k] = v
+			}
+		}
+	})
+	n, ok := g.prev[s.area()+"/"+s.name]
+	return n, ok
+}
+
+// guarded returns true if shrink guards apply to the source: a downloaded or file blacklist source
+func (s *source) guarded() bool {
+	if s.shrink == nil || (s.ltype != urls && s.ltype != files) {
+		return false
+	}
+	switch s.nType {
+	case domn, host, root:
+		return true
+	}
+	return false
+}
+
+// tripped returns why a downloaded or file source that kept this many entries mustn't be published,
+// or "" if it passes its guards or the operator forced acceptance
+func (s *source) tripped(kept int) string {
+	if s.force || !s.guarded() {
+		return ""
+	}
+
+	min, change := s.shrink.min, s.shrink.change
+	if s.minSet {
+		min = s.minKeep
+	}
+	if s.changeSet {
+		change = s.maxChange
+	}
+
+	if kept < min {
+		return fmt.Sprintf("kept %d entries, fewer than %s %d", kept, minEntries, min)
+	}
+	if change == 0 {
+		return ""
+	}
+	if prev, ok := s.baseline(); ok && prev > 0 {
+		pct := float64(kept-prev) * 100 / float64(prev)
+		if math.Abs(pct) > change {
+			return fmt.Sprintf("kept %d entries, %+.0f%% since it last published %d, beyond %s %v%%", kept, pct, prev, maxChange, change)
+		}
+	}
+	return ""
+}
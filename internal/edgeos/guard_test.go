@@ -0,0 +1,213 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGuardLabel(t *testing.T) {
+	Convey("Testing guardLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		c.guardLabel(minEntries, "100")
+		c.guardLabel(maxChange, "-5")
+		c.guardLabel(maxChange, "40")
+		c.guardLabel(minEntries, "many")
+		So(c.shrink.min, ShouldEqual, 100)
+		So(c.shrink.change, ShouldEqual, 40)
+
+		o := &source{}
+		c.sourceGuardLabel(o, minEntries, "5")
+		c.sourceGuardLabel(o, maxChange, "12.5")
+		So(o.minKeep, ShouldEqual, 5)
+		So(o.maxChange, ShouldEqual, 12.5)
+		So(o.minSet && o.changeSet, ShouldBeTrue)
+
+		Convey("A source's min-entries 0 overrides the blacklist node's", func() {
+			o := &source{Env: c.Env, ltype: files, nType: domn}
+			So(o.tripped(1), ShouldEqual, "kept 1 entries, fewer than min-entries 100")
+			c.sourceGuardLabel(o, minEntries, "none")
+			So(o.minSet, ShouldBeFalse)
+			c.sourceGuardLabel(o, minEntries, "0")
+			So(o.minSet, ShouldBeTrue)
+			So(o.tripped(1), ShouldEqual, "")
+		})
+	})
+}
+
+func TestGuardRestore(t *testing.T) {
+	Convey("Testing a tripped guard in a consolidated layout", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		run := func(drop, keep string) string {
+			So(ioutil.WriteFile(dir+"/drop.txt", []byte(drop), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(dir+"/keep.txt", []byte(keep), 0644), ShouldBeNil)
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(restoreCfg, dir, dir)}), ShouldBeNil)
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.Finish(), ShouldBeNil)
+			act, err := ioutil.ReadFile(dir + "/domains.consolidated.blacklist.conf")
+			So(err, ShouldBeNil)
+			return string(act)
+		}
+
+		So(run("a.com\nb.com\nc.com\n", "d.com\n"), ShouldEqual, `# 4 entries from sources: drop (3), keep (1)
+address=/a.com/0.0.0.0
+address=/b.com/0.0.0.0
+address=/c.com/0.0.0.0
+address=/d.com/0.0.0.0
+`)
+		kept, err := ioutil.ReadFile(dir + "/.domains.drop.kept")
+		So(err, ShouldBeNil)
+		So(string(kept), ShouldEqual, "a.com\nb.com\nc.com\n")
+
+		Convey("keeps its last published entries, and doesn't claim names other sources list", func() {
+			So(run("e.com\n", "d.com\ne.com\n"), ShouldEqual, `# 5 entries from sources: drop (3), keep (2)
+address=/a.com/0.0.0.0
+address=/b.com/0.0.0.0
+address=/c.com/0.0.0.0
+address=/d.com/0.0.0.0
+address=/e.com/0.0.0.0
+`)
+			kept, err := ioutil.ReadFile(dir + "/.domains.drop.kept")
+			So(err, ShouldBeNil)
+			So(string(kept), ShouldEqual, "a.com\nb.com\nc.com\n")
+		})
+	})
+}
+
+func TestShrinkGuard(t *testing.T) {
+	Convey("Testing shrink guards", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/tiny.txt", []byte("a.com\nb.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/big.txt", []byte("c.com\nd.com\ne.com\nf.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/strict.txt", []byte("g.com\nh.com\ni.com\nj.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/drop.txt", []byte("k.com\nl.com\nm.com\n"), 0644), ShouldBeNil)
+		So(writeHistory(dir+"/blacklist.history", []histRun{
+			{T: 1, OK: true, Src: map[string]int{"domains/big": 4, "domains/drop": 10}},
+		}), ShouldBeNil)
+
+		previous := "address=/old.com/0.0.0.0\n"
+		for _, f := range []string{"tiny", "strict", "drop"} {
+			So(ioutil.WriteFile(fmt.Sprintf("%s/domains.%s.blacklist.conf", dir, f), []byte(previous), 0644), ShouldBeNil)
+		}
+
+		run := func(opts ...Option) *Config {
+			c := NewConfig(append([]Option{
+				Collect(true),
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Prefix("address=", "server="),
+			}, opts...)...)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(guardCfg, dir, dir, dir, dir, dir)}), ShouldBeNil)
+			c.indexOn()
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.RunDone(true), ShouldBeNil)
+			return c
+		}
+
+		c := run()
+
+		for _, tt := range []struct {
+			name string
+			exp  string
+		}{
+			{name: "tiny", exp: previous},
+			{name: "big", exp: "address=/c.com/0.0.0.0\naddress=/d.com/0.0.0.0\naddress=/e.com/0.0.0.0\naddress=/f.com/0.0.0.0\n"},
+			{name: "strict", exp: previous},
+			{name: "drop", exp: previous},
+		} {
+			act, err := ioutil.ReadFile(fmt.Sprintf("%s/domains.%s.blacklist.conf", dir, tt.name))
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, tt.exp)
+		}
+
+		guards := make(map[string]string)
+		for _, s := range c.Report("", "").Sources {
+			guards[s.Name] = s.Guard
+		}
+		So(guards, ShouldResemble, map[string]string{
+			"tiny":   "kept 2 entries, fewer than min-entries 3",
+			"big":    "",
+			"strict": "kept 4 entries, fewer than min-entries 10",
+			"drop":   "kept 3 entries, -70% since it last published 10, beyond max-change 50%",
+		})
+		So(c.Report("", "").Blocked, ShouldEqual, 4)
+
+		_, ok := c.idx.get("a.com")
+		So(ok, ShouldBeFalse)
+		_, ok = c.idx.get("c.com")
+		So(ok, ShouldBeTrue)
+
+		runs, err := readHistory(dir + "/blacklist.history")
+		So(err, ShouldBeNil)
+		So(runs[len(runs)-1].Src, ShouldResemble, map[string]int{"domains/big": 4})
+
+		Convey("Testing Force()", func() {
+			c := run(Force(true))
+			act, err := ioutil.ReadFile(dir + "/domains.tiny.blacklist.conf")
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "address=/a.com/0.0.0.0\naddress=/b.com/0.0.0.0\n")
+			So(c.Report("", "").Blocked, ShouldEqual, 13)
+		})
+	})
+}
+
+var guardCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	history-file %s/blacklist.history
+	max-change 50
+	min-entries 3
+	domains {
+		source tiny {
+			file %s/tiny.txt
+		}
+		source big {
+			file %s/big.txt
+		}
+		source strict {
+			file %s/strict.txt
+			min-entries 10
+		}
+		source drop {
+			file %s/drop.txt
+		}
+	}
+}`
+
+var restoreCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	min-entries 1
+	output-layout per-area
+	domains {
+		source drop {
+			file %s/drop.txt
+			min-entries 2
+		}
+		source keep {
+			file %s/keep.txt
+		}
+	}
+}`
@@ -0,0 +1,85 @@
+package edgeos
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// healthCheck is the blacklist node's leaf naming a blocked domain to look up after each reload
+const healthCheck = "health-check"
+
+var (
+	// healthServer is the DNS server health checks query, the local dnsmasq
+	healthServer = "127.0.0.1:53"
+	// healthTries and healthWait allow for the DNS server still restarting
+	healthTries = 3
+	healthWait  = time.Second
+)
+
+// HealthCheck looks up the health-check domain with the local DNS server and returns an error, after
+// notifying health-check-failed, unless the answer shows it's blocked
+func (c *Config) HealthCheck() error {
+	n := c.notes
+	if n == nil || n.probe == "" {
+		return nil
+	}
+
+	err := c.probe(n.probe)
+	for i := 1; i < healthTries && err != nil && !isAnswer(err); i++ {
+		time.Sleep(healthWait)
+		err = c.probe(n.probe)
+	}
+	if err != nil {
+		n.notify(eventHealth, "", err.Error(), 0)
+	}
+	return err
+}
+
+// unblocked is a health check answer that shows the domain isn't blocked
+type unblocked struct{ error }
+
+// isAnswer returns true if err is the DNS server's answer, rather than a failure to get one
+func isAnswer(err error) bool {
+	_, ok := err.(unblocked)
+	return ok
+}
+
+// probe returns nil if the DNS server answers name with a redirect IP, an unspecified address or NXDOMAIN
+func (c *Config) probe(name string) error {
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, healthServer)
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	addrs, err := r.LookupHost(ctx, name)
+	if err != nil {
+		if e, ok := err.(*net.DNSError); ok && e.IsNotFound {
+			return nil
+		}
+		return fmt.Errorf("%s lookup of %s failed: %v", healthCheck, name, err)
+	}
+
+	redirect := make(map[string]bool)
+	for _, n := range c.sortKeys() {
+		for _, ip := range []string{c.tree.getIP(n), c.tree.getIP6(n)} {
+			if a := net.ParseIP(ip); a != nil {
+				redirect[a.String()] = true
+			}
+		}
+	}
+	for _, a := range addrs {
+		ip := net.ParseIP(a)
+		if ip == nil || !(ip.IsUnspecified() || redirect[ip.String()]) {
+			return unblocked{fmt.Errorf("%s %s isn't blocked, it resolved to %s", healthCheck, name, strings.Join(addrs, ", "))}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package edgeos
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// dnsStandIn answers every A query with ip, or NXDOMAIN if ip is nil, and every other query with no
+// records; it returns the server's address and a func to stop it
+func dnsStandIn(ip net.IP) (string, func()) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			q := buf[:n]
+			i := 12
+			for i < n && q[i] != 0 {
+				i += int(q[i]) + 1
+			}
+			if i+5 > n {
+				continue
+			}
+			qtype := int(q[i+1])<<8 | int(q[i+2])
+
+			// echo the header and question, dropping any EDNS record
+			resp := append([]byte(nil), q[:i+5]...)
+			resp[2], resp[3] = 0x81, 0x80
+			resp[6], resp[7], resp[8], resp[9], resp[10], resp[11] = 0, 0, 0, 0, 0, 0
+			switch {
+			case ip == nil:
+				resp[3] |= 3
+			case qtype == 1:
+				resp[7] = 1
+				resp = append(resp, 0xc0, 0x0c, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+				resp = append(resp, ip.To4()...)
+			}
+			pc.WriteTo(resp, from)
+		}
+	}()
+	return pc.LocalAddr().String(), func() { pc.Close() }
+}
+
+func TestHealthCheck(t *testing.T) {
+	Convey("Testing HealthCheck()", t, func() {
+		server, tries, wait := healthServer, healthTries, healthWait
+		defer func() { healthServer, healthTries, healthWait = server, tries, wait }()
+		healthTries, healthWait = 2, 10*time.Millisecond
+
+		web := newHook()
+		defer web.Close()
+
+		c := NewConfig(Logger(newLog()))
+		So(c.HealthCheck(), ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(healthCfg, web.URL)}), ShouldBeNil)
+		c.notes.state = ""
+
+		tests := []struct {
+			ip   net.IP
+			ok   bool
+			name string
+		}{
+			{ip: net.ParseIP("0.0.0.0"), ok: true, name: "unspecified address"},
+			{ip: net.ParseIP("192.168.168.1"), ok: true, name: "redirect IP"},
+			{ip: nil, ok: true, name: "NXDOMAIN"},
+			{ip: net.ParseIP("93.184.216.34"), ok: false, name: "real address"},
+		}
+
+		for _, tt := range tests {
+			Convey("Answering with "+tt.name, func() {
+				addr, stop := dnsStandIn(tt.ip)
+				defer stop()
+				healthServer = addr
+
+				err := c.HealthCheck()
+				if tt.ok {
+					So(err, ShouldBeNil)
+					So(web.posted(), ShouldBeEmpty)
+					return
+				}
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "health-check ads.example.com isn't blocked, it resolved to 93.184.216.34")
+				So(web.posted(), ShouldHaveLength, 1)
+				So(web.posted()[0], ShouldContainSubstring, `"event":"health-check-failed"`)
+			})
+		}
+	})
+}
+
+var healthCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	health-check ads.example.com
+	notify-webhook %s
+	domains {
+		dns-redirect-ip 192.168.168.1
+	}
+}`
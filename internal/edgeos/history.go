@@ -0,0 +1,294 @@
+package edgeos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// history leaves and their defaults
+const (
+	anomalyAt   = "anomaly-threshold"
+	histFile    = "history-file"
+	histRuns    = "history-runs"
+	defAnomaly  = 50
+	defHistRuns = 60
+	total       = "total"
+)
+
+// sparks are the sparkline bars, lowest to highest
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// history configures the run history file and anomaly detection
+type history struct {
+	file      string
+	runs      int     // runs kept in the file, so it stays small on flash storage
+	threshold float64 // percent change flagged as an anomaly
+}
+
+// histRun is one run's line in the history file, kept compact
+type histRun struct {
+	T       int64          `json:"t"`
+	OK      bool           `json:"ok"`
+	Blocked int32          `json:"blocked"`
+	Src     map[string]int `json:"src"`
+}
+
+// Anomaly is a source, or the total, whose kept entries changed by at least anomaly-threshold
+// percent since the previous run
+type Anomaly struct {
+	Source   string  `json:"source"`
+	Previous int     `json:"previous"`
+	Current  int     `json:"current"`
+	Change   float64 `json:"change_percent"`
+}
+
+// historyLabel sets the blacklist node's history-file, history-runs and anomaly-threshold leaves
+func (c *Config) historyLabel(leaf, val string) {
+	if c.hist == nil {
+		c.hist = &history{runs: defHistRuns, threshold: defAnomaly}
+	}
+	switch leaf {
+	case histFile:
+		c.metricsOn()
+		c.hist.file = val
+	case histRuns:
+		if n, err := strconv.Atoi(val); err == nil && n > 1 {
+			c.hist.runs = n
+		} else if c.Log != nil {
+			c.Log.Warningf("Ignoring invalid %s %q, using %d", histRuns, val, c.hist.runs)
+		}
+	case anomalyAt:
+		if f, err := strconv.ParseFloat(val, 64); err == nil && f > 0 {
+			c.hist.threshold = f
+		} else if c.Log != nil {
+			c.Log.Warningf("Ignoring invalid %s %q, using %v", anomalyAt, val, c.hist.threshold)
+		}
+	}
+}
+
+// recordHistory flags anomalies against the previous run, then appends this run to the history file,
+// dropping the oldest runs beyond history-runs
+func (c *Config) recordHistory() error {
+	h, m := c.hist, c.metrics
+	if h == nil || h.file == "" || m == nil {
+		return nil
+	}
+
+	m.RLock()
+	run := histRun{T: m.finished.Unix(), OK: m.result == 1, Blocked: m.blocked, Src: make(map[string]int)}
+	for k, x := range m.src {
+		if x.block && x.guard == "" {
+			run.Src[k] = m.counts(x).Kept
+		}
+	}
+	m.RUnlock()
+
+	runs, err := readHistory(h.file)
+	if err != nil {
+		return err
+	}
+
+	var anoms []Anomaly
+	if len(runs) > 0 {
+		anoms = anomalies(runs[len(runs)-1], run, h.threshold)
+	}
+	for _, a := range anoms {
+		c.Log.Warningf("Anomaly: %s kept %d entries, %+.0f%% since the previous run's %d", a.Source, a.Current, a.Change, a.Previous)
+	}
+	m.Lock()
+	m.anoms = anoms
+	m.Unlock()
+
+	runs = append(runs, run)
+	if len(runs) > h.runs {
+		runs = runs[len(runs)-h.runs:]
+	}
+	return writeHistory(h.file, runs)
+}
+
+// anomalies returns the sources, and the total, whose counts changed by at least threshold percent
+func anomalies(prev, cur histRun, threshold float64) (x []Anomaly) {
+	check := func(name string, p, c int) {
+		if p == 0 {
+			return
+		}
+		change := float64(c-p) * 100 / float64(p)
+		if math.Abs(change) >= threshold {
+			x = append(x, Anomaly{Source: name, Previous: p, Current: c, Change: math.Round(change*10) / 10})
+		}
+	}
+
+	check(total, int(prev.Blocked), int(cur.Blocked))
+	for _, k := range sortedKeys(cur.Src) {
+		if p, ok := prev.Src[k]; ok {
+			check(k, p, cur.Src[k])
+		}
+	}
+	return x
+}
+
+// sortedKeys returns m's keys in order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// readHistory returns the runs in the history file, oldest first, skipping unreadable lines
+func readHistory(file string) ([]histRun, error) {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []histRun
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		var r histRun
+		if len(line) > 0 && json.Unmarshal(line, &r) == nil {
+			runs = append(runs, r)
+		}
+	}
+	return runs, nil
+}
+
+// writeHistory replaces the history file with runs, one JSON line each
+func writeHistory(file string, runs []histRun) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	for _, r := range runs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(append(line, '\n'))
+	}
+
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// History writes each source's trend over the last n runs in the history file: its latest kept count,
+// the change since the run before, its range and a sparkline
+func (c *Config) History(w io.Writer, n int) error {
+	if c.hist == nil || c.hist.file == "" {
+		return fmt.Errorf("no %s is configured", histFile)
+	}
+
+	runs, err := readHistory(c.hist.file)
+	if err != nil {
+		return err
+	}
+	if len(runs) == 0 {
+		return fmt.Errorf("%s %s has no runs yet", histFile, c.hist.file)
+	}
+	if n > 0 && len(runs) > n {
+		runs = runs[len(runs)-n:]
+	}
+
+	var (
+		first = time.Unix(runs[0].T, 0).Format("2006-01-02 15:04")
+		last  = time.Unix(runs[len(runs)-1].T, 0).Format("2006-01-02 15:04")
+		names = make(map[string]int)
+	)
+	for _, r := range runs {
+		for k := range r.Src {
+			names[k]++
+		}
+	}
+
+	fmt.Fprintf(w, "Last %d runs, %s to %s\n\n", len(runs), first, last)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "source\tlast\tdelta\tmin\tmax\ttrend")
+
+	series := func(name string, get func(r histRun) (int, bool)) {
+		var (
+			vals []int
+			ok   []bool
+		)
+		for _, r := range runs {
+			v, found := get(r)
+			vals, ok = append(vals, v), append(ok, found)
+		}
+		fmt.Fprintf(tw, "%s\t%s\n", name, trend(vals, ok))
+	}
+
+	series(total, func(r histRun) (int, bool) { return int(r.Blocked), true })
+	for _, k := range sortedKeys(names) {
+		k := k
+		series(k, func(r histRun) (int, bool) {
+			v, found := r.Src[k]
+			return v, found
+		})
+	}
+	return tw.Flush()
+}
+
+// trend returns a series' tab separated last value, delta, minimum, maximum and sparkline;
+// runs without a value are shown as gaps
+func trend(vals []int, ok []bool) string {
+	var (
+		delta    = "-"
+		last     = "-"
+		lo, hi   int
+		prev     = -1
+		spark    strings.Builder
+		hasValue bool
+	)
+
+	for i, v := range vals {
+		if !ok[i] {
+			continue
+		}
+		if !hasValue || v < lo {
+			lo = v
+		}
+		if !hasValue || v > hi {
+			hi = v
+		}
+		hasValue = true
+	}
+	if !hasValue {
+		return "-\t-\t-\t-\t"
+	}
+
+	for i, v := range vals {
+		if !ok[i] {
+			spark.WriteRune(' ')
+			continue
+		}
+		bar := len(sparks) - 1
+		if hi > lo {
+			bar = (v - lo) * (len(sparks) - 1) / (hi - lo)
+		}
+		spark.WriteRune(sparks[bar])
+		if prev >= 0 {
+			delta = fmt.Sprintf("%+d", v-prev)
+		}
+		prev = v
+		last = strconv.Itoa(v)
+	}
+	return fmt.Sprintf("%s\t%s\t%d\t%d\t%s", last, delta, lo, hi, spark.String())
+}
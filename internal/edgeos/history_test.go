@@ -0,0 +1,139 @@
+package edgeos
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHistoryLabel(t *testing.T) {
+	Convey("Testing historyLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		c.historyLabel(histRuns, "10")
+		So(c.hist, ShouldResemble, &history{runs: 10, threshold: defAnomaly})
+		So(c.metrics, ShouldBeNil)
+
+		c.historyLabel(histRuns, "1")
+		c.historyLabel(anomalyAt, "-5")
+		So(c.hist, ShouldResemble, &history{runs: 10, threshold: defAnomaly})
+
+		c.historyLabel(anomalyAt, "25")
+		c.historyLabel(histFile, "/tmp/blacklist.history")
+		So(c.hist, ShouldResemble, &history{file: "/tmp/blacklist.history", runs: 10, threshold: 25})
+		So(c.metrics, ShouldNotBeNil)
+	})
+}
+
+func TestAnomalies(t *testing.T) {
+	Convey("Testing anomalies()", t, func() {
+		prev := histRun{Blocked: 1000, Src: map[string]int{"domains/a": 100, "domains/b": 100, "domains/c": 100, "domains/d": 0}}
+		cur := histRun{Blocked: 1100, Src: map[string]int{"domains/a": 50, "domains/b": 200, "domains/c": 140, "domains/d": 10, "domains/e": 5}}
+		So(anomalies(prev, cur, 50), ShouldResemble, []Anomaly{
+			{Source: "domains/a", Previous: 100, Current: 50, Change: -50},
+			{Source: "domains/b", Previous: 100, Current: 200, Change: 100},
+		})
+		So(anomalies(prev, cur, 10), ShouldResemble, []Anomaly{
+			{Source: total, Previous: 1000, Current: 1100, Change: 10},
+			{Source: "domains/a", Previous: 100, Current: 50, Change: -50},
+			{Source: "domains/b", Previous: 100, Current: 200, Change: 100},
+			{Source: "domains/c", Previous: 100, Current: 140, Change: 40},
+		})
+	})
+}
+
+func TestRecordHistory(t *testing.T) {
+	Convey("Testing recordHistory()", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(Dir(dir), Logger(newLog()))
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(historyCfg, dir)}), ShouldBeNil)
+
+		counted := func(s *source, kept int) {
+			c.ctr.reset(s)
+			c.ctr.add(s, 0, kept, kept, 0, 0)
+			c.metrics.done(s, nil)
+		}
+
+		file := dir + "/history/blacklist.history"
+		for i, kept := range []int{100, 110, 40, 45, 90} {
+			counted(&source{name: "malware", nType: domn}, kept)
+			counted(&source{name: "whitelisted-servers", nType: excHost}, 5)
+			So(c.RunDone(true), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(file)
+			So(err, ShouldBeNil)
+			lines := i + 1
+			if lines > 3 {
+				lines = 3
+			}
+			So(strings.Count(string(b), "\n"), ShouldEqual, lines)
+			So(string(b), ShouldNotContainSubstring, "whitelisted-servers")
+
+			switch i {
+			case 0, 1, 3:
+				So(c.Report("", "").Anomalies, ShouldBeEmpty)
+			case 2:
+				So(c.Report("", "").Anomalies, ShouldResemble, []Anomaly{
+					{Source: total, Previous: 110, Current: 40, Change: -63.6},
+					{Source: "domains/malware", Previous: 110, Current: 40, Change: -63.6},
+				})
+			case 4:
+				So(c.Report("", "").Anomalies, ShouldHaveLength, 2)
+			}
+		}
+
+		runs, err := readHistory(file)
+		So(err, ShouldBeNil)
+		So(runs, ShouldHaveLength, 3)
+		So(runs[2].Src, ShouldResemble, map[string]int{"domains/malware": 90})
+	})
+}
+
+func TestHistory(t *testing.T) {
+	Convey("Testing History()", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(Dir(dir), Logger(newLog()))
+		So(c.History(ioutil.Discard, 5), ShouldNotBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(historyCfg, dir)}), ShouldBeNil)
+		So(c.History(ioutil.Discard, 5), ShouldNotBeNil)
+
+		runs := []histRun{
+			{T: 1, Blocked: 10, Src: map[string]int{"domains/malware": 10}},
+			{T: 2, Blocked: 30, Src: map[string]int{"domains/malware": 20, "hosts/trackers": 10}},
+			{T: 3, Blocked: 50, Src: map[string]int{"domains/malware": 40, "hosts/trackers": 10}},
+			{T: 4, Blocked: 80, Src: map[string]int{"domains/malware": 80}},
+		}
+		So(writeHistory(c.hist.file, runs), ShouldBeNil)
+
+		var b bytes.Buffer
+		So(c.History(&b, 3), ShouldBeNil)
+		lines := strings.Split(b.String(), "\n")
+		So(lines[0], ShouldStartWith, "Last 3 runs, ")
+		So(lines[2:], ShouldResemble, []string{
+			"source           last  delta  min  max  trend",
+			"total            80    +30    30   80   ▁▃█",
+			"domains/malware  80    +40    20   80   ▁▃█",
+			"hosts/trackers   10    +0     10   10   ██ ",
+			"",
+		})
+	})
+}
+
+var historyCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	history-file %s/history/blacklist.history
+	history-runs 3
+	anomaly-threshold 50
+}`
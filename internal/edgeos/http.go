@@ -6,16 +6,70 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 )
 
+// FetchCache keeps URL sources' downloads between a daemon's runs, so a source with a refresh-interval
+// is only downloaded again once it has passed
+type FetchCache struct {
+	*sync.Mutex
+	got map[string]fetched
+}
+
+// fetched is a download and when it was made
+type fetched struct {
+	at   time.Time
+	body []byte
+}
+
+// NewFetchCache returns an empty FetchCache
+func NewFetchCache() *FetchCache {
+	return &FetchCache{Mutex: &sync.Mutex{}, got: make(map[string]fetched)}
+}
+
+// get returns the source's cached download, if it has a refresh-interval that hasn't passed since
+func (f *FetchCache) get(s *source) (fetched, bool) {
+	if f == nil || s.refresh == 0 {
+		return fetched{}, false
+	}
+	f.Lock()
+	defer f.Unlock()
+	x, ok := f.got[s.url]
+	return x, ok && time.Since(x.at) < s.refresh
+}
+
+// put caches the source's download, if it has a refresh-interval
+func (f *FetchCache) put(s *source, body []byte) {
+	if f == nil || s.refresh == 0 {
+		return
+	}
+	f.Lock()
+	f.got[s.url] = fetched{at: time.Now(), body: body}
+	f.Unlock()
+}
+
 // download creates http requests to download data
 func download(s *source) *source {
 	var (
-		body []byte
-		err  error
-		resp *http.Response
-		req  *http.Request
+		body   []byte
+		cached bool
+		err    error
+		resp   *http.Response
+		req    *http.Request
+		start  = time.Now()
 	)
+	defer func() {
+		s.fetch = time.Since(start)
+		s.metrics.fetched(s, resp, len(body), s.fetch, cached)
+	}()
+
+	if x, ok := s.cache.get(s); ok {
+		body, cached = x.body, true
+		s.Log.Info(fmt.Sprintf("Using %s source %s downloaded at %s, its %s hasn't passed", s.area(), s.name, x.at.Format(time.RFC3339), refreshAt))
+		s.r, s.err = bytes.NewBuffer(body), nil
+		return s
+	}
 
 	if req, err = http.NewRequest(s.Method, s.url, nil); err != nil {
 		str := fmt.Sprintf("Unable to form request for %s", s.url)
@@ -47,6 +101,9 @@ func download(s *source) *source {
 		return s
 	}
 
+	if err == nil {
+		s.cache.put(s, body)
+	}
 	s.r, s.err = bytes.NewBuffer(body), err
 	if err = resp.Body.Close(); err != nil {
 		s.Log.Warning(err.Error)
@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"sync"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -130,6 +131,45 @@ func TestMyHandler(t *testing.T) {
 	})
 }
 
+func TestFetchCache(t *testing.T) {
+	Convey("Testing FetchCache", t, func() {
+		server := httptest.NewServer(&myHandler{})
+		defer server.Close()
+
+		var (
+			cache = NewFetchCache()
+			env   = &Env{Log: newLog(), Method: "GET", cache: cache}
+		)
+		get := func(s *source) string {
+			act, err := ioutil.ReadAll(download(s).r)
+			So(err, ShouldBeNil)
+			return string(act)
+		}
+
+		hourly := &source{Env: env, name: "phishing", refresh: time.Hour, url: server.URL + "/phishing"}
+		So(get(hourly), ShouldEqual, "Visitor count: 1.")
+		So(get(hourly), ShouldEqual, "Visitor count: 1.")
+
+		always := &source{Env: env, name: "malware", url: server.URL + "/malware"}
+		So(get(always), ShouldEqual, "Visitor count: 2.")
+		So(get(always), ShouldEqual, "Visitor count: 3.")
+		So(cache.got, ShouldNotContainKey, always.url)
+
+		Convey("Testing an expired download", func() {
+			x := cache.got[hourly.url]
+			x.at = x.at.Add(-time.Hour)
+			cache.got[hourly.url] = x
+			So(get(hourly), ShouldEqual, "Visitor count: 4.")
+			So(get(hourly), ShouldEqual, "Visitor count: 4.")
+		})
+
+		Convey("Testing without a cache", func() {
+			hourly.Env = &Env{Log: newLog(), Method: "GET"}
+			So(get(hourly), ShouldEqual, "Visitor count: 4.")
+		})
+	})
+}
+
 var (
 	HTTPDomainData = `
 // This bind zone is intended to be included in a running dns server for a local net
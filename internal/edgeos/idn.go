@@ -0,0 +1,105 @@
+package edgeos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/britannic/blacklist/internal/fqdn"
+)
+
+const (
+	idnAction  = "idn-action"
+	idnProtect = "idn-protect"
+	idnFlag    = "flag"
+	idnBlock   = "block"
+)
+
+// idnGuard detects IDN homographs, i.e. names mixing scripts or mimicking protected brand domains
+type idnGuard struct {
+	action string
+	brands []string
+}
+
+// idnLabel sets the blacklist node's IDN homograph leaves
+func (c *Config) idnLabel(leaf, val string) {
+	if c.idn == nil {
+		c.idn = &idnGuard{}
+	}
+	switch leaf {
+	case idnAction:
+		switch val {
+		case idnFlag, idnBlock:
+			c.idn.action = val
+		default:
+			c.idn.action = ""
+		}
+	case idnProtect:
+		c.idn.brands = append(c.idn.brands, normalize(val))
+	}
+}
+
+// normalize returns the punycode form of a configured domain, or the domain unchanged if it isn't a valid IDN
+func normalize(s string) string {
+	b, err := fqdn.ToASCII([]byte(strings.ToLower(s)))
+	if err != nil {
+		return s
+	}
+	return string(b)
+}
+
+// idnMode returns the configured idn-action, or "" if homograph detection is off
+func (e *Env) idnMode() string {
+	if e.idn == nil {
+		return ""
+	}
+	return e.idn.action
+}
+
+// idnBrands returns the protected brand domains
+func (e *Env) idnBrands() []string {
+	if e.idn == nil {
+		return nil
+	}
+	return e.idn.brands
+}
+
+// homograph returns why name is an IDN homograph, or "" if it isn't one
+func (e *Env) homograph(name string) string {
+	if e.idnMode() == "" || !fqdn.IsIDN(name) {
+		return ""
+	}
+	for _, b := range e.idn.brands {
+		if fqdn.Confusable(name, b) {
+			return "confusable with " + b
+		}
+	}
+	if fqdn.MixedScript(name) {
+		return "mixed scripts"
+	}
+	return ""
+}
+
+// flag records an IDN homograph found by source s and returns true if it must be dropped;
+// in block mode homographs are never whitelisted
+func (s *source) flag(name []byte) bool {
+	why := s.homograph(string(name))
+	if why == "" {
+		return false
+	}
+	s.homographs = append(s.homographs, fmt.Sprintf("%s [%s] (%s)", name, fqdn.ToUnicode(string(name)), why))
+	switch s.nType {
+	case excDomn, excHost, excRoot:
+		return s.idnMode() == idnBlock
+	}
+	return false
+}
+
+// logHomographs logs the IDN homographs found by source s
+func (s *source) logHomographs() {
+	if len(s.homographs) == 0 {
+		return
+	}
+	sort.Strings(s.homographs)
+	s.Log.Warningf("%s: flagged %d IDN homographs: %s", s.name, len(s.homographs), strings.Join(s.homographs, ", "))
+}
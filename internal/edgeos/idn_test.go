@@ -0,0 +1,68 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHomograph(t *testing.T) {
+	Convey("Testing homograph()", t, func() {
+		e := &Env{}
+		So(e.homograph("xn--pypal-4ve.com"), ShouldEqual, "")
+
+		e.idn = &idnGuard{action: idnFlag, brands: []string{"paypal.com"}}
+		So(e.homograph("xn--pypal-4ve.com"), ShouldEqual, "confusable with paypal.com")
+		So(e.homograph("xn--pple-43d.com"), ShouldEqual, "mixed scripts")
+		So(e.homograph("xn--bcher-kva.de"), ShouldEqual, "")
+		So(e.homograph("paypal.com"), ShouldEqual, "")
+	})
+}
+
+func TestIDN(t *testing.T) {
+	Convey("Testing IDN normalization and homograph blocking", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: idnCfg}), ShouldBeNil)
+		So(c.idnMode(), ShouldEqual, idnBlock)
+		So(c.idnBrands(), ShouldResemble, []string{"paypal.com"})
+		So(c.tree[domains].exc, ShouldResemble, []string{"xn--bcher-kva.de", "xn--pypal-4ve.com"})
+
+		for _, iface := range []IFace{ExDmObj, PreDObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		act, err := ioutil.ReadFile(dir + "/domains.whitelisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server=/xn--bcher-kva.de/#\n")
+
+		act, err = ioutil.ReadFile(dir + "/domains.blacklisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/xn--e1afmkfd.xn--p1ai/0.0.0.0\naddress=/xn--pple-43d.com/0.0.0.0\n")
+
+		Convey("Testing flag() in flag mode", func() {
+			c.idn.action = idnFlag
+			s := &source{Env: c.Env, name: "test", nType: excDomn}
+			So(s.flag([]byte("xn--pypal-4ve.com")), ShouldBeFalse)
+			So(s.homographs, ShouldResemble, []string{"xn--pypal-4ve.com [pаypal.com] (confusable with paypal.com)"})
+		})
+	})
+}
+
+var idnCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	idn-action block
+	idn-protect PayPal.com
+	domains {
+		exclude Bücher.de
+		exclude pаypal.com
+		include пример.рф
+		include аpple.com
+	}
+}`
@@ -0,0 +1,90 @@
+package edgeos
+
+import (
+	"sort"
+	"sync"
+)
+
+// record is a blacklist entry kept by a source
+type record struct {
+	also  []string // other sources that listed it
+	desc  string
+	ip    string
+	ip6   string
+	mode  string
+	nType ntype
+	src   string
+}
+
+// index collects the merged, whitelisted entries kept by every source, for exports
+// that need the whole result rather than one file per source
+type index struct {
+	*sync.RWMutex
+	recs map[string]record
+}
+
+func newIndex() *index {
+	return &index{RWMutex: &sync.RWMutex{}, recs: make(map[string]record)}
+}
+
+// indexOn creates the entry index on first use
+func (c *Config) indexOn() {
+	if c.idx == nil {
+		c.idx = newIndex()
+	}
+}
+
+// add records fqdn as kept by source s; it's a no-op unless an export has enabled the index
+func (x *index) add(fqdn []byte, s *source) {
+	if x == nil {
+		return
+	}
+	x.Lock()
+	x.recs[string(fqdn)] = record{desc: s.desc, ip: s.ip, ip6: s.ip6, mode: s.mode, nType: s.nType, src: s.name}
+	x.Unlock()
+}
+
+// also records that source s listed fqdn too, after another source had already blocked it
+func (x *index) also(fqdn []byte, s *source) {
+	if x == nil {
+		return
+	}
+	if allow, _ := exportType(s.nType); allow {
+		return
+	}
+	x.Lock()
+	defer x.Unlock()
+	r, ok := x.recs[string(fqdn)]
+	if allow, _ := exportType(r.nType); !ok || allow || r.src == s.name {
+		return
+	}
+	for _, n := range r.also {
+		if n == s.name {
+			return
+		}
+	}
+	r.also = append(r.also, s.name)
+	x.recs[string(fqdn)] = r
+}
+
+// names returns the indexed names in lexicographical order
+func (x *index) names() (n []string) {
+	if x == nil {
+		return n
+	}
+	x.RLock()
+	for k := range x.recs {
+		n = append(n, k)
+	}
+	x.RUnlock()
+	sort.Strings(n)
+	return n
+}
+
+// get returns name's record
+func (x *index) get(name string) (record, bool) {
+	x.RLock()
+	defer x.RUnlock()
+	r, ok := x.recs[name]
+	return r, ok
+}
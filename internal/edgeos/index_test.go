@@ -0,0 +1,52 @@
+package edgeos
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIndex(t *testing.T) {
+	Convey("Testing index", t, func() {
+		var nilIndex *index
+		So(func() { nilIndex.add([]byte("ads.com"), &source{}) }, ShouldNotPanic)
+		So(nilIndex.names(), ShouldBeNil)
+
+		x := newIndex()
+		x.add([]byte("trk.foo.com"), &source{ip: "192.168.1.1", nType: preHost, name: "includes"})
+		x.add([]byte("ads.com"), &source{ip: "0.0.0.0", nType: domn, name: "malc0de"})
+		So(x.names(), ShouldResemble, []string{"ads.com", "trk.foo.com"})
+
+		r, ok := x.get("ads.com")
+		So(ok, ShouldBeTrue)
+		So(r, ShouldResemble, record{ip: "0.0.0.0", nType: domn, src: "malc0de"})
+
+		_, ok = x.get("foo.com")
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestIndexAlso(t *testing.T) {
+	Convey("Testing index.also()", t, func() {
+		var nilIndex *index
+		So(func() { nilIndex.also([]byte("ads.com"), &source{}) }, ShouldNotPanic)
+
+		x := newIndex()
+		x.add([]byte("ads.com"), &source{nType: domn, name: "malc0de"})
+		x.add([]byte("good.com"), &source{nType: excDomn, name: ExcDomns})
+
+		x.also([]byte("ads.com"), &source{nType: domn, name: "malc0de"})
+		x.also([]byte("ads.com"), &source{nType: host, name: "yoyo"})
+		x.also([]byte("ads.com"), &source{nType: host, name: "yoyo"})
+		x.also([]byte("ads.com"), &source{nType: excHost, name: ExcHosts})
+		x.also([]byte("good.com"), &source{nType: domn, name: "malc0de"})
+		x.also([]byte("foo.com"), &source{nType: domn, name: "malc0de"})
+
+		r, _ := x.get("ads.com")
+		So(r.also, ShouldResemble, []string{"yoyo"})
+		r, _ = x.get("good.com")
+		So(r.also, ShouldBeNil)
+		_, ok := x.get("foo.com")
+		So(ok, ShouldBeFalse)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"strings"
@@ -124,6 +125,16 @@ func (c *CFGcli) read() io.Reader {
 	return bytes.NewReader(b)
 }
 
+// Snapshot reads the configuration r loads, returning a loader that replays it, so a daemon only re-reads
+// the EdgeOS configuration when it's asked to
+func Snapshot(r ConfLoader) (*CFGstatic, error) {
+	b, err := ioutil.ReadAll(r.read())
+	if err != nil {
+		return nil, err
+	}
+	return &CFGstatic{Cfg: string(b)}, nil
+}
+
 // read returns an EdgeOS config file io.Reader
 func (c *CFGstatic) read() io.Reader {
 	return strings.NewReader(c.Cfg)
@@ -136,7 +147,7 @@ func (b *bList) writeFile() error {
 		w   *os.File
 	)
 
-	if b.size == 0 {
+	if b.size == 0 || b.r == nil {
 		return nil
 	}
 
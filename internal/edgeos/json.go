@@ -96,6 +96,8 @@ func getJSONsrcArray(c *cfgJSON) string {
 		js = fmt.Sprintf("%s%s%q: %q,\n", js, tabs(ȹ), disabled, booltoStr(o.disabled))
 		js = is(ȹ, js, "description", o.desc)
 		js = is(ȹ, js, "ip", o.ip)
+		js = is(ȹ, js, "ipv6", o.ip6)
+		js = is(ȹ, js, blockMode, o.mode)
 		js = is(ȹ, js, "prefix", o.prefix)
 		js = is(ȹ, js, files, o.file)
 		js = is(ȹ, js, urls, o.url)
@@ -0,0 +1,177 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// output-layout leaf and values
+const (
+	layout       = "output-layout"
+	consolidated = "consolidated"
+	perArea      = "per-area"
+	perSource    = "per-source"
+	single       = "single"
+)
+
+// layoutLabel sets the blacklist node's output-layout leaf; consolidated layouts need the entry index
+func (c *Config) layoutLabel(val string) {
+	switch val {
+	case perArea, single:
+		c.indexOn()
+		c.layout = val
+	case perSource:
+		c.layout = ""
+	default:
+		if c.Log != nil {
+			c.Log.Warningf("Ignoring invalid %s %q, using %s", layout, val, perSource)
+		}
+	}
+}
+
+// consolidated returns true if sources share per-area or single files rather than writing their own
+func (e *Env) consolidated() bool {
+	return e.layout == perArea || e.layout == single
+}
+
+// fileArea returns the area whose files hold the source's entries
+func (s *source) fileArea() string {
+	switch s.nType {
+	case excDomn, preDomn:
+		return domains
+	case excHost, preHost:
+		return hosts
+	case excRoot, preRoot:
+		return roots
+	}
+	return typeInt(s.nType)
+}
+
+// sharedFile returns the consolidated file that holds the source's entries
+func (s *source) sharedFile() string {
+	if s.layout == single {
+		return fmt.Sprintf(s.FnFmt, s.Dir, all, consolidated, s.Ext)
+	}
+	return fmt.Sprintf(s.FnFmt, s.Dir, s.fileArea(), consolidated, s.Ext)
+}
+
+// render returns l in the backend's format, or nil if the source's entries go to a consolidated file instead
+func (s *source) render(l *list) io.Reader {
+	if s.consolidated() {
+		return nil
+	}
+	return s.output().format(s, l)
+}
+
+// keptFile returns where a source's kept names are saved when they don't go to a file of its own;
+// dnsmasq skips conf-dir files that start with a dot
+func (s *source) keptFile() string {
+	return fmt.Sprintf(s.FnFmt, s.Dir, "."+typeInt(s.nType), s.name, "kept")
+}
+
+// keeps returns true if the source saves its kept names when they don't go to a file of its own, so a
+// later run can restore them if its guard trips, and -simulate can replay a URL source offline
+func (s *source) keeps() bool {
+	if s.ltype != urls {
+		return s.guarded()
+	}
+	switch s.nType {
+	case domn, host, root:
+		return true
+	}
+	return false
+}
+
+// publish returns the source's file, or if its names go to a consolidated file or the pdns script,
+// the names it kept
+func (s *source) publish(l *list, kept int) *bList {
+	r := s.render(l)
+	if r == nil && s.keeps() {
+		names := make(sort.StringSlice, 0, len(l.entry))
+		for k := range l.entry {
+			names = append(names, k+"\n")
+		}
+		names.Sort()
+		return &bList{file: s.keptFile(), r: strings.NewReader(strings.Join(names, "")), size: kept}
+	}
+	return &bList{file: s.filename(typeInt(s.nType)), r: r, size: kept}
+}
+
+// restore claims the names a tripped source kept when it was last published to a consolidated file,
+// so they stay in it rather than being dropped
+func (s *source) restore() {
+	if !s.consolidated() {
+		return
+	}
+	b, err := ioutil.ReadFile(s.keptFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.Log.Warningf("%s: cannot restore its previous entries: %v", s.name, err)
+		}
+		return
+	}
+	l := &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	for _, k := range strings.Fields(string(b)) {
+		l.set([]byte(k))
+	}
+	s.commit(l, nil)
+	s.Log.Infof("%s: restored %d previous entries", s.name, len(l.entry))
+}
+
+// shared holds a consolidated file's entries and the number contributed by each source
+type shared struct {
+	lines []string
+	count map[string]int
+}
+
+// consolidate writes the indexed entries to one sorted file per area, or a single file, each headed by
+// a comment listing the contributing sources and their counts
+func (c *Config) consolidate() error {
+	if !c.consolidated() {
+		return nil
+	}
+
+	var (
+		b     = c.output()
+		files = make(map[string]*shared)
+	)
+
+	for _, name := range c.idx.names() {
+		r, _ := c.idx.get(name)
+		s := &source{Env: c.Env, ip: r.ip, ip6: r.ip6, mode: r.mode, name: r.src, nType: r.nType}
+		line := b.entry(s, name)
+		if line == "" {
+			continue
+		}
+		f := s.sharedFile()
+		if files[f] == nil {
+			files[f] = &shared{count: make(map[string]int)}
+		}
+		files[f].lines = append(files[f].lines, line)
+		files[f].count[r.src]++
+	}
+
+	for f, x := range files {
+		bl := &bList{file: f, r: strings.NewReader(x.header() + b.preamble() + strings.Join(x.lines, "")), size: len(x.lines)}
+		if err := bl.writeFile(); err != nil {
+			return err
+		}
+		c.Log.Infof("Wrote %d consolidated entries to %s", len(x.lines), f)
+	}
+	return nil
+}
+
+// header returns the comment lines naming the file's contributing sources and counts
+func (x *shared) header() string {
+	var srcs []string
+	for k, v := range x.count {
+		srcs = append(srcs, fmt.Sprintf("%s (%d)", k, v))
+	}
+	sort.Strings(srcs)
+	return fmt.Sprintf("# %d entries from sources: %s\n", len(x.lines), strings.Join(srcs, ", "))
+}
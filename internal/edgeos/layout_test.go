@@ -0,0 +1,107 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLayoutLabel(t *testing.T) {
+	Convey("Testing layoutLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		So(c.consolidated(), ShouldBeFalse)
+
+		c.layoutLabel(single)
+		So(c.consolidated(), ShouldBeTrue)
+		So(c.idx, ShouldNotBeNil)
+
+		c.layoutLabel("bogus")
+		So(c.layout, ShouldEqual, single)
+
+		c.layoutLabel(perSource)
+		So(c.consolidated(), ShouldBeFalse)
+	})
+}
+
+func TestConsolidate(t *testing.T) {
+	Convey("Testing consolidate()", t, func() {
+		c, dir := newTestConfig(WCard(Wildcard{Node: "*s", Name: "*"}))
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: layoutCfg}), ShouldBeNil)
+		So(c.layout, ShouldEqual, perArea)
+
+		stale := dir + "/domains.pre-configured.blacklist.conf"
+		So(ioutil.WriteFile(stale, []byte("address=/old.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(c.GetAll().Files().Remove(), ShouldBeNil)
+		_, err := os.Stat(stale)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		for _, iface := range []IFace{PreDObj, PreHObj, ExDmObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+		So(c.Finish(), ShouldBeNil)
+
+		files, err := filepath.Glob(dir + "/*")
+		So(err, ShouldBeNil)
+		So(files, ShouldResemble, []string{
+			dir + "/domains.consolidated.blacklist.conf",
+			dir + "/hosts.consolidated.blacklist.conf",
+		})
+
+		act, err := ioutil.ReadFile(dir + "/domains.consolidated.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, `# 3 entries from sources: blacklisted-subdomains (2), whitelisted-subdomains (1)
+address=/ads.com/0.0.0.0
+address=/bad.com/0.0.0.0
+server=/good.ads.com/#
+`)
+
+		Convey("Switching to a single file leaves no per-area files", func() {
+			c.layout = single
+			So(c.GetAll().Files().Remove(), ShouldBeNil)
+			So(c.Finish(), ShouldBeNil)
+
+			files, err := filepath.Glob(dir + "/*")
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []string{dir + "/all.consolidated.blacklist.conf"})
+
+			act, err := ioutil.ReadFile(files[0])
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, `# 4 entries from sources: blacklisted-servers (1), blacklisted-subdomains (2), whitelisted-subdomains (1)
+address=/ads.com/0.0.0.0
+address=/bad.com/0.0.0.0
+server=/good.ads.com/#
+address=/trk.foo.com/192.168.1.1
+`)
+
+			Convey("And switching back to per-source removes it", func() {
+				c.layout = ""
+				So(c.GetAll().Files().Remove(), ShouldBeNil)
+				files, err := filepath.Glob(dir + "/*")
+				So(err, ShouldBeNil)
+				So(files, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+var layoutCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	output-layout per-area
+	domains {
+		exclude good.ads.com
+		include ads.com
+		include bad.com
+	}
+	hosts {
+		dns-redirect-ip 192.168.1.1
+		include trk.foo.com
+	}
+}`
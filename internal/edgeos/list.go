@@ -33,6 +33,24 @@ func (l *list) merge(a *list) {
 	l.Unlock()
 }
 
+// claim adds a's entries, removing from a and returning those l already has
+func (l *list) claim(a *list) (taken []string) {
+	l.Lock()
+	a.Lock()
+	for k := range a.entry {
+		if _, ok := l.entry[k]; ok {
+			delete(a.entry, k)
+			taken = append(taken, k)
+			continue
+		}
+		l.entry[k] = struct{}{}
+	}
+	a.Unlock()
+	l.Unlock()
+	sort.Strings(taken)
+	return taken
+}
+
 // set adds a list entry map member
 func (l *list) set(k []byte) {
 	l.Lock()
@@ -53,6 +71,17 @@ func (l *list) String() string {
 	return strings.Join(ls, "")
 }
 
+// subKey returns the part or all of the key that matches
+func (l *list) subKey(b []byte) (string, bool) {
+	d := bytes.Split(b, []byte("."))
+	for i := range Iter(len(d) - 1) {
+		if k := bytes.Join(d[i:], []byte(".")); l.keyExists(k) {
+			return string(k), true
+		}
+	}
+	return string(b), l.keyExists(b)
+}
+
 // subKeyExists returns true if part or all of the key matches
 func (l *list) subKeyExists(b []byte) bool {
 	d := bytes.Split(b, []byte("."))
@@ -0,0 +1,446 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/britannic/blacklist/internal/fqdn"
+)
+
+const metricsFile = "metrics-file"
+
+// SourceState keeps each source's failed run count and last success time across a daemon's runs, and
+// continues them from the metrics-file a previous run wrote, so blacklist_source_errors_total only
+// ever increases
+type SourceState struct {
+	*sync.Mutex
+	errors  map[string]int
+	seeded  bool
+	success map[string]time.Time
+}
+
+// NewSourceState returns an empty SourceState
+func NewSourceState() *SourceState {
+	return &SourceState{Mutex: &sync.Mutex{}, errors: make(map[string]int), success: make(map[string]time.Time)}
+}
+
+// done records whether the source with key k failed
+func (x *SourceState) done(k string, failed bool) {
+	if x == nil {
+		return
+	}
+	x.Lock()
+	if failed {
+		x.errors[k]++
+	} else {
+		x.success[k] = time.Now()
+	}
+	x.Unlock()
+}
+
+// get returns the source with key k's failed run count and last success time
+func (x *SourceState) get(k string) (int, time.Time) {
+	if x == nil {
+		return 0, time.Time{}
+	}
+	x.Lock()
+	defer x.Unlock()
+	return x.errors[k], x.success[k]
+}
+
+// metricLine matches a per-source sample in a metrics-file
+var metricLine = regexp.MustCompile(`^(blacklist_source_errors_total|blacklist_source_last_success_timestamp_seconds)\{node="((?:[^"\\]|\\.)*)",source="((?:[^"\\]|\\.)*)"\} (\S+)$`)
+
+// seed adds the failed run counts, and any earlier success times, in the metrics-file a previous run
+// wrote, the first time it's called
+func (x *SourceState) seed(file string) {
+	if x == nil {
+		return
+	}
+	x.Lock()
+	defer x.Unlock()
+	if x.seeded {
+		return
+	}
+	x.seeded = true
+
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	b := bufio.NewScanner(f)
+	for b.Scan() {
+		v := metricLine.FindStringSubmatch(b.Text())
+		if v == nil {
+			continue
+		}
+		node, err1 := strconv.Unquote(`"` + v[2] + `"`)
+		name, err2 := strconv.Unquote(`"` + v[3] + `"`)
+		n, err3 := strconv.ParseFloat(v[4], 64)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+
+		k := node + "/" + name
+		switch v[1] {
+		case "blacklist_source_errors_total":
+			x.errors[k] += int(n)
+		default:
+			if _, ok := x.success[k]; !ok && n > 0 {
+				x.success[k] = time.Unix(0, int64(n*1e9))
+			}
+		}
+	}
+}
+
+// metrics collects Prometheus gauges for each source and the last run
+type metrics struct {
+	*sync.RWMutex
+	anoms     []Anomaly
+	blocked   int32
+	conflicts []Conflict // forwarded domains the blacklist blocks
+	duration  time.Duration
+	env       *Env           // holds the per-source counts and the SourceState
+	excl      map[string]int // drops by excluded domain
+	file      string
+	finished  time.Time
+	reload    *ReloadReport
+	result    float64
+	src       map[string]*srcMetrics
+	start     time.Time
+}
+
+// srcMetrics are a source's gauges from its last run; its extracted, kept and dropped counts are the
+// ctr's, and its error count and last success time are the SourceState's
+type srcMetrics struct {
+	block   bool // its kept entries are blocked, rather than excluded, routed or forwarded
+	bytes   int
+	cached  bool // its download was reused, as its refresh-interval hadn't passed
+	errs    []string
+	fetch   time.Duration
+	file    string
+	guard   string // why a shrink guard stopped it being published
+	key     string // its ctr key
+	name    string
+	node    string
+	noData  bool
+	rejects fqdn.Report // its invalid entries, with their line numbers and reasons
+	status  int
+	url     string
+	warns   []string
+}
+
+func newMetrics(file string, e *Env) *metrics {
+	if e.state == nil {
+		e.state = NewSourceState()
+	}
+	return &metrics{
+		RWMutex: &sync.RWMutex{},
+		env:     e,
+		excl:    make(map[string]int),
+		file:    file,
+		src:     make(map[string]*srcMetrics),
+		start:   time.Now(),
+	}
+}
+
+// metricsLabel sets the blacklist node's metrics-file leaf
+func (c *Config) metricsLabel(val string) {
+	c.metricsOn()
+	c.metrics.file = val
+}
+
+// metricsOn creates the metrics collector on first use
+func (c *Config) metricsOn() {
+	if c.metrics == nil {
+		c.metrics = newMetrics("", c.Env)
+	}
+}
+
+// get returns the source's gauges, creating them if need be; callers hold the lock
+func (m *metrics) get(s *source) *srcMetrics {
+	k := s.area() + "/" + s.name
+	if m.src[k] == nil {
+		m.src[k] = &srcMetrics{file: s.file, key: statKey(s), name: s.name, node: s.area(), url: s.url}
+		switch s.nType {
+		case domn, host, root, preDomn, preHost, preRoot:
+			m.src[k].block = true
+		}
+	}
+	return m.src[k]
+}
+
+// fetched records the HTTP status, size and duration of a source download, and whether it was reused from
+// the FetchCache; it's a no-op unless metrics are on
+func (m *metrics) fetched(s *source, resp *http.Response, n int, d time.Duration, cached bool) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	x := m.get(s)
+	x.bytes, x.cached, x.fetch, x.noData = n, cached, d, n == 0
+	if resp != nil {
+		x.status = resp.StatusCode
+	}
+	m.Unlock()
+}
+
+// excluded records that an excluded domain, or a blocked parent domain, in dex dropped fqdn
+func (m *metrics) excluded(dex *list, fqdn []byte) {
+	if m == nil {
+		return
+	}
+	if k, ok := dex.subKey(fqdn); ok {
+		m.Lock()
+		m.excl[k]++
+		m.Unlock()
+	}
+}
+
+// warn records a warning logged for a source
+func (m *metrics) warn(s *source, msg string) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	x := m.get(s)
+	x.warns = append(x.warns, msg)
+	m.Unlock()
+}
+
+// done records whether a source was fetched, processed and written without error
+func (m *metrics) done(s *source, err error) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	x := m.get(s)
+	for _, e := range []error{s.err, err} {
+		if e != nil {
+			x.errs = append(x.errs, e.Error())
+		}
+	}
+	if x.noData && s.err == nil {
+		x.errs = append(x.errs, "no data returned")
+	}
+	m.env.state.done(x.node+"/"+x.name, len(x.errs) > 0)
+	m.Unlock()
+}
+
+// rejected records the source's invalid entries
+func (m *metrics) rejected(s *source, r fqdn.Report) {
+	if m == nil || r.Len() == 0 {
+		return
+	}
+	m.Lock()
+	m.get(s).rejects = r
+	m.Unlock()
+}
+
+// guarded records why a shrink guard stopped a source being published
+func (m *metrics) guarded(s *source, why string) {
+	if m == nil {
+		return
+	}
+	m.Lock()
+	x := m.get(s)
+	x.guard = why
+	x.warns = append(x.warns, why)
+	m.Unlock()
+}
+
+// reloaded records the outcome of the DNS backend reload
+func (m *metrics) reloaded(err error) {
+	if m == nil {
+		return
+	}
+	r := &ReloadReport{Success: err == nil}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	m.Lock()
+	m.reload = r
+	m.Unlock()
+}
+
+// gauge returns a boolean as a Prometheus 1 or 0
+func gauge(ok bool) float64 {
+	if ok {
+		return 1
+	}
+	return 0
+}
+
+// RunDone sends any failure notifications, publishes the run to the mqtt-broker, if there is one, records
+// the run's result, duration and blocked entry total, adds it to the history-file, if there is one, then
+// writes the metrics-file for node_exporter's textfile collector, if there is one
+func (c *Config) RunDone(ok bool) error {
+	nerr := c.notes.finish(ok)
+	if err := c.PublishMQTT(ok); err != nil {
+		nerr = err
+	}
+	m := c.metrics
+	if m == nil {
+		return nerr
+	}
+
+	m.Lock()
+	m.blocked = 0
+	for _, x := range m.src {
+		if x.block && x.guard == "" {
+			m.blocked += int32(m.counts(x).Kept)
+		}
+	}
+	m.conflicts = append([]Conflict{}, c.Conflicts()...)
+	m.finished = time.Now()
+	m.duration = m.finished.Sub(m.start)
+	m.result = gauge(ok)
+	m.Unlock()
+
+	err := c.recordHistory()
+	if m.file != "" {
+		c.state.seed(m.file)
+		if e := m.writeFile(); e != nil {
+			err = e
+		}
+	}
+	if err == nil {
+		err = nerr
+	}
+	return err
+}
+
+// writeFile writes the metrics to a temporary file and renames it, so the textfile collector
+// never reads a partial file
+func (m *metrics) writeFile() error {
+	tmp := filepath.Join(filepath.Dir(m.file), "."+filepath.Base(m.file)+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	m.write(w)
+	if err = w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, m.file)
+}
+
+// Metrics returns an http.Handler that serves the metrics in Prometheus exposition format
+func (c *Config) Metrics() http.Handler {
+	c.metricsOn()
+	m := c.metrics
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.write(w)
+	})
+}
+
+// counts returns the source's extracted, kept and dropped counts; callers hold the lock
+func (m *metrics) counts(x *srcMetrics) Stat {
+	return m.env.ctr.get(x.key)
+}
+
+// sample returns the source's gauges, counts, failed run count and last success time; callers hold the lock
+func (m *metrics) sample(x *srcMetrics) sample {
+	errors, success := m.env.state.get(x.node + "/" + x.name)
+	return sample{srcMetrics: x, Stat: m.counts(x), errors: errors, success: success}
+}
+
+// family is a Prometheus metric family
+type family struct {
+	help  string
+	name  string
+	typ   string
+	value func(x sample) float64
+}
+
+// sample is a source's gauges, counts, failed run count and last success time
+type sample struct {
+	*srcMetrics
+	Stat
+	errors  int
+	success time.Time
+}
+
+var srcFamilies = []family{
+	{name: "blacklist_source_extracted_entries", typ: "gauge", help: "Entries found in the source by the last run.",
+		value: func(x sample) float64 { return float64(x.Extracted) }},
+	{name: "blacklist_source_kept_entries", typ: "gauge", help: "Entries kept from the source by the last run.",
+		value: func(x sample) float64 { return float64(x.Kept) }},
+	{name: "blacklist_source_dropped_entries", typ: "gauge", help: "Entries dropped from the source as excluded, duplicated or refused by the last run.",
+		value: func(x sample) float64 { return float64(x.Dropped) }},
+	{name: "blacklist_source_fetched_bytes", typ: "gauge", help: "Bytes downloaded from the source url by the last run.",
+		value: func(x sample) float64 { return float64(x.bytes) }},
+	{name: "blacklist_source_fetch_duration_seconds", typ: "gauge", help: "Time taken to download the source url by the last run.",
+		value: func(x sample) float64 { return x.fetch.Seconds() }},
+	{name: "blacklist_source_last_success_timestamp_seconds", typ: "gauge", help: "Unix time the source was last fetched and written without error.",
+		value: func(x sample) float64 { return unixTime(x.success) }},
+	{name: "blacklist_source_errors_total", typ: "counter", help: "Runs that failed to fetch, process or write the source.",
+		value: func(x sample) float64 { return float64(x.errors) }},
+}
+
+// unixTime returns t in Unix seconds, or 0 if t is the zero time
+func unixTime(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.UnixNano()) / 1e9
+}
+
+// write writes the metrics in Prometheus text exposition format
+func (m *metrics) write(w io.Writer) {
+	m.RLock()
+	defer m.RUnlock()
+
+	var keys []string
+	for k := range m.src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, f := range srcFamilies {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		for _, k := range keys {
+			x := m.src[k]
+			fmt.Fprintf(w, "%s{node=\"%s\",source=\"%s\"} %v\n", f.name, escLabel(x.node), escLabel(x.name), f.value(m.sample(x)))
+		}
+	}
+
+	for _, g := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"blacklist_blocked_entries", "Entries blocked by the last run.", float64(m.blocked)},
+		{"blacklist_run_duration_seconds", "Time taken by the last run.", m.duration.Seconds()},
+		{"blacklist_last_run_success", "Whether the last run completed without errors.", m.result},
+		{"blacklist_last_run_timestamp_seconds", "Unix time the last run completed.", unixTime(m.finished)},
+		{"blacklist_dns_reload_success", "Whether the last run reloaded the DNS service without error.", gauge(m.reload != nil && m.reload.Success)},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", g.name, g.help, g.name, g.name, g.value)
+	}
+}
+
+// escLabel escapes a label value's backslashes, quotes and newlines
+func escLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,121 @@
+package edgeos
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Testing metrics", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.RunDone(true), ShouldBeNil)
+		So(c.metrics, ShouldBeNil)
+
+		So(ioutil.WriteFile(dir+"/malware.txt", []byte("bad.com\nworse.com\nads.com\n"), 0644), ShouldBeNil)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(metricsCfg, dir, dir, dir)}), ShouldBeNil)
+		So(c.metrics.file, ShouldEqual, dir+"/blacklist.prom")
+
+		for _, iface := range []IFace{PreDObj, FileObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			_ = c.ProcessContent(ct)
+		}
+		c.metrics.reloaded(errors.New("dnsmasq failed"))
+		So(c.RunDone(true), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(dir + "/blacklist.prom")
+		So(err, ShouldBeNil)
+		act := string(b)
+
+		for _, exp := range []string{
+			"# TYPE blacklist_source_kept_entries gauge\n",
+			`blacklist_source_extracted_entries{node="domains",source="malware"} 3`,
+			`blacklist_source_kept_entries{node="domains",source="malware"} 2`,
+			`blacklist_source_dropped_entries{node="domains",source="malware"} 1`,
+			`blacklist_source_kept_entries{node="domains",source="blacklisted-subdomains"} 1`,
+			`blacklist_source_errors_total{node="domains",source="malware"} 0`,
+			`blacklist_source_errors_total{node="domains",source="missing"} 1`,
+			`blacklist_source_last_success_timestamp_seconds{node="domains",source="missing"} 0`,
+			"# TYPE blacklist_source_errors_total counter\n",
+			"blacklist_blocked_entries 3\n",
+			"blacklist_last_run_success 1\n",
+			"blacklist_dns_reload_success 0\n",
+		} {
+			So(act, ShouldContainSubstring, exp)
+		}
+		So(act, ShouldNotContainSubstring, `blacklist_source_last_success_timestamp_seconds{node="domains",source="malware"} 0`)
+
+		_, err = os.Stat(dir + "/.blacklist.prom.tmp")
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		Convey("Testing blacklist_source_errors_total counts across runs", func() {
+			run := func(x *SourceState) string {
+				c := NewConfig(
+					Dir(dir),
+					Ext("blacklist.conf"),
+					FileNameFmt("%v/%v.%v.%v"),
+					Logger(newLog()),
+					Prefix("address=", "server="),
+					State(x),
+				)
+				So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(metricsCfg, dir, dir, dir)}), ShouldBeNil)
+				ct, err := c.NewContent(FileObj)
+				So(err, ShouldBeNil)
+				_ = c.ProcessContent(ct)
+				So(c.RunDone(true), ShouldBeNil)
+
+				b, err := ioutil.ReadFile(dir + "/blacklist.prom")
+				So(err, ShouldBeNil)
+				return string(b)
+			}
+
+			// a daemon's runs share a SourceState
+			x := NewSourceState()
+			So(run(x), ShouldContainSubstring, `blacklist_source_errors_total{node="domains",source="missing"} 2`)
+			act := run(x)
+			So(act, ShouldContainSubstring, `blacklist_source_errors_total{node="domains",source="missing"} 3`)
+			So(act, ShouldContainSubstring, `blacklist_source_errors_total{node="domains",source="malware"} 0`)
+
+			// a new process continues from the metrics-file
+			So(run(NewSourceState()), ShouldContainSubstring, `blacklist_source_errors_total{node="domains",source="missing"} 4`)
+		})
+
+		Convey("Testing Metrics() handler", func() {
+			c.metrics.reloaded(nil)
+			w := httptest.NewRecorder()
+			c.Metrics().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+			So(w.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+			So(w.Body.String(), ShouldContainSubstring, "blacklist_dns_reload_success 1\n")
+			So(w.Body.String(), ShouldContainSubstring, `blacklist_source_kept_entries{node="domains",source="malware"} 2`)
+		})
+	})
+}
+
+func TestEscLabel(t *testing.T) {
+	Convey("Testing escLabel()", t, func() {
+		So(escLabel(`my "list"`+"\n"+`c:\lists`), ShouldEqual, `my \"list\"\nc:\\lists`)
+	})
+}
+
+var metricsCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	metrics-file %s/blacklist.prom
+	domains {
+		include ads.com
+		source malware {
+			file %s/malware.txt
+		}
+		source missing {
+			file %s/missing.txt
+		}
+	}
+}`
@@ -0,0 +1,611 @@
+package edgeos
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT leaves and their defaults
+const (
+	mqttBroker       = "mqtt-broker"
+	mqttClientID     = "mqtt-client-id"
+	mqttDiscovery    = "mqtt-discovery-prefix"
+	mqttPassword     = "mqtt-password"
+	mqttTopic        = "mqtt-topic"
+	mqttUsername     = "mqtt-username"
+	defMQTTDiscovery = "homeassistant"
+	defMQTTKeepAlive = 60 * time.Second
+	defMQTTPause     = 60 // minutes the Home Assistant switch pauses blocking for
+	defMQTTPauseFile = "/var/run/blacklist.pause"
+)
+
+// MQTT commands, published to the command topic
+const (
+	cmdPause  = "pause"
+	cmdResume = "resume"
+	cmdUpdate = "update-now"
+)
+
+// MQTT 3.1.1 control packet types, in the fixed header's high nibble, with their required flags
+const (
+	pktConnect    = 1 << 4
+	pktConnack    = 2 << 4
+	pktPublish    = 3 << 4
+	pktSubscribe  = 8<<4 | 2
+	pktSuback     = 9 << 4
+	pktPingreq    = 12 << 4
+	pktPingresp   = 13 << 4
+	pktDisconnect = 14 << 4
+)
+
+// mqttRefused are the CONNACK return codes' reasons
+var mqttRefused = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// mqttConf is the blacklist node's MQTT configuration
+type mqttConf struct {
+	broker    string
+	discovery string
+	id        string
+	keepAlive time.Duration
+	password  string
+	pause     string // file holding the time a pause ends
+	topic     string
+	username  string
+}
+
+// mqttOn creates the MQTT configuration on first use
+func (c *Config) mqttOn() {
+	if c.mqtt == nil {
+		host, _ := os.Hostname()
+		c.mqtt = &mqttConf{
+			discovery: defMQTTDiscovery,
+			id:        "blacklist-" + host,
+			keepAlive: defMQTTKeepAlive,
+			pause:     defMQTTPauseFile,
+			topic:     "blacklist/" + host,
+		}
+	}
+}
+
+// mqttLabel sets the blacklist node's mqtt leaves
+func (c *Config) mqttLabel(leaf, val string) {
+	c.mqttOn()
+	m := c.mqtt
+	switch leaf {
+	case mqttBroker:
+		m.broker = val
+	case mqttClientID:
+		m.id = val
+	case mqttDiscovery:
+		m.discovery = strings.Trim(val, "/")
+	case mqttPassword:
+		m.password = val
+	case mqttTopic:
+		m.topic = strings.Trim(val, "/")
+	case mqttUsername:
+		m.username = val
+	}
+}
+
+// mqttMsg is a published message
+type mqttMsg struct {
+	payload  []byte
+	retained bool
+	topic    string
+}
+
+// mqttClient is a minimal MQTT 3.1.1 client, publishing and subscribing at QoS 0
+type mqttClient struct {
+	*sync.Mutex // serializes writes
+	conn        net.Conn
+	r           *bufio.Reader
+	wait        time.Duration // how long next waits for a packet, if set
+}
+
+// dial connects to the mqtt-broker as client id, with a retained offline will on the availability topic if will is set
+func (m *mqttConf) dial(id string, will bool, timeout time.Duration) (*mqttClient, error) {
+	u, err := url.Parse(m.broker)
+	if err != nil {
+		return nil, err
+	}
+
+	var secure bool
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		secure = true
+	default:
+		return nil, fmt.Errorf("%s %s: unsupported scheme %q, use mqtt, tcp, mqtts, ssl or tls", mqttBroker, m.broker, u.Scheme)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if secure {
+			port = "8883"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	var (
+		conn net.Conn
+		d    = &net.Dialer{Timeout: timeout}
+	)
+	if secure {
+		conn, err = tls.DialWithDialer(d, "tcp", addr, &tls.Config{ServerName: u.Hostname()})
+	} else {
+		conn, err = d.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cl := &mqttClient{Mutex: &sync.Mutex{}, conn: conn, r: bufio.NewReader(conn)}
+	if err = cl.connect(m, id, will, timeout); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return cl, nil
+}
+
+// mqttString appends s to b as an MQTT length prefixed string
+func mqttString(b []byte, s string) []byte {
+	return append(append(b, byte(len(s)>>8), byte(len(s))), s...)
+}
+
+// connect sends CONNECT, with a clean session, and waits for the broker to accept it
+func (cl *mqttClient) connect(m *mqttConf, id string, will bool, timeout time.Duration) error {
+	flags := byte(0x02) // clean session
+	if will {
+		flags |= 0x04 | 0x20 // retained will at QoS 0
+	}
+	if m.username != "" {
+		flags |= 0x80
+		if m.password != "" {
+			flags |= 0x40
+		}
+	}
+
+	ka := int(m.keepAlive / time.Second)
+	body := append(mqttString(nil, "MQTT"), 4, flags, byte(ka>>8), byte(ka))
+	body = mqttString(body, id)
+	if will {
+		body = mqttString(mqttString(body, m.topic+"/availability"), "offline")
+	}
+	if m.username != "" {
+		body = mqttString(body, m.username)
+		if m.password != "" {
+			body = mqttString(body, m.password)
+		}
+	}
+
+	if timeout > 0 {
+		cl.conn.SetDeadline(time.Now().Add(timeout))
+		defer cl.conn.SetDeadline(time.Time{})
+	}
+	if err := cl.write(pktConnect, body); err != nil {
+		return err
+	}
+	h, b, err := cl.read()
+	switch {
+	case err != nil:
+		return err
+	case h&0xf0 != pktConnack || len(b) != 2:
+		return fmt.Errorf("%s %s didn't acknowledge the connection", mqttBroker, m.broker)
+	case b[1] != 0:
+		why, ok := mqttRefused[b[1]]
+		if !ok {
+			why = fmt.Sprintf("return code %d", b[1])
+		}
+		return fmt.Errorf("%s %s refused the connection: %s", mqttBroker, m.broker, why)
+	}
+	return nil
+}
+
+// write sends a packet
+func (cl *mqttClient) write(header byte, body []byte) error {
+	pkt := []byte{header}
+	for n := len(body); ; {
+		d := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			d |= 0x80
+		}
+		pkt = append(pkt, d)
+		if n == 0 {
+			break
+		}
+	}
+
+	cl.Lock()
+	defer cl.Unlock()
+	_, err := cl.conn.Write(append(pkt, body...))
+	return err
+}
+
+// read returns the next packet's fixed header byte and its body
+func (cl *mqttClient) read() (byte, []byte, error) {
+	h, err := cl.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var n, shift uint
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed MQTT packet length")
+		}
+		d, err := cl.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n |= uint(d&0x7f) << shift
+		if d&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+
+	b := make([]byte, n)
+	_, err = io.ReadFull(cl.r, b)
+	return h, b, err
+}
+
+// publish sends a QoS 0 message
+func (cl *mqttClient) publish(topic string, payload []byte, retain bool) error {
+	h := byte(pktPublish)
+	if retain {
+		h |= 0x01
+	}
+	return cl.write(h, append(mqttString(nil, topic), payload...))
+}
+
+// subscribe asks for topic's messages at QoS 0; next reports whether the broker refused
+func (cl *mqttClient) subscribe(topic string) error {
+	return cl.write(pktSubscribe, append(mqttString([]byte{0, 1}, topic), 0))
+}
+
+// next returns the next message published to a subscribed topic, skipping other packets; with wait
+// set, it fails if no packet, not even a ping response, arrives in time
+func (cl *mqttClient) next() (mqttMsg, error) {
+	for {
+		if cl.wait > 0 {
+			cl.conn.SetReadDeadline(time.Now().Add(cl.wait))
+		}
+		h, b, err := cl.read()
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return mqttMsg{}, fmt.Errorf("%s stopped answering pings for %v", mqttBroker, cl.wait)
+			}
+			return mqttMsg{}, err
+		}
+
+		switch h & 0xf0 {
+		case pktSuback:
+			if len(b) == 3 && b[2] == 0x80 {
+				return mqttMsg{}, errors.New("MQTT broker refused the command topic subscription")
+			}
+		case pktPublish:
+			if len(b) < 2 {
+				return mqttMsg{}, errors.New("malformed MQTT publish packet")
+			}
+			n := int(b[0])<<8 | int(b[1])
+			i := 2 + n
+			if h&0x06 != 0 {
+				i += 2 // QoS 1 or 2 packet identifier
+			}
+			if i > len(b) {
+				return mqttMsg{}, errors.New("malformed MQTT publish packet")
+			}
+			return mqttMsg{payload: b[i:], retained: h&0x01 != 0, topic: string(b[2 : 2+n])}, nil
+		}
+	}
+}
+
+// close disconnects from the broker
+func (cl *mqttClient) close() error {
+	cl.write(pktDisconnect, nil)
+	return cl.conn.Close()
+}
+
+// MQTTEnabled returns true if an mqtt-broker is configured
+func (c *Config) MQTTEnabled() bool {
+	return c.mqtt != nil && c.mqtt.broker != ""
+}
+
+// ServeMQTT connects to the mqtt-broker, marks the blacklist online and applies the update-now,
+// pause <minutes> and resume commands published to its command topic, by calling update to run a
+// blacklist update, until the connection fails or the broker stops answering pings for one and a
+// half keep-alive periods. update runs on ServeMQTT's goroutine, so later commands wait for it to
+// return, while the pings carry on
+func (c *Config) ServeMQTT(update func()) error {
+	m := c.mqtt
+	if !c.MQTTEnabled() {
+		return fmt.Errorf("no %s configured", mqttBroker)
+	}
+
+	cl, err := m.dial(m.id, true, c.Timeout)
+	if err != nil {
+		return err
+	}
+	defer cl.close()
+	cl.wait = m.keepAlive * 3 / 2 // pings go every half keep-alive, so their responses arrive well within it
+
+	if err = cl.publish(m.topic+"/availability", []byte("online"), true); err != nil {
+		return err
+	}
+	if err = cl.subscribe(m.topic + "/command"); err != nil {
+		return err
+	}
+
+	var (
+		done = make(chan struct{})
+		errs = make(chan error, 2)
+		msgs = make(chan mqttMsg)
+	)
+	defer close(done)
+
+	go func() {
+		for {
+			msg, err := cl.next()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// ping from its own goroutine, so a long update doesn't let the keep alive lapse
+	go func() {
+		t := time.NewTicker(m.keepAlive / 2)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := cl.write(pktPingreq, nil); err != nil {
+					errs <- err
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var resume <-chan time.Time
+	if until, ok := c.Paused(); ok {
+		resume = time.After(time.Until(until))
+	}
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case <-resume:
+			resume = nil
+			c.Log.Noticef("Pause ended, resuming blocking")
+			if err := c.Resume(); err != nil {
+				c.Log.Errorf("%v", err)
+			}
+			update()
+		case msg := <-msgs:
+			if msg.retained {
+				c.Log.Warningf("Ignoring retained MQTT command %q on %s", msg.payload, msg.topic)
+				continue
+			}
+			f := strings.Fields(string(msg.payload))
+			if len(f) == 0 {
+				continue
+			}
+			c.Log.Noticef("Received MQTT command %q", msg.payload)
+
+			switch f[0] {
+			case cmdUpdate:
+				update()
+			case cmdPause:
+				n := defMQTTPause
+				if len(f) > 1 {
+					if n, err = strconv.Atoi(f[1]); err != nil || n <= 0 {
+						c.Log.Warningf("Ignoring MQTT command %q, minutes must be a positive number", msg.payload)
+						continue
+					}
+				}
+				until, err := c.Pause(time.Duration(n) * time.Minute)
+				if err != nil {
+					c.Log.Errorf("%v", err)
+					continue
+				}
+				resume = time.After(time.Until(until))
+				update()
+			case cmdResume:
+				resume = nil
+				if err := c.Resume(); err != nil {
+					c.Log.Errorf("%v", err)
+				}
+				update()
+			default:
+				c.Log.Warningf("Ignoring unknown MQTT command %q, use %s, %s <minutes> or %s", msg.payload, cmdUpdate, cmdPause, cmdResume)
+			}
+		}
+	}
+}
+
+// Pause stops blocking for d, by recording when the pause ends; updates leave the blacklist disabled until then
+func (c *Config) Pause(d time.Duration) (time.Time, error) {
+	c.mqttOn()
+	until := time.Now().Add(d).Round(time.Second)
+	if err := ioutil.WriteFile(c.mqtt.pause, []byte(until.Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return until, fmt.Errorf("cannot pause blocking: %v", err)
+	}
+	return until, nil
+}
+
+// Resume ends a pause
+func (c *Config) Resume() error {
+	if c.mqtt == nil {
+		return nil
+	}
+	if err := os.Remove(c.mqtt.pause); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot resume blocking: %v", err)
+	}
+	return nil
+}
+
+// Paused returns when the current pause ends, if blocking is paused
+func (c *Config) Paused() (time.Time, bool) {
+	if c.mqtt == nil {
+		return time.Time{}, false
+	}
+	b, err := ioutil.ReadFile(c.mqtt.pause)
+	if err != nil {
+		return time.Time{}, false
+	}
+	until, err := time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+	if err != nil || !time.Now().Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// mqttState is the run result published, retained, to the state topic
+type mqttState struct {
+	Result      string    `json:"result"` // success or failure
+	Blocked     int       `json:"blocked"`
+	Paused      bool      `json:"paused"`
+	PausedUntil string    `json:"paused_until,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// mqttSource is a source's counts published, retained, to its topic under the state topic
+type mqttSource struct {
+	Area      string `json:"area"`
+	Source    string `json:"source"`
+	Extracted int    `json:"extracted"`
+	Kept      int    `json:"kept"`
+	Dropped   int    `json:"dropped"`
+}
+
+// objectID strips the characters Home Assistant doesn't allow in discovery node and object IDs
+var objectID = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// PublishMQTT publishes the run's result and each source's counts, with Home Assistant discovery
+// payloads for them and the pause switch and update button, as retained messages; it's a no-op unless
+// an mqtt-broker is configured
+func (c *Config) PublishMQTT(ok bool) error {
+	m := c.mqtt
+	if m == nil || m.broker == "" {
+		return nil
+	}
+
+	cl, err := m.dial(m.id+"-run", false, c.Timeout)
+	if err != nil {
+		return fmt.Errorf("cannot publish to %s %s: %v", mqttBroker, m.broker, err)
+	}
+	defer cl.close()
+
+	for _, msg := range c.mqttMessages(ok) {
+		if err = cl.publish(msg.topic, msg.payload, true); err != nil {
+			return fmt.Errorf("cannot publish to %s %s: %v", mqttBroker, m.broker, err)
+		}
+	}
+	return nil
+}
+
+// mqttMessages returns the retained discovery, state and source messages for the run
+func (c *Config) mqttMessages(ok bool) []mqttMsg {
+	var (
+		m     = c.mqtt
+		msgs  []mqttMsg
+		node  = objectID.ReplaceAllString(m.id, "_")
+		state = mqttState{Result: "failure", Time: time.Now()}
+		srcs  = c.SourceStats()
+	)
+
+	add := func(topic string, v interface{}) {
+		b, _ := json.Marshal(v)
+		msgs = append(msgs, mqttMsg{payload: b, retained: true, topic: topic})
+	}
+
+	// discover adds a Home Assistant discovery payload for one of the blacklist device's entities
+	discover := func(component, object string, v map[string]interface{}) {
+		v["unique_id"] = node + "_" + object
+		v["availability_topic"] = m.topic + "/availability"
+		v["device"] = map[string]interface{}{"identifiers": []string{node}, "name": m.id, "model": "EdgeOS blacklist"}
+		add(fmt.Sprintf("%s/%s/%s/%s/config", m.discovery, component, node, object), v)
+	}
+
+	if m.discovery != "" {
+		discover("sensor", "blocked", map[string]interface{}{
+			"name":                "Blocked entries",
+			"state_topic":         m.topic + "/state",
+			"value_template":      "{{ value_json.blocked }}",
+			"unit_of_measurement": "entries",
+		})
+		discover("binary_sensor", "update", map[string]interface{}{
+			"name":           "Blacklist update",
+			"device_class":   "problem",
+			"state_topic":    m.topic + "/state",
+			"value_template": "{{ 'OFF' if value_json.result == 'success' else 'ON' }}",
+		})
+		discover("switch", "blocking", map[string]interface{}{
+			"name":           "Ad blocking",
+			"state_topic":    m.topic + "/state",
+			"value_template": "{{ 'OFF' if value_json.paused else 'ON' }}",
+			"command_topic":  m.topic + "/command",
+			"payload_on":     cmdResume,
+			"payload_off":    fmt.Sprintf("%s %d", cmdPause, defMQTTPause),
+		})
+		discover("button", "update_now", map[string]interface{}{
+			"name":          "Update blacklist",
+			"command_topic": m.topic + "/command",
+			"payload_press": cmdUpdate,
+		})
+		for _, s := range srcs {
+			discover("sensor", objectID.ReplaceAllString(s.Area+"_"+s.Source, "_"), map[string]interface{}{
+				"name":                s.Area + "/" + s.Source + " entries",
+				"state_topic":         m.topic + "/source/" + s.Area + "/" + s.Source,
+				"value_template":      "{{ value_json.kept }}",
+				"unit_of_measurement": "entries",
+			})
+		}
+	}
+
+	for _, s := range srcs {
+		if blocks(s.Area) {
+			state.Blocked += s.Kept
+		}
+		add(m.topic+"/source/"+s.Area+"/"+s.Source, mqttSource{Area: s.Area, Source: s.Source, Extracted: s.Extracted, Kept: s.Kept, Dropped: s.Dropped})
+	}
+	if ok {
+		state.Result = "success"
+	}
+	if until, paused := c.Paused(); paused {
+		state.Paused, state.PausedUntil = true, until.Format(time.RFC3339)
+	}
+	add(m.topic+"/state", state)
+	return msgs
+}
@@ -0,0 +1,382 @@
+package edgeos
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// broker is a local MQTT broker stand-in, recording its clients' connections and published messages,
+// and publishing commands to their subscriptions
+type broker struct {
+	net.Listener
+	mu      sync.Mutex
+	clients []*mqttClient
+	connect [][]byte // CONNECT bodies
+	gone    chan struct{}
+	msgs    []mqttMsg
+	mute    bool // doesn't answer pings
+	rc      byte // CONNACK return code
+	subs    chan string
+}
+
+func newBroker() *broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	b := &broker{Listener: l, gone: make(chan struct{}, 10), subs: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&mqttClient{Mutex: &sync.Mutex{}, conn: conn, r: bufio.NewReader(conn)})
+		}
+	}()
+	return b
+}
+
+func (b *broker) url() string {
+	return "mqtt://" + b.Addr().String()
+}
+
+func (b *broker) serve(cl *mqttClient) {
+	defer func() { b.gone <- struct{}{} }()
+	defer cl.conn.Close()
+	for {
+		h, body, err := cl.read()
+		if err != nil {
+			return
+		}
+		switch h & 0xf0 {
+		case pktConnect:
+			b.mu.Lock()
+			b.connect = append(b.connect, body)
+			b.clients = append(b.clients, cl)
+			rc := b.rc
+			b.mu.Unlock()
+			cl.write(pktConnack, []byte{0, rc})
+		case pktPublish:
+			n := int(body[0])<<8 | int(body[1])
+			b.mu.Lock()
+			b.msgs = append(b.msgs, mqttMsg{payload: body[2+n:], retained: h&0x01 != 0, topic: string(body[2 : 2+n])})
+			b.mu.Unlock()
+		case pktSubscribe & 0xf0:
+			cl.write(pktSuback, []byte{body[0], body[1], 0})
+			b.subs <- string(body[4 : len(body)-1])
+		case pktPingreq:
+			b.mu.Lock()
+			mute := b.mute
+			b.mu.Unlock()
+			if !mute {
+				cl.write(pktPingresp, nil)
+			}
+		case pktDisconnect:
+			return
+		}
+	}
+}
+
+// command publishes payload to the last client to connect
+func (b *broker) command(topic, payload string, retain bool) {
+	b.mu.Lock()
+	cl := b.clients[len(b.clients)-1]
+	b.mu.Unlock()
+	So(cl.publish(topic, []byte(payload), retain), ShouldBeNil)
+}
+
+// published returns the payloads published to each topic, with the last one to each winning
+func (b *broker) published() map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	x := make(map[string]string)
+	for _, m := range b.msgs {
+		x[m.topic] = string(m.payload)
+	}
+	return x
+}
+
+func TestMQTTLabel(t *testing.T) {
+	Convey("Testing mqttLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		So(c.Blacklist(&CFGstatic{Cfg: mqttCfg}), ShouldBeNil)
+		So(c.mqtt, ShouldResemble, &mqttConf{
+			broker:    "mqtts://broker.lan",
+			discovery: "ha",
+			id:        "router",
+			keepAlive: defMQTTKeepAlive,
+			password:  "secret",
+			pause:     defMQTTPauseFile,
+			topic:     "home/blacklist",
+			username:  "edgeos",
+		})
+
+		c = NewConfig(Logger(newLog()))
+		So(c.PublishMQTT(true), ShouldBeNil)
+		_, paused := c.Paused()
+		So(paused, ShouldBeFalse)
+		So(c.Resume(), ShouldBeNil)
+		So(c.ServeMQTT(func() {}), ShouldResemble, fmt.Errorf("no %s configured", mqttBroker))
+	})
+}
+
+func TestMQTTDial(t *testing.T) {
+	Convey("Testing dial()", t, func() {
+		b := newBroker()
+		defer b.Close()
+
+		m := &mqttConf{broker: b.url(), keepAlive: time.Minute, password: "secret", topic: "blacklist/router", username: "edgeos"}
+		cl, err := m.dial("router", true, time.Second)
+		So(err, ShouldBeNil)
+		So(cl.close(), ShouldBeNil)
+
+		exp := mqttString(nil, "MQTT")
+		exp = append(exp, 4, 0x80|0x40|0x20|0x04|0x02, 0, 60)
+		for _, s := range []string{"router", "blacklist/router/availability", "offline", "edgeos", "secret"} {
+			exp = mqttString(exp, s)
+		}
+		So(b.connect[0], ShouldResemble, exp)
+
+		Convey("Testing a refused connection", func() {
+			b.mu.Lock()
+			b.rc = 4
+			b.mu.Unlock()
+			_, err := m.dial("router", false, time.Second)
+			So(err.Error(), ShouldEqual, fmt.Sprintf("%s %s refused the connection: bad user name or password", mqttBroker, m.broker))
+		})
+
+		Convey("Testing an unsupported scheme", func() {
+			m.broker = "ws://" + b.Addr().String()
+			_, err := m.dial("router", false, time.Second)
+			So(err.Error(), ShouldEqual, fmt.Sprintf("%s %s: unsupported scheme \"ws\", use mqtt, tcp, mqtts, ssl or tls", mqttBroker, m.broker))
+		})
+	})
+}
+
+func TestPublishMQTT(t *testing.T) {
+	Convey("Testing PublishMQTT()", t, func() {
+		b := newBroker()
+		defer b.Close()
+
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(Logger(newLog()), Timeout(time.Second))
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(mqttPubCfg, b.url())}), ShouldBeNil)
+		c.mqtt.pause = dir + "/blacklist.pause"
+
+		c.ctr.add(&source{name: "malware", nType: domn}, 1, 12, 10, 100, time.Millisecond)
+		c.ctr.add(&source{name: "ads", nType: host}, 0, 5, 5, 50, time.Millisecond)
+		c.ctr.add(&source{name: "allow", nType: excDomn}, 0, 3, 3, 30, time.Millisecond)
+
+		until, err := c.Pause(30 * time.Minute)
+		So(err, ShouldBeNil)
+		So(c.RunDone(true), ShouldBeNil)
+		<-b.gone
+
+		act := b.published()
+		var state mqttState
+		So(json.Unmarshal([]byte(act["blacklist/router/state"]), &state), ShouldBeNil)
+		So(state.Time.IsZero(), ShouldBeFalse)
+		state.Time = time.Time{}
+		So(state, ShouldResemble, mqttState{Result: "success", Blocked: 15, Paused: true, PausedUntil: until.Format(time.RFC3339)})
+
+		So(act["blacklist/router/source/domains/malware"], ShouldEqual, `{"area":"domains","source":"malware","extracted":12,"kept":10,"dropped":1}`)
+		So(act, ShouldContainKey, "blacklist/router/source/whitelisted-subdomains/allow")
+		So(act, ShouldContainKey, "homeassistant/sensor/router/hosts_ads/config")
+		So(act, ShouldContainKey, "homeassistant/button/router/update_now/config")
+
+		var sw map[string]interface{}
+		So(json.Unmarshal([]byte(act["homeassistant/switch/router/blocking/config"]), &sw), ShouldBeNil)
+		So(sw["command_topic"], ShouldEqual, "blacklist/router/command")
+		So(sw["payload_off"], ShouldEqual, "pause 60")
+		So(sw["payload_on"], ShouldEqual, "resume")
+		So(sw["unique_id"], ShouldEqual, "router_blocking")
+		So(sw["availability_topic"], ShouldEqual, "blacklist/router/availability")
+
+		b.mu.Lock()
+		for _, m := range b.msgs {
+			So(m.retained, ShouldBeTrue)
+		}
+		b.mu.Unlock()
+
+		Convey("Testing a failed run without discovery", func() {
+			b.mu.Lock()
+			b.msgs = nil
+			b.mu.Unlock()
+			c.mqtt.discovery = ""
+			So(c.Resume(), ShouldBeNil)
+			So(c.PublishMQTT(false), ShouldBeNil)
+			<-b.gone
+
+			act := b.published()
+			So(act, ShouldHaveLength, 4)
+			So(act["blacklist/router/state"], ShouldStartWith, `{"result":"failure","blocked":15,"paused":false,"time":`)
+		})
+
+		Convey("Testing an unreachable broker", func() {
+			b.Close()
+			So(c.PublishMQTT(true).Error(), ShouldStartWith, fmt.Sprintf("cannot publish to %s %s: ", mqttBroker, b.url()))
+		})
+	})
+}
+
+func TestServeMQTT(t *testing.T) {
+	Convey("Testing ServeMQTT()", t, func() {
+		b := newBroker()
+		defer b.Close()
+
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(Logger(newLog()), Timeout(time.Second))
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(mqttPubCfg, b.url())}), ShouldBeNil)
+		c.mqtt.pause = dir + "/blacklist.pause"
+
+		var (
+			runs   = make(chan bool, 10)
+			served = make(chan error, 1)
+		)
+		go func() {
+			served <- c.ServeMQTT(func() {
+				_, paused := c.Paused()
+				runs <- paused
+			})
+		}()
+
+		So(<-b.subs, ShouldEqual, "blacklist/router/command")
+		So(b.published()["blacklist/router/availability"], ShouldEqual, "online")
+
+		ran := func() bool {
+			select {
+			case paused := <-runs:
+				return paused
+			case <-time.After(5 * time.Second):
+				panic("update wasn't run")
+			}
+		}
+
+		cmd := "blacklist/router/command"
+		b.command(cmd, "update-now", true) // retained, so ignored
+		b.command(cmd, "update-now", false)
+		So(ran(), ShouldBeFalse)
+
+		b.command(cmd, "pause 5", false)
+		So(ran(), ShouldBeTrue)
+		until, paused := c.Paused()
+		So(paused, ShouldBeTrue)
+		So(until, ShouldHappenWithin, 5*time.Minute+time.Second, time.Now())
+
+		b.command(cmd, "pause soon", false)
+		b.command(cmd, "reboot", false)
+		b.command(cmd, "resume", false)
+		So(ran(), ShouldBeFalse)
+		So(runs, ShouldBeEmpty)
+
+		b.mu.Lock()
+		b.clients[0].conn.Close()
+		b.mu.Unlock()
+		select {
+		case err = <-served:
+			So(err, ShouldNotBeNil)
+		case <-time.After(5 * time.Second):
+			panic("ServeMQTT didn't return")
+		}
+	})
+}
+
+func TestServeMQTTPings(t *testing.T) {
+	Convey("Testing ServeMQTT() gives up on a broker that stops answering pings", t, func() {
+		b := newBroker()
+		defer b.Close()
+
+		c := NewConfig(Logger(newLog()), Timeout(time.Second))
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(mqttPubCfg, b.url())}), ShouldBeNil)
+		c.mqtt.keepAlive = time.Second
+
+		served := make(chan error, 1)
+		go func() { served <- c.ServeMQTT(func() {}) }()
+		So(<-b.subs, ShouldEqual, "blacklist/router/command")
+
+		// answered pings keep the connection up past the read deadline
+		select {
+		case err := <-served:
+			panic(fmt.Sprintf("ServeMQTT returned %v", err))
+		case <-time.After(2 * time.Second):
+		}
+
+		b.mu.Lock()
+		b.mute = true
+		b.mu.Unlock()
+		select {
+		case err := <-served:
+			So(err, ShouldResemble, fmt.Errorf("%s stopped answering pings for %v", mqttBroker, 1500*time.Millisecond))
+		case <-time.After(5 * time.Second):
+			panic("ServeMQTT didn't return")
+		}
+	})
+}
+
+func TestMQTTPauseResume(t *testing.T) {
+	Convey("Testing a pause ending", t, func() {
+		b := newBroker()
+		defer b.Close()
+
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := NewConfig(Logger(newLog()), Timeout(time.Second))
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(mqttPubCfg, b.url())}), ShouldBeNil)
+		c.mqtt.pause = dir + "/blacklist.pause"
+		So(ioutil.WriteFile(c.mqtt.pause, []byte(time.Now().Add(time.Second).Format(time.RFC3339)), 0644), ShouldBeNil)
+		_, paused := c.Paused()
+		So(paused, ShouldBeTrue)
+
+		runs := make(chan bool, 1)
+		go c.ServeMQTT(func() {
+			_, paused := c.Paused()
+			runs <- paused
+		})
+
+		select {
+		case paused = <-runs:
+			So(paused, ShouldBeFalse)
+		case <-time.After(5 * time.Second):
+			panic("the pause didn't end")
+		}
+		_, err = os.Stat(c.mqtt.pause)
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+var mqttCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	mqtt-broker mqtts://broker.lan
+	mqtt-client-id router
+	mqtt-discovery-prefix ha/
+	mqtt-password secret
+	mqtt-topic /home/blacklist/
+	mqtt-username edgeos
+}`
+
+var mqttPubCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	mqtt-broker %s
+	mqtt-client-id router
+	mqtt-topic blacklist/router
+}`
@@ -0,0 +1,356 @@
+package edgeos
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	logging "github.com/britannic/go-logging"
+)
+
+// notification leaves and their defaults
+const (
+	notifyChat        = "notify-chat-webhook"
+	notifyCommand     = "notify-command"
+	notifyFailures    = "notify-failures"
+	notifyField       = "notify-chat-field"
+	notifyInterval    = "notify-interval"
+	notifyState       = "notify-state-file"
+	notifyTemplate    = "notify-chat-template"
+	notifyWebhook     = "notify-webhook"
+	defNotifyFailures = 3
+	defNotifyField    = "text"
+	defNotifyInterval = 60 * time.Minute
+	defNotifyState    = "/var/run/blacklist.notify"
+	defNotifyTemplate = "[{{.Host}}] {{.Event}}: {{.Text}}"
+)
+
+// notification events
+const (
+	eventGuard  = "shrink-guard-tripped"
+	eventHealth = "health-check-failed"
+	eventReload = "reload-failed"
+	eventRun    = "run-failed"
+	eventSource = "source-failed"
+)
+
+// Event is a notification, sent as JSON to webhooks and commands
+type Event struct {
+	Event   string    `json:"event"`
+	Host    string    `json:"host"`
+	Source  string    `json:"source,omitempty"`
+	Message string    `json:"message"`
+	Count   int       `json:"count,omitempty"` // consecutive failures
+	Time    time.Time `json:"time"`
+}
+
+// Text returns the event's message, prefixed by its source
+func (e Event) Text() string {
+	if e.Source == "" {
+		return e.Message
+	}
+	return e.Source + ": " + e.Message
+}
+
+// notifier sends events to the configured sinks, no more than once per interval for each event and
+// source, and counts sources' consecutive failures across runs
+type notifier struct {
+	*sync.Mutex
+	chat     string
+	command  string
+	failures int
+	field    string
+	interval time.Duration
+	log      *logging.Logger
+	memo     *notifyMemo
+	probe    string // health-check name
+	ran      map[string]string
+	state    string
+	timeout  time.Duration
+	tmpl     *template.Template
+	webhook  string
+}
+
+// notifyMemo is what the notifier remembers between runs, in the notify-state-file
+type notifyMemo struct {
+	Failures map[string]int       `json:"failures"`
+	Sent     map[string]time.Time `json:"sent"`
+}
+
+// notifyOn creates the notifier on first use
+func (c *Config) notifyOn() {
+	if c.notes == nil {
+		c.notes = &notifier{
+			Mutex:    &sync.Mutex{},
+			failures: defNotifyFailures,
+			field:    defNotifyField,
+			interval: defNotifyInterval,
+			log:      c.Log,
+			ran:      make(map[string]string),
+			state:    defNotifyState,
+			timeout:  c.Timeout,
+			tmpl:     template.Must(template.New(notifyTemplate).Parse(defNotifyTemplate)),
+		}
+	}
+}
+
+// notifyLabel sets the blacklist node's notify leaves and health-check
+func (c *Config) notifyLabel(leaf, val string) {
+	c.notifyOn()
+	n := c.notes
+	switch leaf {
+	case healthCheck:
+		n.probe = val
+	case notifyChat:
+		n.chat = val
+	case notifyCommand:
+		n.command = val
+	case notifyField:
+		n.field = val
+	case notifyState:
+		n.state = val
+	case notifyWebhook:
+		n.webhook = val
+	case notifyFailures:
+		if i, err := strconv.Atoi(val); err == nil && i > 0 {
+			n.failures = i
+		} else {
+			c.warnf("Ignoring invalid %s %q, using %d", notifyFailures, val, n.failures)
+		}
+	case notifyInterval:
+		if i, err := strconv.Atoi(val); err == nil && i >= 0 {
+			n.interval = time.Duration(i) * time.Minute
+		} else {
+			c.warnf("Ignoring invalid %s %q, using %v", notifyInterval, val, n.interval)
+		}
+	case notifyTemplate:
+		if t, err := template.New(notifyTemplate).Parse(val); err == nil {
+			n.tmpl = t
+		} else {
+			c.warnf("Ignoring invalid %s: %v", notifyTemplate, err)
+		}
+	}
+}
+
+// warnf logs a configuration warning, if there's a logger
+func (c *Config) warnf(format string, args ...interface{}) {
+	if c.Log != nil {
+		c.Log.Warningf(format, args...)
+	}
+}
+
+// notify sends an event, unless the same event for the same source was sent less than interval ago
+func (n *notifier) notify(event, source, msg string, count int) {
+	if n.quiet() {
+		return
+	}
+
+	host, _ := os.Hostname()
+	e := Event{Event: event, Host: host, Source: source, Message: msg, Count: count, Time: time.Now()}
+
+	n.Lock()
+	n.load()
+	key := event + "/" + source
+	if last, ok := n.memo.Sent[key]; ok && e.Time.Sub(last) < n.interval {
+		n.Unlock()
+		n.debugf("Not notifying %s, sent at %s", key, last.Format(time.RFC3339))
+		return
+	}
+	n.memo.Sent[key] = e.Time
+	n.Unlock()
+
+	for _, send := range []struct {
+		name string
+		to   string
+		fn   func(Event) error
+	}{
+		{name: notifyWebhook, to: n.webhook, fn: n.sendWebhook},
+		{name: notifyChat, to: n.chat, fn: n.sendChat},
+		{name: notifyCommand, to: n.command, fn: n.runCommand},
+	} {
+		if send.to == "" {
+			continue
+		}
+		if err := send.fn(e); err != nil && n.log != nil {
+			n.log.Warningf("Cannot send %s notification to %s %s: %v", event, send.name, send.to, err)
+		}
+	}
+}
+
+// quiet returns true if there's nowhere to send notifications
+func (n *notifier) quiet() bool {
+	return n == nil || (n.chat == "" && n.command == "" && n.webhook == "")
+}
+
+// debugf logs a debug message, if there's a logger
+func (n *notifier) debugf(format string, args ...interface{}) {
+	if n.log != nil {
+		n.log.Debugf(format, args...)
+	}
+}
+
+// sendWebhook posts the event as JSON
+func (n *notifier) sendWebhook(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return n.post(n.webhook, b)
+}
+
+// sendChat posts the templated message as a JSON object's notify-chat-field, the shape chat webhooks expect
+func (n *notifier) sendChat(e Event) error {
+	var msg bytes.Buffer
+	if err := n.tmpl.Execute(&msg, e); err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{n.field: msg.String()})
+	if err != nil {
+		return err
+	}
+	return n.post(n.chat, b)
+}
+
+// post sends a JSON body to url
+func (n *notifier) post(url string, body []byte) error {
+	timeout := n.timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// runCommand runs notify-command with the event as JSON on its stdin
+func (n *notifier) runCommand(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// nolint
+	x := exec.Command(n.command)
+	x.Stdin = bytes.NewReader(append(b, '\n'))
+	if out, err := x.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// done records whether source s failed in this run
+func (n *notifier) done(s *source, err error) {
+	if n == nil {
+		return
+	}
+	if err == nil {
+		err = s.err
+	}
+
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	n.Lock()
+	n.ran[s.area()+"/"+s.name] = msg
+	n.Unlock()
+}
+
+// finish notifies the sources that have now failed notify-failures runs in a row and, if it failed, the
+// run, then saves the notifier's state
+func (n *notifier) finish(ok bool) error {
+	if n.quiet() {
+		return nil
+	}
+
+	type failure struct {
+		count int
+		msg   string
+		src   string
+	}
+	var failed []failure
+
+	n.Lock()
+	n.load()
+	keys := make([]string, 0, len(n.ran))
+	for k := range n.ran {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if msg := n.ran[k]; msg != "" {
+			n.memo.Failures[k]++
+			if n.memo.Failures[k] >= n.failures {
+				failed = append(failed, failure{count: n.memo.Failures[k], msg: msg, src: k})
+			}
+			continue
+		}
+		delete(n.memo.Failures, k)
+	}
+	n.Unlock()
+
+	for _, f := range failed {
+		n.notify(eventSource, f.src, fmt.Sprintf("failed %d runs in a row: %s", f.count, f.msg), f.count)
+	}
+	if !ok {
+		n.notify(eventRun, "", "blacklist update failed", 0)
+	}
+
+	n.Lock()
+	defer n.Unlock()
+	n.ran = make(map[string]string)
+	return n.save()
+}
+
+// load reads the notify-state-file on first use; n must be locked
+func (n *notifier) load() {
+	if n.memo != nil {
+		return
+	}
+	n.memo = &notifyMemo{Failures: make(map[string]int), Sent: make(map[string]time.Time)}
+	b, err := ioutil.ReadFile(n.state)
+	if err != nil {
+		return
+	}
+	if err = json.Unmarshal(b, n.memo); err != nil && n.log != nil {
+		n.log.Warningf("Ignoring unreadable %s %s: %v", notifyState, n.state, err)
+	}
+	if n.memo.Failures == nil {
+		n.memo.Failures = make(map[string]int)
+	}
+	if n.memo.Sent == nil {
+		n.memo.Sent = make(map[string]time.Time)
+	}
+}
+
+// save replaces the notify-state-file; n must be locked
+func (n *notifier) save() error {
+	b, err := json.Marshal(n.memo)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(n.state), 0755); err != nil {
+		return err
+	}
+	tmp := n.state + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, n.state)
+}
@@ -0,0 +1,165 @@
+package edgeos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// hook is a local stand-in for a webhook, recording the bodies posted to it
+type hook struct {
+	*httptest.Server
+	mu     sync.Mutex
+	bodies []string
+}
+
+func newHook() *hook {
+	h := &hook{}
+	h.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		h.mu.Lock()
+		h.bodies = append(h.bodies, string(b))
+		h.mu.Unlock()
+	}))
+	return h
+}
+
+func (h *hook) posted() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.bodies...)
+}
+
+func TestNotifyLabel(t *testing.T) {
+	Convey("Testing notifyLabel()", t, func() {
+		c := NewConfig(Logger(newLog()))
+		So(c.notes, ShouldBeNil)
+		So(c.notes.quiet(), ShouldBeTrue)
+
+		c.notifyLabel(notifyFailures, "0")
+		c.notifyLabel(notifyInterval, "soon")
+		c.notifyLabel(notifyTemplate, "{{.Event")
+		So(c.notes.failures, ShouldEqual, defNotifyFailures)
+		So(c.notes.interval, ShouldEqual, defNotifyInterval)
+		So(c.notes.quiet(), ShouldBeTrue)
+
+		c.notifyLabel(notifyFailures, "5")
+		c.notifyLabel(notifyInterval, "10")
+		c.notifyLabel(notifyWebhook, "http://127.0.0.1/hook")
+		c.notifyLabel(healthCheck, "ads.example.com")
+		So(c.notes.failures, ShouldEqual, 5)
+		So(c.notes.interval, ShouldEqual, 10*time.Minute)
+		So(c.notes.probe, ShouldEqual, "ads.example.com")
+		So(c.notes.quiet(), ShouldBeFalse)
+	})
+}
+
+func TestNotify(t *testing.T) {
+	Convey("Testing notifications", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		web, chat := newHook(), newHook()
+		defer web.Close()
+		defer chat.Close()
+
+		script := dir + "/alert.sh"
+		So(ioutil.WriteFile(script, []byte("#!/bin/sh\ncat >> "+dir+"/events.json\n"), 0755), ShouldBeNil)
+
+		c := NewConfig(
+			Bash("/bin/bash"),
+			Dir(dir),
+			DNSsvc("echo dnsmasq: bad config; exit 1"),
+			Logger(newLog()),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(notifyCfg, chat.URL, script, dir, web.URL)}), ShouldBeNil)
+		n := c.notes
+
+		hostname, _ := os.Hostname()
+		n.notify(eventGuard, "domains/malware", "kept 2 entries", 0)
+		n.notify(eventGuard, "domains/malware", "kept 1 entries", 0)
+
+		So(web.posted(), ShouldHaveLength, 1)
+		var e Event
+		So(json.Unmarshal([]byte(web.posted()[0]), &e), ShouldBeNil)
+		So(e.Time.IsZero(), ShouldBeFalse)
+		e.Time = time.Time{}
+		So(e, ShouldResemble, Event{Event: eventGuard, Host: hostname, Source: "domains/malware", Message: "kept 2 entries"})
+
+		So(chat.posted(), ShouldResemble, []string{fmt.Sprintf(`{"content":"%s shrink-guard-tripped domains/malware: kept 2 entries"}`, hostname)})
+
+		b, err := ioutil.ReadFile(dir + "/events.json")
+		So(err, ShouldBeNil)
+		So(strings.Count(string(b), "\n"), ShouldEqual, 1)
+		So(string(b), ShouldContainSubstring, `"event":"shrink-guard-tripped"`)
+
+		Convey("Testing consecutive source failures", func() {
+			s := &source{name: "malware", nType: domn}
+			for i := 0; i < 2; i++ {
+				n.done(s, errors.New("no data returned"))
+				n.done(&source{name: "trackers", nType: host}, nil)
+				So(n.finish(true), ShouldBeNil)
+			}
+			So(web.posted(), ShouldHaveLength, 2)
+			So(json.Unmarshal([]byte(web.posted()[1]), &e), ShouldBeNil)
+			So(e.Event, ShouldEqual, eventSource)
+			So(e.Count, ShouldEqual, 2)
+			So(e.Message, ShouldEqual, "failed 2 runs in a row: no data returned")
+
+			n.done(s, nil)
+			So(n.finish(false), ShouldBeNil)
+			So(web.posted(), ShouldHaveLength, 3)
+			So(web.posted()[2], ShouldContainSubstring, `"event":"run-failed"`)
+
+			b, err := ioutil.ReadFile(dir + "/blacklist.notify")
+			So(err, ShouldBeNil)
+			memo := &notifyMemo{}
+			So(json.Unmarshal(b, memo), ShouldBeNil)
+			So(memo.Failures, ShouldBeEmpty)
+			So(memo.Sent, ShouldContainKey, eventSource+"/domains/malware")
+
+			Convey("Rate limits survive between runs", func() {
+				c := NewConfig(Logger(newLog()))
+				So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(notifyCfg, chat.URL, script, dir, web.URL)}), ShouldBeNil)
+				c.notes.notify(eventRun, "", "blacklist update failed", 0)
+				So(web.posted(), ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("Testing reload-failed", func() {
+			_, err := c.ReloadDNS()
+			So(err, ShouldNotBeNil)
+			So(web.posted(), ShouldHaveLength, 2)
+			So(web.posted()[1], ShouldContainSubstring, `"message":"exit status 1 dnsmasq: bad config"`)
+		})
+
+		Convey("Testing a failing sink", func() {
+			web.Close()
+			n.notify(eventHealth, "", "not blocked", 0)
+			So(chat.posted(), ShouldHaveLength, 2)
+		})
+	})
+}
+
+var notifyCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	notify-chat-field content
+	notify-chat-template "{{.Host}} {{.Event}} {{.Text}}"
+	notify-chat-webhook %s
+	notify-command %s
+	notify-failures 2
+	notify-state-file %s/blacklist.notify
+	notify-webhook %s
+}`
@@ -18,11 +18,14 @@ func _() {
 	_ = x[preHost-7]
 	_ = x[preRoot-8]
 	_ = x[root-9]
+	_ = x[addr-10]
+	_ = x[pol-11]
+	_ = x[fwd-12]
 }
 
-const _ntype_name = "unknowndomnexcDomnexcHostexcRoothostpreDomnpreHostpreRootroot"
+const _ntype_name = "unknowndomnexcDomnexcHostexcRoothostpreDomnpreHostpreRootrootaddrpolfwd"
 
-var _ntype_index = [...]uint8{0, 7, 11, 18, 25, 32, 36, 43, 50, 57, 61}
+var _ntype_index = [...]uint8{0, 7, 11, 18, 25, 32, 36, 43, 50, 57, 61, 65, 68, 71}
 
 func (i ntype) String() string {
 	if i < 0 || i >= ntype(len(_ntype_index)-1) {
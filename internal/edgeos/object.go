@@ -16,14 +16,25 @@ type Objects struct {
 func (o *Objects) addObj(c *Config, node string) {
 	o.src = append(o.src, c.addInc(node))
 	o.src = append(o.src, c.tree.validate(node).src...)
+	if node == hosts && c.nodeExists(hosts) && c.tree[hosts].promote > 0 {
+		o.src = append(o.src, c.promoteSrc())
+	}
 }
 
 // Files returns a list of dnsmasq conf files from all srcs
 func (o *Objects) Files() *CFile {
 	var c = CFile{Env: o.Env}
 	if !o.Disabled {
+		seen := make(map[string]bool)
 		for _, obj := range o.src {
-			c.Names = append(c.Names, obj.setFilePrefix(o.Env.Dir+"/%v.%v."+o.Env.Ext))
+			f := obj.setFilePrefix(o.Env.Dir + "/%v.%v." + o.Env.Ext)
+			if o.consolidated() && !obj.standalone() {
+				f = obj.sharedFile()
+			}
+			if !seen[f] {
+				seen[f] = true
+				c.Names = append(c.Names, f)
+			}
 		}
 		sort.Strings(c.Names)
 	}
@@ -114,6 +125,14 @@ func (o *Objects) objects(c *Config, node string, ltypes ...string) {
 		o.procltypes(c, node, ltypes...)
 	case rootNode:
 		o.procltypes(c, node, ltypes...)
+	case forwarding:
+		if ltypes == nil { // listed for stale file cleanup, but processed by Forwarding
+			o.src = append(o.src, c.forwardSrcs()...)
+		}
+	case policy:
+		if ltypes == nil { // listed for stale file cleanup, but processed by Policies
+			o.src = append(o.src, c.policySrcs()...)
+		}
 	}
 }
 
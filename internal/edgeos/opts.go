@@ -13,28 +13,50 @@ import (
 // Env is struct of parameters
 type Env struct {
 	ctr
+	cache     *FetchCache
+	conflicts []Conflict
+	force     bool
+	shrink    *shrinkGuard
+	hist      *history
+	idn       *idnGuard
+	idx       *index
+	layout    string
+	metrics   *metrics
+	mqtt      *mqttConf
+	notes     *notifier
+	out       Backend
+	page      string
+	psl       *suffixGuard
+	route     *ipSets
+	rpz       string
+	sched     *schedule
+	sets      *ipSets
+	state     *SourceState
+	tally     *tally
 	// ioWriter io.Writer
-	Log      *logging.Logger
-	API      string        `json:"API,omitempty"`
-	Arch     string        `json:"Arch,omitempty"`
-	Bash     string        `json:"Bash,omitempty"`
-	Cores    int           `json:"Cores,omitempty"`
-	Disabled bool          `json:"Disabled"`
-	Dbug     bool          `json:"Dbug,omitempty"`
-	Dex      *list         `json:"Dex,omitempty"`
-	Dir      string        `json:"Dir,omitempty"`
-	DNSsvc   string        `json:"dnsmasq service,omitempty"`
-	Exc      *list         `json:"Exc,omitempty"`
-	Ext      string        `json:"dnsmasq fileExt.,omitempty"`
-	File     string        `json:"File,omitempty"`
-	FnFmt    string        `json:"File name fmt,omitempty"`
-	InCLI    string        `json:"-"`
-	Level    string        `json:"CLI Path,omitempty"`
-	Method   string        `json:"HTTP method,omitempty"`
-	Pfx      dnsPfx        `json:"Prefix,omitempty"`
-	Test     bool          `json:"Test,omitempty"`
-	Timeout  time.Duration `json:"Timeout,omitempty"`
-	Verb     bool          `json:"Verbosity,omitempty"`
+	Log        *logging.Logger
+	API        string        `json:"API,omitempty"`
+	Arch       string        `json:"Arch,omitempty"`
+	Bash       string        `json:"Bash,omitempty"`
+	Cores      int           `json:"Cores,omitempty"`
+	Disabled   bool          `json:"Disabled"`
+	Dbug       bool          `json:"Dbug,omitempty"`
+	Dex        *list         `json:"Dex,omitempty"`
+	Dir        string        `json:"Dir,omitempty"`
+	DNSsvc     string        `json:"dnsmasq service,omitempty"`
+	Exc        *list         `json:"Exc,omitempty"`
+	Ext        string        `json:"dnsmasq fileExt.,omitempty"`
+	File       string        `json:"File,omitempty"`
+	FnFmt      string        `json:"File name fmt,omitempty"`
+	InCLI      string        `json:"-"`
+	Level      string        `json:"CLI Path,omitempty"`
+	Method     string        `json:"HTTP method,omitempty"`
+	PdnsSvc    string        `json:"pdns service,omitempty"`
+	Pfx        dnsPfx        `json:"Prefix,omitempty"`
+	Test       bool          `json:"Test,omitempty"`
+	Timeout    time.Duration `json:"Timeout,omitempty"`
+	UnboundSvc string        `json:"unbound service,omitempty"`
+	Verb       bool          `json:"Verbosity,omitempty"`
 	Wildcard/*..........*/ `json:"Wildcard,omitempty"`
 }
 
@@ -103,6 +125,29 @@ func Bash(s string) Option {
 	}
 }
 
+// Cache sets the FetchCache URL sources with a refresh-interval reuse their downloads from
+func Cache(f *FetchCache) Option {
+	return func(c *Config) Option {
+		previous := c.cache
+		c.cache = f
+		return Cache(previous)
+	}
+}
+
+// Collect toggles collecting per-source run statistics for metrics and reports
+func Collect(b bool) Option {
+	return func(c *Config) Option {
+		previous := c.metrics != nil
+		switch {
+		case b && c.metrics == nil:
+			c.metrics = newMetrics("", c.Env)
+		case !b:
+			c.metrics = nil
+		}
+		return Collect(previous)
+	}
+}
+
 // Cores sets max CPU cores
 func Cores(i int) Option {
 	return func(c *Config) Option {
@@ -176,6 +221,15 @@ func FileNameFmt(s string) Option {
 	}
 }
 
+// Force sets whether sources that trip a shrink guard are published anyway
+func Force(b bool) Option {
+	return func(c *Config) Option {
+		previous := c.force
+		c.force = b
+		return Force(previous)
+	}
+}
+
 // InCLI sets the CLI inSession command
 func InCLI(s string) Option {
 	return func(c *Config) Option {
@@ -229,6 +283,15 @@ func NewConfig(opts ...Option) *Config {
 	return &c
 }
 
+// PdnsSvc sets the PowerDNS Recursor reload command
+func PdnsSvc(s string) Option {
+	return func(c *Config) Option {
+		previous := c.PdnsSvc
+		c.PdnsSvc = s
+		return PdnsSvc(previous)
+	}
+}
+
 // Prefix sets the dnsmasq configuration address line prefix
 func Prefix(d string, h string) Option {
 	return func(c *Config) Option {
@@ -246,6 +309,15 @@ func (e *Env) String() string {
 	return string(out)
 }
 
+// State sets the SourceState that keeps each source's failed run count and last success time across runs
+func State(x *SourceState) Option {
+	return func(c *Config) Option {
+		previous := c.state
+		c.state = x
+		return State(previous)
+	}
+}
+
 // Test toggles testing mode on or off
 func Test(b bool) Option {
 	return func(c *Config) Option {
@@ -264,6 +336,15 @@ func Timeout(t time.Duration) Option {
 	}
 }
 
+// UnboundSvc sets the unbound reload command
+func UnboundSvc(s string) Option {
+	return func(c *Config) Option {
+		previous := c.UnboundSvc
+		c.UnboundSvc = s
+		return UnboundSvc(previous)
+	}
+}
+
 // Verb sets the verbosity level to v
 func Verb(b bool) Option {
 	return func(c *Config) Option {
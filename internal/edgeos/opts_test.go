@@ -2,6 +2,7 @@ package edgeos
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"sync"
@@ -22,6 +23,22 @@ func newLog() *logging.Logger {
 	return logging.MustGetLogger("blacklist")
 }
 
+// newTestConfig returns a Config that writes dnsmasq files to a new temporary directory, which the
+// caller removes, with opts applied after the defaults
+func newTestConfig(opts ...Option) (*Config, string) {
+	dir, err := ioutil.TempDir("", "testBlacklist")
+	if err != nil {
+		panic(err)
+	}
+	return NewConfig(append([]Option{
+		Dir(dir),
+		Ext("blacklist.conf"),
+		FileNameFmt("%v/%v.%v.%v"),
+		Logger(newLog()),
+		Prefix("address=", "server="),
+	}, opts...)...), dir
+}
+
 func TestEnvLog(t *testing.T) {
 	Convey("Testing log()", t, func() {
 		tests := []struct {
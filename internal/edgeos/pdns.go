@@ -0,0 +1,177 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	pdnsOut    = "pdns"
+	pdnsScript = "blacklist.lua"
+)
+
+// pdnsBackend writes a PowerDNS Recursor Lua preresolve script
+type pdnsBackend struct{}
+
+// entry returns "", since the recursor only reads the script finish writes
+func (pdnsBackend) entry(s *source, name string) string { return "" }
+
+// format returns nil, since the recursor loads a single script that finish writes from the index
+func (pdnsBackend) format(s *source, l *list) io.Reader {
+	return nil
+}
+
+func (pdnsBackend) preamble() string { return "" }
+
+func (pdnsBackend) reload(c *Config) ([]byte, error) {
+	return run(c, c.PdnsSvc)
+}
+
+func (pdnsBackend) String() string { return pdnsOut }
+
+// finish writes the merged blacklist to Dir as a Lua preresolve script
+func (pdnsBackend) finish(c *Config) error {
+	var (
+		block = make(map[string][]string) // domains by answer
+		exact = make(map[string]string)   // hosts and their answers
+		pass  []string                    // excluded domains
+		keep  []string                    // excluded hosts
+	)
+
+	for _, name := range c.idx.names() {
+		r, _ := c.idx.get(name)
+		switch r.nType {
+		case excDomn, excRoot:
+			pass = append(pass, name)
+		case excHost:
+			keep = append(keep, name)
+		case host, preHost:
+			exact[name] = luaAnswer(r)
+		case domn, preDomn, root, preRoot:
+			a := luaAnswer(r)
+			block[a] = append(block[a], name)
+		}
+	}
+
+	f, err := os.Create(filepath.Join(c.Dir, pdnsScript))
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	writeLua(w, pass, keep, block, exact)
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// luaAnswer returns the record's space separated redirect IPs, or its blocking-mode if it isn't a redirect
+func luaAnswer(r record) string {
+	a := action(r.mode, r.ip)
+	if a != modeRedirect {
+		return a
+	}
+	ip := net.ParseIP(r.ip)
+	if ip == nil {
+		return modeNull
+	}
+	if ip6 := net.ParseIP(r.ip6); ip6 != nil && ip.To4() != nil {
+		return ip.String() + " " + ip6.String()
+	}
+	return ip.String()
+}
+
+// luaList returns names as a Lua table constructor
+func luaList(names []string) string {
+	q := make([]string, len(names))
+	for i, n := range names {
+		q[i] = fmt.Sprintf("%q", n)
+	}
+	return "{" + strings.Join(q, ", ") + "}"
+}
+
+// writeLua writes the preresolve script; excludes take precedence, then hosts, then domains
+func writeLua(w io.Writer, pass, keep []string, block map[string][]string, exact map[string]string) {
+	fmt.Fprintln(w, "-- PowerDNS Recursor blacklist, generated by update-dnsmasq; do not edit")
+	fmt.Fprintf(w, "local pass = newDS()\npass:add(%s)\n", luaList(pass))
+	fmt.Fprintln(w, "local keep = {")
+	for _, n := range keep {
+		fmt.Fprintf(w, "\t[%q] = true,\n", n)
+	}
+	fmt.Fprintln(w, "}")
+
+	var ips []string
+	for ip := range block {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+
+	fmt.Fprintln(w, "local domains = {}")
+	for i, ip := range ips {
+		fmt.Fprintf(w, "domains[%d] = {ip = %q, ds = newDS()}\ndomains[%d].ds:add(%s)\n", i+1, ip, i+1, luaList(block[ip]))
+	}
+
+	var names []string
+	for n := range exact {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "local hosts = {")
+	for _, n := range names {
+		fmt.Fprintf(w, "\t[%q] = %q,\n", n, exact[n])
+	}
+	fmt.Fprintln(w, "}")
+
+	fmt.Fprint(w, luaPreresolve)
+}
+
+// luaPreresolve answers blocked names according to their blocking-mode or redirect IP
+const luaPreresolve = `
+local function answer(dq, ip)
+	if ip == "nxdomain" then
+		dq.rcode = pdns.NXDOMAIN
+	elseif ip == "refused" then
+		dq.rcode = pdns.REFUSED
+	elseif ip == "null" then
+		if dq.qtype == pdns.A then
+			dq:addAnswer(pdns.A, "0.0.0.0")
+		elseif dq.qtype == pdns.AAAA then
+			dq:addAnswer(pdns.AAAA, "::")
+		end
+	else
+		for a in ip:gmatch("%S+") do
+			if dq.qtype == pdns.A and not a:find(":") then
+				dq:addAnswer(pdns.A, a)
+			elseif dq.qtype == pdns.AAAA and a:find(":") then
+				dq:addAnswer(pdns.AAAA, a)
+			end
+		end
+	end
+	return true
+end
+
+function preresolve(dq)
+	local name = dq.qname:toStringNoDot():lower()
+	if keep[name] or pass:check(dq.qname) then
+		return false
+	end
+	if hosts[name] ~= nil then
+		return answer(dq, hosts[name])
+	end
+	for _, d in ipairs(domains) do
+		if d.ds:check(dq.qname) then
+			return answer(dq, d.ip)
+		end
+	end
+	return false
+end
+`
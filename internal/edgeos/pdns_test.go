@@ -0,0 +1,69 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPdns(t *testing.T) {
+	Convey("Testing the pdns backend", t, func() {
+		c, dir := newTestConfig(
+			Bash("/bin/bash"),
+			PdnsSvc("echo reloaded"),
+		)
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: pdnsCfg}), ShouldBeNil)
+		So(c.output().String(), ShouldEqual, pdnsOut)
+
+		for _, iface := range []IFace{PreDObj, PreHObj, ExDmObj, ExHtObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+		So(c.Finish(), ShouldBeNil)
+
+		files, err := ioutil.ReadDir(dir)
+		So(err, ShouldBeNil)
+		So(len(files), ShouldEqual, 1)
+
+		act, err := ioutil.ReadFile(dir + "/" + pdnsScript)
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, `-- PowerDNS Recursor blacklist, generated by update-dnsmasq; do not edit
+local pass = newDS()
+pass:add({"good.ads.com"})
+local keep = {
+	["ok.bar.com"] = true,
+}
+local domains = {}
+domains[1] = {ip = "null", ds = newDS()}
+domains[1].ds:add({"ads.com", "ads.net"})
+local hosts = {
+	["trk.foo.com"] = "192.168.1.1",
+}
+`+luaPreresolve)
+
+		out, err := c.ReloadDNS()
+		So(err, ShouldBeNil)
+		So(string(out), ShouldEqual, "reloaded\n")
+	})
+}
+
+var pdnsCfg = `blacklist {
+	disabled false
+	dns-backend pdns
+	dns-redirect-ip 0.0.0.0
+	domains {
+		exclude good.ads.com
+		include ads.com
+		include ads.net
+	}
+	hosts {
+		dns-redirect-ip 192.168.1.1
+		exclude ok.bar.com
+		include trk.foo.com
+	}
+}`
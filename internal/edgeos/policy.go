@@ -0,0 +1,179 @@
+package edgeos
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// nodeIncs names the policy and forwarding nodes' include list sources
+const nodeIncs = "included-domains"
+
+// setDirective returns the dnsmasq directive that adds a routed domain's resolved addresses to the
+// source's IPv4 and IPv6 sets, e.g. ipset=/%v/vpn,vpn6 or nftset=/%v/4#inet#blacklist#vpn,6#inet#blacklist#vpn6
+func (s *source) setDirective() string {
+	if s.route != nil && s.route.format == nftOut {
+		return fmt.Sprintf("nftset=/%%v/4#inet#%[1]s#%[2]s,6#inet#%[1]s#%[2]s6", nftTable, s.set)
+	}
+	return fmt.Sprintf("ipset=/%%v/%[1]s,%[1]s6", s.set)
+}
+
+// policySrcs returns the policy node's include list and its sources, defaulting their set to set-name
+func (c *Config) policySrcs() []*source {
+	if !c.nodeExists(policy) {
+		return nil
+	}
+
+	name := c.ipSetConf(policy).name
+	srcs := []*source{{
+		Env:   c.Env,
+		desc:  getLtypeDesc(nodeIncs),
+		inc:   c.tree[policy].inc,
+		ltype: nodeIncs,
+		name:  nodeIncs,
+		nType: pol,
+	}}
+	srcs = append(srcs, c.validate(policy).src...)
+
+	for _, s := range srcs {
+		if s.set == "" {
+			s.set = name
+		}
+	}
+	return srcs
+}
+
+// sideEnv returns an Env for processing sources alongside the blacklist; it dedups its own names
+// and never touches the blacklist's, and excluded domains drop their subdomains too
+func (c *Config) sideEnv(exc *list) *Env {
+	e := *c.Env
+	e.Dex = exc
+	e.Exc = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	e.idx = nil
+	e.layout = ""
+	e.out = dnsmasqBackend{}
+	e.tally = nil
+	return &e
+}
+
+// Policies writes a dnsmasq ipset or nftset directive file for each policy node source, so resolved
+// addresses of routed domains land in firewall sets that policy routing, QoS or firewall rules can
+// match, and a set-file that creates those sets
+func (c *Config) Policies() error {
+	if !c.nodeExists(policy) || c.tree[policy].disabled {
+		return nil
+	}
+
+	var (
+		envs = make(map[string]*Env)
+		exc  = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		sets []string
+	)
+
+	for _, e := range c.tree[policy].exc {
+		exc.set([]byte(e))
+	}
+
+	srcs := c.policySrcs()
+	for _, s := range srcs {
+		if _, ok := envs[s.set]; !ok {
+			envs[s.set] = c.sideEnv(exc) // each set dedups its own names
+			sets = append(sets, s.set)
+		}
+		s.Env = envs[s.set]
+	}
+
+	err := processSide(srcs)
+	if e := c.writeSetFile(sets); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// standalone returns true for policy and forwarding sources, which always write their own files
+func (s *source) standalone() bool {
+	return s.nType == pol || s.nType == fwd
+}
+
+// processSide fetches, extracts and writes sources that are rendered alongside the blacklist rather
+// than merged into it, each with the Env its node set up for it
+func processSide(srcs []*source) error {
+	var (
+		errs []string
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+	)
+
+	for _, s := range srcs {
+		wg.Add(1)
+		go func(s *source) {
+			defer wg.Done()
+			switch s.ltype {
+			case nodeIncs:
+				s.r = s.includes()
+			case urls:
+				s = download(s)
+			case files:
+				s.r, s.err = GetFile(s.file)
+			}
+
+			s.ctr.reset(s)
+
+			err := s.err
+			if err == nil {
+				err = s.process().writeFile()
+			}
+			s.metrics.done(s, err)
+			s.notes.done(s, err)
+			if f, ok := s.r.(io.Closer); ok {
+				f.Close()
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if errs != nil {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// writeSetFile writes the policy node's set-file, which creates each set's IPv4 and IPv6 sets
+// if they don't exist, but keeps the addresses dnsmasq has already added to them
+func (c *Config) writeSetFile(sets []string) error {
+	conf := c.ipSetConf(policy)
+	f, err := os.Create(conf.file)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if conf.format == nftOut {
+		fmt.Fprintf(w, "table inet %s {\n", nftTable)
+		for _, s := range sets {
+			fmt.Fprintf(w, "\tset %s {\n\t\ttype ipv4_addr\n\t}\n", s)
+			fmt.Fprintf(w, "\tset %s6 {\n\t\ttype ipv6_addr\n\t}\n", s)
+		}
+		fmt.Fprintln(w, "}")
+	} else {
+		for _, s := range sets {
+			fmt.Fprintf(w, "create %s hash:ip family inet\n", s)
+			fmt.Fprintf(w, "create %s6 hash:ip family inet6\n", s)
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,129 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSetDirective(t *testing.T) {
+	Convey("Testing setDirective()", t, func() {
+		s := &source{Env: &Env{}, nType: pol, set: "vpn"}
+		So(getDnsmasqPrefix(s), ShouldEqual, "ipset=/%v/vpn,vpn6")
+
+		s.route = &ipSets{format: nftOut}
+		So(fmt.Sprintf(getDnsmasqPrefix(s), "netflix.com"), ShouldEqual, "nftset=/netflix.com/4#inet#blacklist#vpn,6#inet#blacklist#vpn6")
+	})
+}
+
+func TestPolicies(t *testing.T) {
+	Convey("Testing Policies()", t, func() {
+		c, dir := newTestConfig(WCard(Wildcard{Node: "*s", Name: "*"}))
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/streaming.txt", []byte("nflxvideo.net\nhelp.netflix.com\nwww.help.netflix.com\nhulu.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/iot.txt", []byte("0.0.0.0 tuya.com\n0.0.0.0 netflix.com\n"), 0644), ShouldBeNil)
+
+		So(c.Policies(), ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(policyCfg, dir, dir, dir)}), ShouldBeNil)
+
+		stale := dir + "/policy.removed.blacklist.conf"
+		So(ioutil.WriteFile(stale, []byte("ipset=/old.com/vpn,vpn6\n"), 0644), ShouldBeNil)
+		So(c.GetAll().Files().Remove(), ShouldBeNil)
+		_, err := os.Stat(stale)
+		So(os.IsNotExist(err), ShouldBeTrue)
+
+		for _, iface := range []IFace{FileObj, PreDObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			for _, s := range ct.GetList().src {
+				So(s.nType, ShouldNotEqual, pol)
+			}
+		}
+
+		So(c.Policies(), ShouldBeNil)
+
+		files, err := filepath.Glob(dir + "/policy.*.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(files, ShouldResemble, []string{
+			dir + "/policy.included-domains.blacklist.conf",
+			dir + "/policy.iot.blacklist.conf",
+			dir + "/policy.streaming.blacklist.conf",
+		})
+
+		act, err := ioutil.ReadFile(dir + "/policy.streaming.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "ipset=/hulu.com/vpn,vpn6\nipset=/nflxvideo.net/vpn,vpn6\n")
+
+		act, err = ioutil.ReadFile(dir + "/policy.iot.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "ipset=/netflix.com/iot,iot6\nipset=/tuya.com/iot,iot6\n")
+
+		act, err = ioutil.ReadFile(dir + "/policy.included-domains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "ipset=/netflix.com/vpn,vpn6\n")
+
+		act, err = ioutil.ReadFile(dir + "/policy.ipset")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, `create vpn hash:ip family inet
+create vpn6 hash:ip family inet6
+create iot hash:ip family inet
+create iot6 hash:ip family inet6
+`)
+
+		Convey("Testing nftables sets", func() {
+			c.setLabel(policy, setFormat, nftOut)
+			c.setLabel(policy, setFile, dir+"/policy.nft")
+			So(c.Policies(), ShouldBeNil)
+
+			act, err := ioutil.ReadFile(dir + "/policy.iot.blacklist.conf")
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, "nftset=/netflix.com/4#inet#blacklist#iot,6#inet#blacklist#iot6\nnftset=/tuya.com/4#inet#blacklist#iot,6#inet#blacklist#iot6\n")
+
+			act, err = ioutil.ReadFile(dir + "/policy.nft")
+			So(err, ShouldBeNil)
+			So(string(act), ShouldEqual, `table inet blacklist {
+	set vpn {
+		type ipv4_addr
+	}
+	set vpn6 {
+		type ipv6_addr
+	}
+	set iot {
+		type ipv4_addr
+	}
+	set iot6 {
+		type ipv6_addr
+	}
+}
+`)
+		})
+	})
+}
+
+var policyCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		include ads.com
+	}
+	policy {
+		exclude help.netflix.com
+		include netflix.com
+		set-file %s/policy.ipset
+		set-name vpn
+		source streaming {
+			file %s/streaming.txt
+		}
+		source iot {
+			file %s/iot.txt
+			prefix "0.0.0.0 "
+			set-name iot
+		}
+	}
+}`
@@ -0,0 +1,147 @@
+package edgeos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const promoted = "promoted-hosts"
+
+// Promotion records a registrable domain promoted from host entries to a domain block
+type Promotion struct {
+	Domain string `json:"domain"`
+	Hosts  int    `json:"hosts"`
+}
+
+// tally counts distinct blocked hosts per registrable domain
+type tally struct {
+	*sync.RWMutex
+	domains map[string]entry
+	promos  []Promotion
+}
+
+func newTally() *tally {
+	return &tally{RWMutex: &sync.RWMutex{}, domains: make(map[string]entry)}
+}
+
+// add records a blocked host under its registrable domain
+func (t *tally) add(n ntype, fqdn []byte, registrable func(string) string) {
+	if t == nil {
+		return
+	}
+	switch n {
+	case host, preHost:
+	default:
+		return
+	}
+
+	h := string(fqdn)
+	d := registrable(h)
+	if d == "" || d == h {
+		return
+	}
+
+	t.Lock()
+	if _, ok := t.domains[d]; !ok {
+		t.domains[d] = make(entry)
+	}
+	t.domains[d][h] = struct{}{}
+	t.Unlock()
+}
+
+// candidates returns the registrable domains with at least n distinct hosts
+func (t *tally) candidates(n int) []Promotion {
+	var p []Promotion
+	t.RLock()
+	for d, h := range t.domains {
+		if len(h) >= n {
+			p = append(p, Promotion{Domain: d, Hosts: len(h)})
+		}
+	}
+	t.RUnlock()
+	sort.Slice(p, func(i, j int) bool { return p[i].Domain < p[j].Domain })
+	return p
+}
+
+// excluded returns true if d is a whitelisted domain, is under one, or has whitelisted hosts under it
+func (c *Config) excluded(d string) bool {
+	for _, n := range c.Nodes() {
+		for _, x := range c.tree[n].exc {
+			if x == d || strings.HasSuffix(d, "."+x) || strings.HasSuffix(x, "."+d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// protected returns true if d or one of its parents is on the hosts promote-protect list
+func (c *Config) protected(d string) bool {
+	for _, p := range c.tree[hosts].protect {
+		if d == p || strings.HasSuffix(d, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// promoteSrc returns the source used to render promoted domains
+func (c *Config) promoteSrc() *source {
+	return &source{
+		Env:   c.Env,
+		desc:  fmt.Sprintf("%s promoted from %s", domains, hosts),
+		ip:    c.tree.getIP(hosts),
+		ip6:   c.tree.getIP6(hosts),
+		ltype: promoted,
+		mode:  c.tree.getMode(hosts),
+		name:  promoted,
+		nType: domn,
+	}
+}
+
+// Promote writes a domains blacklist for registrable domains that have at least
+// promote-threshold distinct blocked hosts, unless they are excluded or protected
+func (c *Config) Promote() error {
+	if !c.nodeExists(hosts) || c.tree[hosts].promote < 1 || c.tally == nil {
+		return nil
+	}
+
+	var (
+		l = list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		s = c.promoteSrc()
+	)
+
+	c.tally.promos = nil
+	for _, p := range c.tally.candidates(c.tree[hosts].promote) {
+		switch {
+		case c.protected(p.Domain):
+			c.Debug(fmt.Sprintf("Not promoting protected domain %s", p.Domain))
+		case c.excluded(p.Domain):
+			c.Debug(fmt.Sprintf("Not promoting excluded domain %s", p.Domain))
+		case c.Dex.subKeyExists([]byte(p.Domain)):
+			c.Debug(fmt.Sprintf("Not promoting %s, it's already blocked by a domain block", p.Domain))
+		default:
+			c.Log.Noticef("Promoted %s to a domain block (%d hosts)", p.Domain, p.Hosts)
+			c.tally.promos = append(c.tally.promos, p)
+			l.set([]byte(p.Domain))
+			c.idx.add([]byte(p.Domain), s)
+		}
+	}
+
+	b := &bList{
+		file: s.filename(domains),
+		r:    s.render(&l),
+		size: len(c.tally.promos),
+	}
+	return b.writeFile()
+}
+
+// Promoted returns the domains promoted by the last call to Promote
+func (c *Config) Promoted() []Promotion {
+	if c.tally == nil {
+		return nil
+	}
+	return c.tally.promos
+}
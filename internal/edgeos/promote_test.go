@@ -0,0 +1,100 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTallyAdd(t *testing.T) {
+	Convey("Testing tally.add()", t, func() {
+		var (
+			e  = &Env{}
+			tl = newTally()
+		)
+		for _, h := range []string{"trk1.foo.com", "trk2.foo.com", "foo.com", "co.uk", "a.b.bbc.co.uk"} {
+			tl.add(host, []byte(h), e.registrable)
+		}
+		tl.add(domn, []byte("trk3.foo.com"), e.registrable)
+
+		So(tl.candidates(1), ShouldResemble, []Promotion{{Domain: "bbc.co.uk", Hosts: 1}, {Domain: "foo.com", Hosts: 2}})
+		So(tl.candidates(2), ShouldResemble, []Promotion{{Domain: "foo.com", Hosts: 2}})
+
+		var nilTally *tally
+		So(func() { nilTally.add(host, []byte("trk1.foo.com"), e.registrable) }, ShouldNotPanic)
+	})
+}
+
+func TestPromote(t *testing.T) {
+	Convey("Testing Promote()", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: promoteCfg}), ShouldBeNil)
+		So(c.tree[hosts].promote, ShouldEqual, 3)
+		So(c.tree[hosts].protect, ShouldResemble, []string{"safe.net"})
+
+		for _, iface := range []IFace{ExDmObj, ExHtObj, PreHObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		So(c.Promote(), ShouldBeNil)
+		So(c.Promoted(), ShouldResemble, []Promotion{{Domain: "foo.com", Hosts: 3}})
+
+		act, err := ioutil.ReadFile(dir + "/domains.promoted-hosts.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/foo.com/10.0.0.1\n")
+
+		So(c.GetAll().Files().Strings(), ShouldContain, dir+"/domains.promoted-hosts.blacklist.conf")
+
+		Convey("Testing the run report lists the promotions", func() {
+			c.SetOpt(Collect(true))
+			So(c.RunDone(true), ShouldBeNil)
+			So(c.Report("1.0", "abc").Promotions, ShouldResemble, []Promotion{{Domain: "foo.com", Hosts: 3}})
+		})
+
+		Convey("Testing excluded() only counts whitelisted domains", func() {
+			So(c.excluded("good.org"), ShouldBeTrue)
+			So(c.excluded("bar.com"), ShouldBeTrue)
+			c.Dex.set([]byte("baz.com"))
+			So(c.excluded("baz.com"), ShouldBeFalse)
+		})
+
+		Convey("Testing Promote() when disabled", func() {
+			c.tree[hosts].promote = 0
+			So(c.Promote(), ShouldBeNil)
+			So(c.GetAll().Files().Strings(), ShouldNotContain, dir+"/domains.promoted-hosts.blacklist.conf")
+		})
+	})
+}
+
+var promoteCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		exclude good.org
+	}
+	hosts {
+		dns-redirect-ip 10.0.0.1
+		exclude cdn.bar.com
+		include trk1.foo.com
+		include trk2.foo.com
+		include trk3.foo.com
+		include trk1.bar.com
+		include trk2.bar.com
+		include trk3.bar.com
+		include trk1.good.org
+		include trk2.good.org
+		include trk3.good.org
+		include trk1.safe.net
+		include trk2.safe.net
+		include trk3.safe.net
+		include ads.baz.com
+		promote-protect safe.net
+		promote-threshold 3
+	}
+}`
@@ -0,0 +1,413 @@
+package edgeos
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// logStamp is the syslog timestamp that heads dnsmasq's log lines
+const logStamp = "Jan _2 15:04:05"
+
+// rotated matches the suffixes logrotate gives a log's older files
+var rotated = regexp.MustCompile(`\.(\d+)(\.gz)?$`)
+
+// QueryLog is what dnsmasq's query log says about the blacklist: the blocked answers, the
+// domains and clients they went to and the sources whose entries blocked them
+type QueryLog struct {
+	From      time.Time
+	To        time.Time
+	Queries   int
+	Blocked   int
+	Unmatched int // config answers no blacklist file accounts for, e.g. addresses node entries
+	Domains   []Hits
+	Clients   []Hits
+	Sources   []Hits // every blacklist source, including those without hits
+}
+
+// Hits is a domain's, client's or source's number of blocked answers
+type Hits struct {
+	Name  string
+	Count int
+}
+
+// blockers maps blocked names to the node/source that blocked them, and lists the sources
+type blockers struct {
+	allow map[string]bool // excluded names, answered normally even if a parent domain is blocked
+	names map[string]blockedName
+	srcs  []string
+}
+
+// OpenQueryLog returns a reader of the dnsmasq log in file and its rotated files, oldest first,
+// decompressing gzipped files; "-" reads stdin
+func OpenQueryLog(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+
+	names, err := rotations(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		logs    multiCloser
+		readers []io.Reader
+	)
+	for _, n := range names {
+		f, err := os.Open(n)
+		if err != nil {
+			logs.Close()
+			return nil, err
+		}
+		logs = append(logs, f)
+
+		b := bufio.NewReader(f)
+		if magic, _ := b.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+			z, err := gzip.NewReader(b)
+			if err != nil {
+				logs.Close()
+				return nil, fmt.Errorf("cannot decompress %s: %v", n, err)
+			}
+			logs = append(logs, z)
+			readers = append(readers, z)
+			continue
+		}
+		readers = append(readers, b)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(readers...), logs}, nil
+}
+
+// multiCloser closes the files and decompressors behind a query log reader
+type multiCloser []io.Closer
+
+func (m multiCloser) Close() (err error) {
+	for _, c := range m {
+		if e := c.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// rotations returns file's rotated files, oldest first, followed by file itself if it exists
+func rotations(file string) ([]string, error) {
+	matches, err := filepath.Glob(file + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		names []string
+		n     = make(map[string]int)
+	)
+	for _, m := range matches {
+		if x := rotated.FindStringSubmatch(m[len(file):]); x != nil && x[0] == m[len(file):] {
+			n[m], _ = strconv.Atoi(x[1])
+			names = append(names, m)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return n[names[i]] > n[names[j]] })
+
+	if _, err = os.Stat(file); err == nil {
+		names = append(names, file)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no query log found at %s", file)
+	}
+	return names, nil
+}
+
+// blockers returns the names in the generated blacklist files and the sources that wrote them; it
+// uses the block-page-index instead if one is configured, since consolidated files don't say which
+// source each entry came from
+func (c *Config) blockers() (*blockers, error) {
+	b := &blockers{names: make(map[string]blockedName)}
+	for _, s := range c.Get(all).src {
+		switch s.nType {
+		case preDomn, preHost, preRoot:
+			if len(s.inc) == 0 {
+				continue
+			}
+		case domn, host, root:
+		default:
+			continue
+		}
+		if !s.disabled {
+			b.srcs = append(b.srcs, hitNode(s.fileArea())+"/"+s.name)
+		}
+	}
+	sort.Strings(b.srcs)
+
+	if c.page != "" {
+		if d, err := ioutil.ReadFile(c.page); err == nil {
+			x := &blockIndex{}
+			if err = json.Unmarshal(d, x); err != nil {
+				return nil, fmt.Errorf("cannot read block page index %s: %v", c.page, err)
+			}
+			for name, e := range x.Blocked {
+				e.Node = hitNode(e.Node)
+				b.names[name] = e
+			}
+			return b, nil
+		}
+	}
+
+	if c.consolidated() {
+		c.Log.Warningf("Hits are counted per area with output-layout %s; configure %s to count them per source", c.layout, blockPage)
+		b.srcs = nil
+	}
+
+	files, err := filepath.Glob(fmt.Sprintf(c.FnFmt, c.Dir, c.Wildcard.Node, c.Wildcard.Name, c.Ext))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		node := strings.SplitN(strings.TrimSuffix(filepath.Base(f), "."+c.Ext), ".", 2)
+		if len(node) != 2 {
+			continue
+		}
+		if err = b.read(f, hitNode(node[0]), node[1], c.Pfx.domain+"/"); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// hitNode returns the node hits are counted under, counting the blacklist node's sources under roots
+func hitNode(node string) string {
+	if node == rootNode {
+		return roots
+	}
+	return node
+}
+
+// read adds the names blocked by file's prefix lines to node/source
+func (b *blockers) read(file, node, source, prefix string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		name := line[len(prefix):]
+		if i := strings.IndexByte(name, '/'); i > 0 {
+			name = name[:i]
+		}
+		if _, ok := b.names[name]; !ok {
+			b.names[name] = blockedName{Node: node, Sources: []string{source}}
+		}
+	}
+	return s.Err()
+}
+
+// lookup returns the node/source whose entry blocked host, or its parent domain, as dnsmasq's
+// address directives match subdomains too
+func (b *blockers) lookup(host string) (string, bool) {
+	for name := host; name != ""; {
+		if b.allow[name] {
+			return "", false
+		}
+		if e, ok := b.names[name]; ok && len(e.Sources) > 0 {
+			return e.Node + "/" + e.Sources[0], true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return "", false
+}
+
+// QueryLog reads a dnsmasq query log, written with log-queries, and maps each blocked answer to the
+// source that blocked it; lines older than since are skipped, unless since is zero
+func (c *Config) QueryLog(r io.Reader, since time.Time) (*QueryLog, error) {
+	b, err := c.blockers()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		asked   = make(map[string]string) // last client to ask for each name
+		clients = make(map[string]int)
+		domains = make(map[string]int)
+		now     = time.Now()
+		q       = &QueryLog{}
+		s       = bufio.NewScanner(r)
+		srcs    = make(map[string]int)
+	)
+	for _, k := range b.srcs {
+		srcs[k] = 0
+	}
+
+	for s.Scan() {
+		line := s.Text()
+		f, client, found := logLine(line)
+		if !found || len(f) < 4 {
+			continue
+		}
+
+		t, ok := logTime(line, now)
+		if ok && !since.IsZero() && t.Before(since) {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(f[0], "query[") && f[2] == "from":
+			q.Queries++
+			asked[f[1]] = f[3]
+		case f[0] == "config" && f[2] == "is":
+			src, found := b.lookup(f[1])
+			if !found {
+				q.Unmatched++
+				continue
+			}
+			if client == "" {
+				client = asked[f[1]]
+			}
+			if client == "" {
+				client = "unknown"
+			}
+			q.Blocked++
+			clients[client]++
+			domains[f[1]]++
+			srcs[src]++
+		default:
+			continue
+		}
+
+		if ok {
+			if q.From.IsZero() || t.Before(q.From) {
+				q.From = t
+			}
+			if t.After(q.To) {
+				q.To = t
+			}
+		}
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	q.Clients, q.Domains, q.Sources = ranked(clients), ranked(domains), ranked(srcs)
+	return q, nil
+}
+
+// logLine returns the fields of a dnsmasq log line's message and, with log-queries=extra, the client
+// it names, or false if it isn't a dnsmasq line
+func logLine(line string) (f []string, client string, ok bool) {
+	i := strings.Index(line, "dnsmasq[")
+	if i < 0 {
+		return nil, "", false
+	}
+	j := strings.Index(line[i:], "]: ")
+	if j < 0 {
+		return nil, "", false
+	}
+
+	f = strings.Fields(line[i+j+3:])
+	if len(f) > 2 && strings.IndexByte(f[1], '/') > 0 { // log-queries=extra adds a serial and client/port
+		if _, err := strconv.Atoi(f[0]); err == nil {
+			client, f = f[1][:strings.IndexByte(f[1], '/')], f[2:]
+		}
+	}
+	return f, client, true
+}
+
+// logTime returns the line's syslog timestamp, which has no year, so it's taken to be the latest
+// that isn't in the future
+func logTime(line string, now time.Time) (time.Time, bool) {
+	if len(line) < len(logStamp) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(logStamp, line[:len(logStamp)], now.Location())
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = t.AddDate(now.Year(), 0, 0)
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t, true
+}
+
+// ranked returns m's counts, highest first
+func ranked(m map[string]int) []Hits {
+	x := make([]Hits, 0, len(m))
+	for k, v := range m {
+		x = append(x, Hits{Name: k, Count: v})
+	}
+	sort.Slice(x, func(i, j int) bool {
+		if x[i].Count != x[j].Count {
+			return x[i].Count > x[j].Count
+		}
+		return x[i].Name < x[j].Name
+	})
+	return x
+}
+
+// Idle returns the sources that blocked nothing in the log's period
+func (q *QueryLog) Idle() (x []string) {
+	for _, s := range q.Sources {
+		if s.Count == 0 {
+			x = append(x, s.Name)
+		}
+	}
+	sort.Strings(x)
+	return x
+}
+
+// Write writes the top n blocked domains and clients, every source's hits and the idle sources
+func (q *QueryLog) Write(w io.Writer, n int) error {
+	period := "no timestamped answers"
+	if !q.From.IsZero() {
+		period = q.From.Format("2006-01-02 15:04") + " to " + q.To.Format("2006-01-02 15:04")
+	}
+	fmt.Fprintf(w, "%d queries, %d blocked, %d other config answers, %s\n", q.Queries, q.Blocked, q.Unmatched, period)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	table := func(title string, hits []Hits, n int) {
+		fmt.Fprintf(tw, "\n%s\thits\n", title)
+		for i, h := range hits {
+			if n > 0 && i == n {
+				break
+			}
+			if h.Count > 0 {
+				fmt.Fprintf(tw, "%s\t%d\n", h.Name, h.Count)
+			}
+		}
+	}
+	table("domain", q.Domains, n)
+	table("client", q.Clients, n)
+	table("source", q.Sources, 0)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if idle := q.Idle(); len(idle) > 0 {
+		fmt.Fprintf(w, "\nSources without hits: %s\n", strings.Join(idle, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package edgeos
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOpenQueryLog(t *testing.T) {
+	Convey("Testing OpenQueryLog()", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		file := dir + "/dnsmasq.log"
+		_, err = OpenQueryLog(file)
+		So(err, ShouldNotBeNil)
+
+		var z bytes.Buffer
+		w := gzip.NewWriter(&z)
+		_, err = w.Write([]byte("oldest\n"))
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+
+		So(ioutil.WriteFile(file+".2.gz", z.Bytes(), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(file+".10", []byte("ancient\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(file+".1", []byte("older\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(file+".bak", []byte("ignored\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(file, []byte("newest\n"), 0644), ShouldBeNil)
+
+		r, err := OpenQueryLog(file)
+		So(err, ShouldBeNil)
+		b, err := ioutil.ReadAll(r)
+		So(err, ShouldBeNil)
+		So(r.Close(), ShouldBeNil)
+		So(string(b), ShouldEqual, "ancient\noldest\nolder\nnewest\n")
+	})
+}
+
+func TestLogTime(t *testing.T) {
+	Convey("Testing logTime()", t, func() {
+		now := time.Date(2019, 1, 2, 12, 0, 0, 0, time.Local)
+
+		act, ok := logTime("Jan  2 11:59:00 dnsmasq[1]: query[A] a.com from 10.0.0.1", now)
+		So(ok, ShouldBeTrue)
+		So(act, ShouldEqual, time.Date(2019, 1, 2, 11, 59, 0, 0, time.Local))
+
+		act, ok = logTime("Dec 31 23:00:00 dnsmasq[1]: query[A] a.com from 10.0.0.1", now)
+		So(ok, ShouldBeTrue)
+		So(act, ShouldEqual, time.Date(2018, 12, 31, 23, 0, 0, 0, time.Local))
+
+		_, ok = logTime("dnsmasq[1]: query[A] a.com from 10.0.0.1", now)
+		So(ok, ShouldBeFalse)
+	})
+}
+
+func TestQueryLog(t *testing.T) {
+	Convey("Testing QueryLog()", t, func() {
+		c, dir := newTestConfig(WCard(Wildcard{Node: "*s", Name: "*"}))
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/malware.txt", []byte("bad.com\nworse.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/ads.txt", []byte("ads.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/trackers.txt", []byte("tracker.net\n"), 0644), ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(queryLogCfg, dir, dir, dir)}), ShouldBeNil)
+		for _, iface := range []IFace{ExRtObj, ExDmObj, PreDObj, FileObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		stamp := func(ago time.Duration) string {
+			return time.Now().Add(-ago).Format(logStamp)
+		}
+		log := strings.Join([]string{
+			stamp(48*time.Hour) + " dnsmasq[99]: query[A] ads.com from 192.168.1.9",
+			stamp(48*time.Hour) + " dnsmasq[99]: config ads.com is 0.0.0.0",
+			stamp(time.Hour) + " ubnt dnsmasq[99]: query[A] www.bad.com from 192.168.1.10",
+			stamp(time.Hour) + " ubnt dnsmasq[99]: config www.bad.com is 0.0.0.0",
+			stamp(time.Hour) + " ubnt dnsmasq[99]: query[AAAA] www.bad.com from 192.168.1.10",
+			stamp(time.Hour) + " ubnt dnsmasq[99]: config www.bad.com is NODATA-IPv6",
+			stamp(time.Minute) + " dnsmasq[99]: 7 192.168.1.11/40312 query[A] tracker.net from 192.168.1.11",
+			stamp(time.Minute) + " dnsmasq[99]: 7 192.168.1.11/40312 config tracker.net is 0.0.0.0",
+			stamp(time.Minute) + " dnsmasq[99]: query[A] router.lan from 192.168.1.11",
+			stamp(time.Minute) + " dnsmasq[99]: config router.lan is 192.168.1.1",
+			stamp(time.Minute) + " dnsmasq[99]: query[A] good.com from 192.168.1.11",
+			stamp(time.Minute) + " dnsmasq[99]: forwarded good.com to 1.1.1.1",
+			stamp(time.Minute) + " dnsmasq[99]: reply good.com is 93.184.216.34",
+			"not a dnsmasq line",
+		}, "\n")
+
+		q, err := c.QueryLog(strings.NewReader(log), time.Time{})
+		So(err, ShouldBeNil)
+		So(q.Queries, ShouldEqual, 6)
+		So(q.Blocked, ShouldEqual, 4)
+		So(q.Unmatched, ShouldEqual, 1)
+		So(q.To.Sub(q.From), ShouldBeGreaterThan, 47*time.Hour)
+		So(q.Domains, ShouldResemble, []Hits{{Name: "www.bad.com", Count: 2}, {Name: "ads.com", Count: 1}, {Name: "tracker.net", Count: 1}})
+		So(q.Clients, ShouldResemble, []Hits{{Name: "192.168.1.10", Count: 2}, {Name: "192.168.1.11", Count: 1}, {Name: "192.168.1.9", Count: 1}})
+		So(q.Sources, ShouldResemble, []Hits{
+			{Name: "domains/malware", Count: 2},
+			{Name: "domains/" + PreDomns, Count: 1},
+			{Name: "hosts/trackers", Count: 1},
+			{Name: "domains/ads", Count: 0},
+		})
+		So(q.Idle(), ShouldResemble, []string{"domains/ads"})
+
+		Convey("Testing QueryLog() since", func() {
+			q, err := c.QueryLog(strings.NewReader(log), time.Now().Add(-24*time.Hour))
+			So(err, ShouldBeNil)
+			So(q.Blocked, ShouldEqual, 3)
+			So(q.Idle(), ShouldResemble, []string{"domains/ads", "domains/" + PreDomns})
+		})
+
+		Convey("Testing QueryLog() with a block-page-index", func() {
+			So(ioutil.WriteFile(dir+"/index.json", []byte(`{"blocked":{"tracker.net":{"exact":true,"node":"hosts","sources":["trackers"]},"bad.com":{"node":"domains","sources":["ads","malware"]}}}`), 0644), ShouldBeNil)
+			c.page = dir + "/index.json"
+			q, err := c.QueryLog(strings.NewReader(log), time.Time{})
+			So(err, ShouldBeNil)
+			So(q.Blocked, ShouldEqual, 3)
+			So(q.Unmatched, ShouldEqual, 2)
+			So(q.Sources[0], ShouldResemble, Hits{Name: "domains/ads", Count: 2})
+		})
+
+		Convey("Testing Write()", func() {
+			var b bytes.Buffer
+			So(q.Write(&b, 1), ShouldBeNil)
+			act := b.String()
+			So(act, ShouldStartWith, "6 queries, 4 blocked, 1 other config answers, ")
+			So(act, ShouldContainSubstring, "\ndomain       hits\nwww.bad.com  2\n\n")
+			So(act, ShouldNotContainSubstring, "ads.com")
+			So(act, ShouldContainSubstring, "domains/malware")
+			So(act, ShouldEndWith, "\nSources without hits: domains/ads\n")
+		})
+	})
+}
+
+var queryLogCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		include ads.com
+		source malware {
+			file %s/malware.txt
+		}
+		source ads {
+			file %s/ads.txt
+		}
+	}
+	hosts {
+		source trackers {
+			file %s/trackers.txt
+		}
+	}
+}`
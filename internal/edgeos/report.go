@@ -0,0 +1,193 @@
+package edgeos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/britannic/blacklist/internal/fqdn"
+)
+
+// Report is a machine readable summary of a blacklist update, for monitoring
+type Report struct {
+	Version    string         `json:"version"`
+	GitHash    string         `json:"githash"`
+	Started    time.Time      `json:"started"`
+	Finished   time.Time      `json:"finished"`
+	Duration   float64        `json:"duration_seconds"`
+	Success    bool           `json:"success"`
+	Blocked    int32          `json:"blocked"`
+	Sources    []SourceReport `json:"sources"`
+	Files      []FileReport   `json:"files"`
+	Excluded   map[string]int `json:"excluded_hits"`
+	Promotions []Promotion    `json:"promotions"`
+	Conflicts  []Conflict     `json:"conflicts"` // forwarded domains the blacklist blocks
+	Anomalies  []Anomaly      `json:"anomalies"`
+	Reload     *ReloadReport  `json:"reload"`
+}
+
+// SourceReport is a source's result for the run
+type SourceReport struct {
+	Name      string       `json:"name"`
+	Node      string       `json:"node"`
+	URL       string       `json:"url,omitempty"`
+	File      string       `json:"file,omitempty"`
+	Status    int          `json:"http_status,omitempty"`
+	Cached    bool         `json:"cache_hit"` // its download was reused, as its refresh-interval hadn't passed
+	Bytes     int          `json:"bytes"`
+	Extracted int          `json:"extracted"`
+	Kept      int          `json:"kept"`
+	Dropped   int          `json:"dropped"`
+	Duration  float64      `json:"duration_seconds"`
+	Success   bool         `json:"success"`
+	Guard     string       `json:"guard,omitempty"`   // why a shrink guard kept its previous output
+	Rejects   *fqdn.Report `json:"rejects,omitempty"` // its invalid entries, with their line numbers and reasons
+	Errors    []string     `json:"errors"`
+	Warnings  []string     `json:"warnings"`
+}
+
+// FileReport is an output file's size and SHA-256 hash
+type FileReport struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ReloadReport is the outcome of the DNS service reload
+type ReloadReport struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Report returns the run report; call RunDone first, so it has the run's result
+func (c *Config) Report(version, githash string) *Report {
+	m := c.metrics
+	if m == nil {
+		return nil
+	}
+
+	m.RLock()
+	r := &Report{
+		Version:    version,
+		GitHash:    githash,
+		Started:    m.start,
+		Finished:   m.finished,
+		Duration:   m.duration.Seconds(),
+		Success:    m.result == 1,
+		Blocked:    m.blocked,
+		Sources:    []SourceReport{},
+		Excluded:   c.exclusionHits(m.excl),
+		Promotions: append([]Promotion{}, c.Promoted()...),
+		Conflicts:  append([]Conflict{}, m.conflicts...),
+		Anomalies:  append([]Anomaly{}, m.anoms...),
+		Reload:     m.reload,
+	}
+
+	var keys []string
+	for k := range m.src {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		x, n := m.src[k], m.counts(m.src[k])
+		var rejects *fqdn.Report
+		if x.rejects.Len() > 0 {
+			rejects = &fqdn.Report{}
+			*rejects = x.rejects
+		}
+		r.Sources = append(r.Sources, SourceReport{
+			Name:      x.name,
+			Node:      x.node,
+			URL:       x.url,
+			File:      x.file,
+			Status:    x.status,
+			Cached:    x.cached,
+			Bytes:     x.bytes,
+			Extracted: n.Extracted,
+			Kept:      n.Kept,
+			Dropped:   n.Dropped,
+			Duration:  x.fetch.Seconds(),
+			Success:   len(x.errs) == 0,
+			Guard:     x.guard,
+			Rejects:   rejects,
+			Errors:    append([]string{}, x.errs...),
+			Warnings:  append([]string{}, x.warns...),
+		})
+	}
+	m.RUnlock()
+
+	r.Files = c.fileReports()
+	return r
+}
+
+// exclusionHits returns the drops counted against the configured excludes, leaving out
+// subdomains dropped because a source had already blocked their parent domain
+func (c *Config) exclusionHits(drops map[string]int) map[string]int {
+	hits := make(map[string]int)
+	for _, n := range []string{rootNode, domains} {
+		if !c.nodeExists(n) {
+			continue
+		}
+		for _, e := range c.tree[n].exc {
+			if drops[e] > 0 {
+				hits[e] = drops[e]
+			}
+		}
+	}
+	return hits
+}
+
+// fileReports returns the size and hash of each output file the run wrote
+func (c *Config) fileReports() []FileReport {
+	var (
+		names = append([]string{}, c.GetAll().Files().Names...)
+		rs    = []FileReport{}
+		seen  = make(map[string]bool)
+	)
+
+	for _, f := range []string{c.rpz, c.page} {
+		if f != "" {
+			names = append(names, f)
+		}
+	}
+	sort.Strings(names)
+
+	for _, f := range names {
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		if r, err := fileReport(f); err == nil {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// fileReport returns the size and SHA-256 hash of file f
+func fileReport(f string) (FileReport, error) {
+	h, err := os.Open(f)
+	if err != nil {
+		return FileReport{}, err
+	}
+	defer h.Close()
+
+	sum := sha256.New()
+	n, err := io.Copy(sum, h)
+	if err != nil {
+		return FileReport{}, err
+	}
+	return FileReport{Name: f, Size: n, SHA256: hex.EncodeToString(sum.Sum(nil))}, nil
+}
+
+// Encode writes the run report as indented JSON
+func (r *Report) Encode(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
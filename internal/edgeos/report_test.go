@@ -0,0 +1,193 @@
+package edgeos
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/britannic/blacklist/internal/fqdn"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReport(t *testing.T) {
+	Convey("Testing Report()", t, func() {
+		c, dir := newTestConfig(WCard(Wildcard{Node: "*s", Name: "*"}))
+		defer os.RemoveAll(dir)
+
+		So(c.Report("1.0", "abc"), ShouldBeNil)
+
+		restore := c.SetOpt(Collect(true))
+		So(c.metrics, ShouldNotBeNil)
+		restore(c)
+		So(c.metrics, ShouldBeNil)
+		c.SetOpt(Collect(true))
+
+		So(ioutil.WriteFile(dir+"/malware.txt", []byte("bad.com\nworse.com\ncdn.good.com\nx.cdn.good.com\nlocalhost\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/empty.txt", []byte("# nothing to see\n"), 0644), ShouldBeNil)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(reportCfg, dir, dir, dir)}), ShouldBeNil)
+
+		for _, iface := range []IFace{ExRtObj, ExDmObj, PreDObj, FileObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			_ = c.ProcessContent(ct)
+		}
+		c.metrics.reloaded(errors.New("exit status 1"))
+		So(c.RunDone(false), ShouldBeNil)
+
+		r := c.Report("1.0", "abc")
+		So(r.Version, ShouldEqual, "1.0")
+		So(r.GitHash, ShouldEqual, "abc")
+		So(r.Success, ShouldBeFalse)
+		So(r.Finished.Before(r.Started), ShouldBeFalse)
+		So(r.Blocked, ShouldEqual, 3)
+		So(r.Reload, ShouldResemble, &ReloadReport{Error: "exit status 1"})
+		So(r.Excluded, ShouldResemble, map[string]int{"good.com": 2})
+
+		srcs := make(map[string]SourceReport)
+		for _, s := range r.Sources {
+			srcs[s.Node+"/"+s.Name] = s
+		}
+
+		So(srcs["domains/malware"], ShouldResemble, SourceReport{
+			Name:      "malware",
+			Node:      domains,
+			File:      dir + "/malware.txt",
+			Extracted: 4,
+			Kept:      2,
+			Dropped:   2,
+			Success:   true,
+			Rejects: &fqdn.Report{
+				Total:   1,
+				Reasons: map[string]int{"not fully qualified": 1},
+				Rejects: []fqdn.Reject{{Line: 5, Token: "localhost", Reason: fqdn.SingleLabel, Why: "not fully qualified"}},
+			},
+			Errors:   []string{},
+			Warnings: []string{},
+		})
+		So(srcs["domains/empty"].Success, ShouldBeTrue)
+		So(srcs["domains/empty"].Rejects, ShouldBeNil)
+		So(srcs["domains/missing"].Success, ShouldBeFalse)
+		So(srcs["domains/missing"].Errors, ShouldHaveLength, 1)
+		So(srcs["domains/"+PreDomns].Kept, ShouldEqual, 1)
+
+		b, err := ioutil.ReadFile(dir + "/domains.malware.blacklist.conf")
+		So(err, ShouldBeNil)
+		sum := sha256.Sum256(b)
+
+		var found bool
+		for _, f := range r.Files {
+			if f.Name == dir+"/domains.malware.blacklist.conf" {
+				found = true
+				So(f, ShouldResemble, FileReport{Name: f.Name, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])})
+			}
+			So(f.Name, ShouldNotEqual, dir+"/domains.missing.blacklist.conf")
+		}
+		So(found, ShouldBeTrue)
+
+		Convey("Testing Encode()", func() {
+			buf := &bytes.Buffer{}
+			So(r.Encode(buf), ShouldBeNil)
+
+			var act map[string]interface{}
+			So(json.Unmarshal(buf.Bytes(), &act), ShouldBeNil)
+			for _, k := range []string{"version", "githash", "started", "finished", "duration_seconds", "success", "blocked", "sources", "files", "excluded_hits", "promotions", "reload"} {
+				So(act, ShouldContainKey, k)
+			}
+		})
+	})
+}
+
+func TestReportCacheHit(t *testing.T) {
+	Convey("Testing a source's cache_hit", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "ads.example.com")
+		}))
+		defer server.Close()
+
+		cache := NewFetchCache()
+		run := func() SourceReport {
+			c := NewConfig(
+				Cache(cache),
+				Collect(true),
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Method("GET"),
+				Prefix("address=", "server="),
+			)
+			So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(cacheCfg, server.URL)}), ShouldBeNil)
+			ct, err := c.NewContent(URLdObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.RunDone(true), ShouldBeNil)
+
+			r := c.Report("1.0", "abc")
+			So(r.Sources, ShouldHaveLength, 1)
+			So(r.Sources[0].Kept, ShouldEqual, 1)
+			return r.Sources[0]
+		}
+
+		first := run()
+		So(first.Cached, ShouldBeFalse)
+		So(first.Status, ShouldEqual, http.StatusOK)
+
+		// within the refresh-interval
+		second := run()
+		So(second.Cached, ShouldBeTrue)
+		So(second.Status, ShouldEqual, 0)
+	})
+}
+
+func TestSubKey(t *testing.T) {
+	Convey("Testing subKey()", t, func() {
+		l := &list{RWMutex: &sync.RWMutex{}, entry: entry{"good.com": {}}}
+		k, ok := l.subKey([]byte("x.cdn.good.com"))
+		So(ok, ShouldBeTrue)
+		So(k, ShouldEqual, "good.com")
+		_, ok = l.subKey([]byte("bad.com"))
+		So(ok, ShouldBeFalse)
+	})
+}
+
+var reportCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	exclude good.com
+	domains {
+		include ads.com
+		source malware {
+			file %s/malware.txt
+		}
+		source empty {
+			file %s/empty.txt
+		}
+		source missing {
+			file %s/missing.txt
+		}
+	}
+}`
+
+var cacheCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		source ads {
+			refresh-interval 60
+			url %s/ads.txt
+		}
+	}
+}`
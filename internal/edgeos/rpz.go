@@ -0,0 +1,123 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	rpzFile     = "rpz-file"
+	rpzDrop     = "rpz-drop."
+	rpzPassthru = "rpz-passthru."
+	rpzTTL      = 300
+)
+
+// rpzSerial matches the serial number in a zone's SOA record
+var rpzSerial = regexp.MustCompile(`\sIN\s+SOA\s+\S+\s+\S+\s+(\d+)`)
+
+// rpzLabel sets the blacklist node's Response Policy Zone leaf
+func (c *Config) rpzLabel(val string) {
+	c.indexOn()
+	c.rpz = val
+}
+
+// serial returns the next SOA serial for the zone in file, in YYYYMMDDnn format
+// or one more than the previous serial, whichever is greater
+func serial(file string, now time.Time) uint32 {
+	next := uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100) // YYYYMMDD00
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return next
+	}
+	if m := rpzSerial.FindSubmatch(b); m != nil {
+		if prev, err := strconv.ParseUint(string(m[1]), 10, 32); err == nil && uint32(prev) >= next {
+			return uint32(prev) + 1
+		}
+	}
+	return next
+}
+
+// rpzRules returns the RPZ rules for name, or nil if its type isn't exported; RPZ
+// can't answer REFUSED, so refused blocks drop the query instead
+func rpzRules(name string, r record) (rr []string) {
+	var (
+		data  []string
+		exact bool
+	)
+
+	switch r.nType {
+	case excDomn, excRoot:
+		data = []string{"CNAME " + rpzPassthru}
+	case excHost:
+		data, exact = []string{"CNAME " + rpzPassthru}, true
+	case host, preHost:
+		exact = true
+		fallthrough
+	case domn, preDomn, root, preRoot:
+		switch action(r.mode, r.ip) {
+		case modeNXDomain:
+			data = []string{"CNAME ."}
+		case modeRefused:
+			data = []string{"CNAME " + rpzDrop}
+		default:
+			data = answers(r.mode, r.ip, r.ip6)
+		}
+	default:
+		return nil
+	}
+
+	for _, d := range data {
+		rr = append(rr, name+" "+d)
+	}
+	if !exact {
+		for _, d := range data {
+			rr = append(rr, "*."+name+" "+d)
+		}
+	}
+	return rr
+}
+
+// RPZ writes the merged blacklist and whitelist as a Response Policy Zone to rpz-file,
+// for BIND, Knot and PowerDNS resolvers; domains also block their subdomains, hosts
+// block exact names and excludes map to rpz-passthru
+func (c *Config) RPZ() error {
+	if c.rpz == "" {
+		return nil
+	}
+
+	s := serial(c.rpz, time.Now())
+	f, err := os.Create(c.rpz)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintf(w, "$TTL %d\n", rpzTTL)
+	fmt.Fprintf(w, "@ IN SOA localhost. hostmaster.localhost. %d 3600 600 86400 %d\n", s, rpzTTL)
+	fmt.Fprintf(w, "@ IN NS localhost.\n")
+
+	var n int
+	for _, name := range c.idx.names() {
+		r, _ := c.idx.get(name)
+		for _, rule := range rpzRules(name, r) {
+			fmt.Fprintln(w, rule)
+			n++
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	c.Log.Infof("Wrote %d RPZ rules to %s (serial %d)", n, c.rpz, s)
+	return nil
+}
@@ -0,0 +1,98 @@
+package edgeos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRPZRules(t *testing.T) {
+	Convey("Testing rpzRules()", t, func() {
+		tests := []struct {
+			exp []string
+			rec record
+		}{
+			{rec: record{nType: domn, ip: "0.0.0.0"}, exp: []string{"ads.com A 0.0.0.0", "ads.com AAAA ::", "*.ads.com A 0.0.0.0", "*.ads.com AAAA ::"}},
+			{rec: record{nType: preRoot, ip: "192.168.1.1"}, exp: []string{"ads.com A 192.168.1.1", "*.ads.com A 192.168.1.1"}},
+			{rec: record{nType: host}, exp: []string{"ads.com CNAME ."}},
+			{rec: record{nType: preHost, ip: "fd00::1"}, exp: []string{"ads.com AAAA fd00::1"}},
+			{rec: record{nType: excDomn}, exp: []string{"ads.com CNAME rpz-passthru.", "*.ads.com CNAME rpz-passthru."}},
+			{rec: record{nType: excHost}, exp: []string{"ads.com CNAME rpz-passthru."}},
+			{rec: record{nType: unknown}, exp: nil},
+		}
+
+		for _, tt := range tests {
+			So(rpzRules("ads.com", tt.rec), ShouldResemble, tt.exp)
+		}
+	})
+}
+
+func TestSerial(t *testing.T) {
+	Convey("Testing serial()", t, func() {
+		f, err := ioutil.TempFile("/tmp", "testRPZ")
+		So(err, ShouldBeNil)
+		defer os.Remove(f.Name())
+
+		now := time.Date(2019, 5, 4, 0, 0, 0, 0, time.UTC)
+		So(serial("/tmp/no-such-zone.rpz", now), ShouldEqual, 2019050400)
+
+		So(ioutil.WriteFile(f.Name(), []byte("@ IN SOA localhost. hostmaster.localhost. 2019050407 3600 600 86400 300\n"), 0644), ShouldBeNil)
+		So(serial(f.Name(), now), ShouldEqual, 2019050408)
+		So(serial(f.Name(), now.AddDate(0, 0, 1)), ShouldEqual, 2019050500)
+	})
+}
+
+func TestRPZ(t *testing.T) {
+	Convey("Testing RPZ()", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.RPZ(), ShouldBeNil)
+
+		So(c.Blacklist(&CFGstatic{Cfg: rpzCfg}), ShouldBeNil)
+		c.rpz = dir + "/blacklist.rpz"
+
+		for _, iface := range []IFace{PreDObj, PreHObj, ExDmObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		So(c.RPZ(), ShouldBeNil)
+		act, err := ioutil.ReadFile(c.rpz)
+		So(err, ShouldBeNil)
+		first := serial(c.rpz, time.Now()) - 1
+		So(string(act), ShouldEqual, `$TTL 300
+@ IN SOA localhost. hostmaster.localhost. `+fmt.Sprint(first)+` 3600 600 86400 300
+@ IN NS localhost.
+ads.com A 0.0.0.0
+ads.com AAAA ::
+*.ads.com A 0.0.0.0
+*.ads.com AAAA ::
+good.ads.com CNAME rpz-passthru.
+*.good.ads.com CNAME rpz-passthru.
+trk.foo.com A 192.168.1.1
+`)
+
+		So(c.RPZ(), ShouldBeNil)
+		So(serial(c.rpz, time.Now()), ShouldEqual, first+2)
+	})
+}
+
+var rpzCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	rpz-file /tmp/blacklist.rpz
+	domains {
+		exclude good.ads.com
+		include ads.com
+	}
+	hosts {
+		dns-redirect-ip 192.168.1.1
+		include trk.foo.com
+	}
+}`
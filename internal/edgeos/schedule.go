@@ -0,0 +1,247 @@
+package edgeos
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduling leaves and their defaults
+const (
+	refreshAt         = "refresh-interval"
+	updateAt          = "update-interval"
+	updateCron        = "update-schedule"
+	updateJitter      = "update-jitter"
+	defUpdateInterval = 24 * time.Hour
+)
+
+// jitter returns a random delay in [0, n); a var, so tests can fix it
+var jitter = rand.New(rand.NewSource(time.Now().UnixNano())).Int63n
+
+// schedule is when a daemon runs updates: at the update-schedule's times, or every update-interval,
+// each delayed by up to update-jitter
+type schedule struct {
+	cron     *cronExpr
+	interval time.Duration
+	jitter   time.Duration
+}
+
+// scheduleOn creates the schedule on first use
+func (c *Config) scheduleOn() {
+	if c.sched == nil {
+		c.sched = &schedule{interval: defUpdateInterval}
+	}
+}
+
+// scheduleLabel sets the blacklist node's update-schedule, update-interval and update-jitter leaves
+func (c *Config) scheduleLabel(leaf, val string) {
+	c.scheduleOn()
+	x := c.sched
+	switch leaf {
+	case updateCron:
+		cron, err := parseCron(val)
+		if err != nil {
+			c.warnf("Ignoring invalid %s %q: %v", updateCron, val, err)
+			return
+		}
+		x.cron = cron
+	case updateAt:
+		if i, err := strconv.Atoi(val); err == nil && i > 0 {
+			x.interval = time.Duration(i) * time.Minute
+		} else {
+			c.warnf("Ignoring invalid %s %q, using %v", updateAt, val, x.interval)
+		}
+	case updateJitter:
+		if i, err := strconv.Atoi(val); err == nil && i >= 0 {
+			x.jitter = time.Duration(i) * time.Minute
+		} else {
+			c.warnf("Ignoring invalid %s %q", updateJitter, val)
+		}
+	}
+}
+
+// refreshLabel sets a source's refresh-interval leaf
+func (c *Config) refreshLabel(o *source, val string) {
+	if i, err := strconv.Atoi(val); err == nil && i > 0 {
+		o.refresh = time.Duration(i) * time.Minute
+		return
+	}
+	c.warnf("%s: ignoring invalid %s %q", o.name, refreshAt, val)
+}
+
+// NextRun returns when a daemon should next run an update after now: the update-schedule's next time,
+// or update-interval from now, delayed by a random amount of up to update-jitter, unless a pause ends sooner
+func (c *Config) NextRun(now time.Time) time.Time {
+	c.scheduleOn()
+	x := c.sched
+
+	next := now.Add(x.interval)
+	if x.cron != nil {
+		if t := x.cron.next(now); !t.IsZero() {
+			next = t
+		} else {
+			c.warnf("%s never matches, using %s %v", updateCron, updateAt, x.interval)
+		}
+	}
+	if x.jitter > 0 {
+		next = next.Add(time.Duration(jitter(int64(x.jitter))))
+	}
+	if until, ok := c.Paused(); ok && until.Before(next) {
+		next = until
+	}
+	return next
+}
+
+// cronExpr is a five field cron expression: minute, hour, day of month, month and day of week
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64 // bit sets of the matching values
+	anyDay                        bool   // day of month or day of week is *, so both must match
+}
+
+// cronField is a cron field's range and value names
+type cronField struct {
+	min, max int
+	names    []string
+}
+
+var (
+	cronFields = [5]cronField{
+		{min: 0, max: 59},
+		{min: 0, max: 23},
+		{min: 1, max: 31},
+		{min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+		{min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+	}
+
+	// cronMacros are the @ shorthands for common expressions
+	cronMacros = map[string]string{
+		"@hourly":  "0 * * * *",
+		"@daily":   "0 0 * * *",
+		"@weekly":  "0 0 * * 0",
+		"@monthly": "0 0 1 * *",
+	}
+)
+
+// parseCron parses a five field cron expression, with *, lists, ranges, steps, month and day names,
+// or an @hourly, @daily, @weekly or @monthly macro
+func parseCron(expr string) (*cronExpr, error) {
+	if m, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = m
+	}
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("want 5 fields, minute hour day-of-month month day-of-week, got %d", len(f))
+	}
+
+	var bits [5]uint64
+	for i, s := range f {
+		b, err := cronFields[i].parse(strings.ToLower(s))
+		if err != nil {
+			return nil, err
+		}
+		bits[i] = b
+	}
+
+	// Sunday is 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronExpr{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		anyDay: strings.HasPrefix(f[2], "*") || strings.HasPrefix(f[4], "*"),
+	}, nil
+}
+
+// parse returns the bit set of values a field's comma separated list matches
+func (x cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, step := x.min, x.max, 1
+
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = n, part[:i]
+		}
+
+		if part != "*" {
+			var err error
+			r := strings.SplitN(part, "-", 2)
+			if lo, err = x.value(r[0]); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if len(r) == 2 {
+				if hi, err = x.value(r[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				hi = x.max // n/step means from n to the end of the range
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value returns a field value, given as a number or a name
+func (x cronField) value(s string) (int, error) {
+	for i, n := range x.names {
+		if s == n {
+			return i + x.min, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < x.min || v > x.max {
+		return 0, fmt.Errorf("%q isn't between %d and %d", s, x.min, x.max)
+	}
+	return v, nil
+}
+
+// next returns the first time after t the expression matches, or the zero time if it doesn't in the
+// next five years
+func (x *cronExpr) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		switch {
+		case x.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !x.day(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case x.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case x.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// day returns true if t's day matches the day of month and day of week fields; as in cron, when both
+// are restricted either may match
+func (x *cronExpr) day(t time.Time) bool {
+	dom := x.dom&(1<<uint(t.Day())) != 0
+	dow := x.dow&(1<<uint(t.Weekday())) != 0
+	if x.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,148 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseCron(t *testing.T) {
+	Convey("Testing parseCron()", t, func() {
+		tests := []struct {
+			expr string
+			err  string
+			exp  *cronExpr
+		}{
+			{
+				expr: "0 3 * * *",
+				exp:  &cronExpr{minute: 1, hour: 1 << 3, dom: 0xfffffffe, month: 0x1ffe, dow: 0xff, anyDay: true},
+			},
+			{
+				expr: "*/20 1-3,22 1,15 jan-mar mon-fri",
+				exp:  &cronExpr{minute: 1 | 1<<20 | 1<<40, hour: 1<<1 | 1<<2 | 1<<3 | 1<<22, dom: 1<<1 | 1<<15, month: 1<<1 | 1<<2 | 1<<3, dow: 0x3e},
+			},
+			{
+				expr: "@weekly",
+				exp:  &cronExpr{minute: 1, hour: 1, dom: 0xfffffffe, month: 0x1ffe, dow: 1, anyDay: true},
+			},
+			{
+				expr: "30 5/6 * * 7",
+				exp:  &cronExpr{minute: 1 << 30, hour: 1<<5 | 1<<11 | 1<<17 | 1<<23, dom: 0xfffffffe, month: 0x1ffe, dow: 1 | 1<<7, anyDay: true},
+			},
+			{expr: "0 3 * *", err: "want 5 fields, minute hour day-of-month month day-of-week, got 4"},
+			{expr: "60 * * * *", err: `"60" isn't between 0 and 59`},
+			{expr: "0 0 0 * *", err: `"0" isn't between 1 and 31`},
+			{expr: "0 0 * * someday", err: `"someday" isn't between 0 and 7`},
+			{expr: "*/0 * * * *", err: `invalid step in "*/0"`},
+			{expr: "0 9-5 * * *", err: `invalid range "9-5"`},
+		}
+
+		for _, tt := range tests {
+			act, err := parseCron(tt.expr)
+			if tt.err != "" {
+				So(err.Error(), ShouldEqual, tt.err)
+				continue
+			}
+			So(err, ShouldBeNil)
+			So(act, ShouldResemble, tt.exp)
+		}
+	})
+}
+
+func TestCronNext(t *testing.T) {
+	Convey("Testing cronExpr.next()", t, func() {
+		now := time.Date(2026, time.October, 19, 14, 7, 30, 0, time.UTC)
+
+		tests := []struct {
+			expr string
+			exp  time.Time
+		}{
+			{expr: "0 3 * * *", exp: time.Date(2026, time.October, 20, 3, 0, 0, 0, time.UTC)},
+			{expr: "*/15 * * * *", exp: time.Date(2026, time.October, 19, 14, 15, 0, 0, time.UTC)},
+			{expr: "7 14 * * *", exp: time.Date(2026, time.October, 20, 14, 7, 0, 0, time.UTC)},
+			{expr: "@weekly", exp: time.Date(2026, time.October, 25, 0, 0, 0, 0, time.UTC)},
+			{expr: "@monthly", exp: time.Date(2026, time.November, 1, 0, 0, 0, 0, time.UTC)},
+			{expr: "0 0 29 2 *", exp: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+			// both day fields restricted, so the 1st or a Friday
+			{expr: "0 12 1 * fri", exp: time.Date(2026, time.October, 23, 12, 0, 0, 0, time.UTC)},
+			{expr: "0 0 31 feb *", exp: time.Time{}},
+		}
+
+		for _, tt := range tests {
+			x, err := parseCron(tt.expr)
+			So(err, ShouldBeNil)
+			So(x.next(now), ShouldResemble, tt.exp)
+		}
+	})
+}
+
+func TestNextRun(t *testing.T) {
+	Convey("Testing NextRun()", t, func() {
+		defer func(f func(int64) int64) { jitter = f }(jitter)
+		jitter = func(n int64) int64 { return n / 2 }
+
+		now := time.Date(2026, time.October, 19, 14, 7, 30, 0, time.UTC)
+		c := NewConfig(Logger(newLog()))
+		So(c.NextRun(now), ShouldResemble, now.Add(defUpdateInterval))
+
+		So(c.Blacklist(&CFGstatic{Cfg: scheduleCfg}), ShouldBeNil)
+		So(c.sched.interval, ShouldEqual, 6*time.Hour)
+		So(c.sched.jitter, ShouldEqual, 10*time.Minute)
+		So(c.NextRun(now), ShouldResemble, time.Date(2026, time.October, 20, 3, 5, 0, 0, time.UTC))
+
+		var refresh []time.Duration
+		for _, s := range c.tree[domains].src {
+			refresh = append(refresh, s.refresh)
+		}
+		So(refresh, ShouldResemble, []time.Duration{time.Hour, 0})
+
+		Convey("Testing a pause that ends before the next run", func() {
+			dir, err := ioutil.TempDir("", "testBlacklist")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			c.mqttOn()
+			c.mqtt.pause = dir + "/blacklist.pause"
+			until, err := c.Pause(time.Hour)
+			So(err, ShouldBeNil)
+			So(c.NextRun(time.Now()).Equal(until), ShouldBeTrue)
+
+			So(c.Resume(), ShouldBeNil)
+			So(c.NextRun(now), ShouldResemble, time.Date(2026, time.October, 20, 3, 5, 0, 0, time.UTC))
+		})
+
+		Convey("Testing an update-schedule that never matches", func() {
+			c.scheduleLabel(updateCron, "0 0 31 feb *")
+			So(c.NextRun(now), ShouldResemble, now.Add(6*time.Hour+5*time.Minute))
+		})
+
+		Convey("Testing invalid leaves", func() {
+			c := NewConfig(Logger(newLog()))
+			c.scheduleLabel(updateCron, "daily")
+			c.scheduleLabel(updateAt, "0")
+			c.scheduleLabel(updateJitter, "-1")
+			c.refreshLabel(&source{name: "phishing"}, "hourly")
+			So(c.sched, ShouldResemble, &schedule{interval: defUpdateInterval})
+		})
+	})
+}
+
+var scheduleCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	update-interval 360
+	update-jitter 10
+	update-schedule "0 3 * * *"
+	domains {
+		source phishing {
+			refresh-interval 60
+			url http://127.0.0.1:8081/phishing.txt
+		}
+		source static {
+			url http://127.0.0.1:8081/static.txt
+		}
+	}
+}`
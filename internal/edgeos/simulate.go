@@ -0,0 +1,280 @@
+package edgeos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// simObjects are the sources a simulation processes, in the order an update does; URL sources with
+// cached output are read from it as file sources, and the rest are downloaded
+var simObjects = []IFace{PreRObj, PreDObj, PreHObj, ExRtObj, ExDmObj, ExHtObj, FileObj, URLdObj, URLhObj}
+
+// Simulation is how a candidate configuration would change the answers to a query log's names,
+// compared with the current configuration
+type Simulation struct {
+	Queries   int
+	Names     int
+	Blocked   []Change // newly blocked by the candidate
+	Unblocked []Change // blocked now, but not by the candidate
+}
+
+// Change is a client's queries, for names under a registrable domain, whose answers would change
+type Change struct {
+	Client  string
+	Domain  string
+	Names   []string
+	Queries int
+	Sources []string // node/source that blocks them, in whichever configuration does
+}
+
+// Simulate replays the queried names in r, from a dnsmasq query log or a list of names, against the
+// current configuration and a candidate, running each one's include/exclude pipeline offline
+func (c *Config) Simulate(candidate *Config, r io.Reader) (*Simulation, error) {
+	asked, queries, err := queried(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := c.offline()
+	if err != nil {
+		return nil, err
+	}
+	next, err := candidate.offline()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		blocked   = make(map[[2]string]*Change)
+		names     = make(map[string]bool)
+		unblocked = make(map[[2]string]*Change)
+	)
+	for client, counts := range asked {
+		for name, n := range counts {
+			names[name] = true
+			was, before := cur.lookup(name)
+			is, after := next.lookup(name)
+
+			var (
+				changes map[[2]string]*Change
+				src     string
+			)
+			switch {
+			case after && !before:
+				changes, src = blocked, is
+			case before && !after:
+				changes, src = unblocked, was
+			default:
+				continue
+			}
+
+			k := [2]string{client, c.registrable(name)}
+			if changes[k] == nil {
+				changes[k] = &Change{Client: k[0], Domain: k[1]}
+			}
+			x := changes[k]
+			x.Names = append(x.Names, name)
+			x.Queries += n
+			x.Sources = addUnique(x.Sources, src)
+		}
+	}
+
+	return &Simulation{Queries: queries, Names: len(names), Blocked: sortChanges(blocked), Unblocked: sortChanges(unblocked)}, nil
+}
+
+// offline runs the configuration's include/exclude pipeline in a scratch directory, on copies of its
+// sources, and returns the names it blocks; URL sources are read from the output an update last wrote,
+// or downloaded if there isn't any, such as a candidate's new source
+func (c *Config) offline() (*blockers, error) {
+	tmp, err := ioutil.TempDir("", "blacklist")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	var (
+		env  = c.scratchEnv(tmp)
+		prev = c.Env
+		srcs = make(map[string][]*source)
+	)
+	for _, n := range c.sortKeys() {
+		srcs[n] = c.tree[n].src
+		x := make([]*source, len(c.tree[n].src))
+		for i, s := range c.tree[n].src {
+			cp := *s
+			cp.Env = prev
+			if s.ltype == urls {
+				file, prefix := cp.cachedOutput()
+				if _, err := os.Stat(file); err == nil {
+					cp.file, cp.ltype, cp.prefix, cp.url = file, files, prefix, ""
+				} else {
+					c.Log.Infof("%s: no cached output %s to simulate it with, downloading it", s.name, file)
+				}
+			}
+			cp.Env = env
+			x[i] = &cp
+		}
+		c.tree[n].src = x
+	}
+	c.Env = env
+	defer func() {
+		c.Env = prev
+		for n, x := range srcs {
+			c.tree[n].src = x
+		}
+	}()
+
+	for _, iface := range simObjects {
+		ct, err := c.NewContent(iface)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.ProcessContent(ct); err != nil {
+			c.Log.Warningf("%v", err)
+		}
+	}
+	if err = c.Promote(); err != nil {
+		return nil, err
+	}
+
+	b := &blockers{allow: make(map[string]bool), names: make(map[string]blockedName)}
+	for _, name := range c.idx.names() {
+		r, _ := c.idx.get(name)
+		if allow, _ := exportType(r.nType); allow {
+			b.allow[name] = true
+			continue
+		}
+		b.names[name] = blockedName{Node: hitNode(nodeOf(r.nType)), Sources: append([]string{r.src}, r.also...)}
+	}
+	return b, nil
+}
+
+// scratchEnv returns an Env for a simulated run that writes to dir, ignores shrink guards, and counts,
+// indexes and excludes names apart from the configuration's, with no metrics or notifications
+func (c *Config) scratchEnv(dir string) *Env {
+	e := *c.Env
+	e.ctr = ctr{RWMutex: &sync.RWMutex{}, stat: make(stat)}
+	e.conflicts = nil
+	e.Dex = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	e.Dir = dir
+	e.Exc = &list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+	e.force = true
+	e.idx = newIndex()
+	e.metrics = nil
+	e.notes = nil
+	if e.tally != nil {
+		e.tally = newTally()
+	}
+	return &e
+}
+
+// cachedOutput returns the file holding the names a URL source kept in the last update, and the prefix
+// they follow: its own file for the dnsmasq and unbound backends, or the kept names file it saves when
+// its names go to a consolidated file or the pdns script
+func (s *source) cachedOutput() (file, prefix string) {
+	if !s.consolidated() {
+		switch s.output().(type) {
+		case dnsmasqBackend:
+			return s.filename(typeInt(s.nType)), s.Pfx.domain + "/"
+		case unboundBackend:
+			return s.filename(typeInt(s.nType)), `local-zone: "`
+		}
+	}
+	return s.keptFile(), ""
+}
+
+// queried returns each client's query count per name, from a dnsmasq query log or a list of names,
+// one per line, each optionally followed by the client that asked for it
+func queried(r io.Reader) (map[string]map[string]int, int, error) {
+	var (
+		asked = make(map[string]map[string]int)
+		n     int
+		s     = bufio.NewScanner(r)
+	)
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var name, client string
+		if f, _, ok := logLine(line); ok {
+			if len(f) < 4 || !strings.HasPrefix(f[0], "query[") || f[2] != "from" {
+				continue
+			}
+			name, client = f[1], f[3]
+		} else {
+			f := strings.Fields(line)
+			name = f[0]
+			if len(f) > 1 {
+				client = f[1]
+			}
+		}
+		if client == "" {
+			client = "unknown"
+		}
+
+		name = strings.TrimSuffix(strings.ToLower(name), ".")
+		if asked[client] == nil {
+			asked[client] = make(map[string]int)
+		}
+		asked[client][name]++
+		n++
+	}
+	return asked, n, s.Err()
+}
+
+// addUnique appends s to x unless it's already there
+func addUnique(x []string, s string) []string {
+	for _, v := range x {
+		if v == s {
+			return x
+		}
+	}
+	return append(x, s)
+}
+
+// sortChanges returns the changes ordered by client and domain, with their names and sources sorted
+func sortChanges(m map[[2]string]*Change) []Change {
+	x := make([]Change, 0, len(m))
+	for _, v := range m {
+		sort.Strings(v.Names)
+		sort.Strings(v.Sources)
+		x = append(x, *v)
+	}
+	sort.Slice(x, func(i, j int) bool {
+		if x[i].Client != x[j].Client {
+			return x[i].Client < x[j].Client
+		}
+		return x[i].Domain < x[j].Domain
+	})
+	return x
+}
+
+// Write writes the newly blocked and unblocked queries, grouped by client and registrable domain
+func (x *Simulation) Write(w io.Writer) error {
+	fmt.Fprintf(w, "%d queries for %d names: %d groups newly blocked, %d unblocked\n", x.Queries, x.Names, len(x.Blocked), len(x.Unblocked))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	table := func(title string, changes []Change) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(tw, "\n%s\n", title)
+		fmt.Fprintln(tw, "client\tdomain\tqueries\tsources\tnames")
+		for _, c := range changes {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", c.Client, c.Domain, c.Queries, strings.Join(c.Sources, ","), strings.Join(c.Names, " "))
+		}
+	}
+	table("Newly blocked", x.Blocked)
+	table("Unblocked", x.Unblocked)
+	return tw.Flush()
+}
@@ -0,0 +1,177 @@
+package edgeos
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueried(t *testing.T) {
+	Convey("Testing queried()", t, func() {
+		asked, n, err := queried(strings.NewReader(strings.Join([]string{
+			"# names to replay",
+			"Oct 19 10:00:01 dnsmasq[99]: query[A] WWW.Bad.com from 10.0.0.1",
+			"Oct 19 10:00:01 dnsmasq[99]: config www.bad.com is 0.0.0.0",
+			"Oct 19 10:00:02 dnsmasq[99]: 3 10.0.0.2/5353 query[AAAA] tracker.net from 10.0.0.2",
+			"",
+			"cdn.example.com. 10.0.0.1",
+			"example.org",
+		}, "\n")))
+		So(err, ShouldBeNil)
+		So(n, ShouldEqual, 4)
+		So(asked, ShouldResemble, map[string]map[string]int{
+			"10.0.0.1": {"www.bad.com": 1, "cdn.example.com": 1},
+			"10.0.0.2": {"tracker.net": 1},
+			"unknown":  {"example.org": 1},
+		})
+	})
+}
+
+func TestSimulate(t *testing.T) {
+	Convey("Testing Simulate()", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/domains.malware.blacklist.conf", []byte("address=/bad.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/trackers.txt", []byte("tracker.net\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/aggressive.txt", []byte("cdn.example.com\nexample.org\n"), 0644), ShouldBeNil)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, "fresh.net")
+		}))
+		defer server.Close()
+
+		newCfg := func(cfg string) *Config {
+			c := NewConfig(
+				Dir(dir),
+				Ext("blacklist.conf"),
+				FileNameFmt("%v/%v.%v.%v"),
+				Logger(newLog()),
+				Method("GET"),
+				Prefix("address=", "server="),
+			)
+			cfg = strings.Replace(strings.Replace(cfg, "%s", dir, -1), "%u", server.URL, -1)
+			So(c.Blacklist(&CFGstatic{Cfg: cfg}), ShouldBeNil)
+			return c
+		}
+		c, candidate := newCfg(simCurrentCfg), newCfg(simCandidateCfg)
+		c.SetOpt(Collect(true))
+
+		queries := strings.Join([]string{
+			"Oct 19 10:00:01 dnsmasq[99]: query[A] www.bad.com from 10.0.0.1",
+			"Oct 19 10:00:01 dnsmasq[99]: query[A] ok.bad.com from 10.0.0.1",
+			"Oct 19 10:00:02 dnsmasq[99]: query[A] tracker.net from 10.0.0.2",
+			"img.cdn.example.com 10.0.0.1",
+			"cdn.example.com 10.0.0.1",
+			"cdn.example.com 10.0.0.1",
+			"example.org",
+			"fine.net",
+			"fresh.net 10.0.0.3",
+		}, "\n")
+		x, err := c.Simulate(candidate, strings.NewReader(queries))
+		So(err, ShouldBeNil)
+		So(x.Queries, ShouldEqual, 9)
+		So(x.Names, ShouldEqual, 8)
+		So(x.Blocked, ShouldResemble, []Change{
+			{Client: "10.0.0.1", Domain: "example.com", Names: []string{"cdn.example.com", "img.cdn.example.com"}, Queries: 3, Sources: []string{"domains/aggressive"}},
+			{Client: "10.0.0.3", Domain: "fresh.net", Names: []string{"fresh.net"}, Queries: 1, Sources: []string{"domains/fresh"}},
+			{Client: "unknown", Domain: "example.org", Names: []string{"example.org"}, Queries: 1, Sources: []string{"domains/aggressive"}},
+		})
+		So(x.Unblocked, ShouldResemble, []Change{
+			{Client: "10.0.0.1", Domain: "bad.com", Names: []string{"ok.bad.com"}, Queries: 1, Sources: []string{"domains/malware"}},
+			{Client: "10.0.0.2", Domain: "tracker.net", Names: []string{"tracker.net"}, Queries: 1, Sources: []string{"hosts/trackers"}},
+		})
+		So(c.Dir, ShouldEqual, dir)
+
+		Convey("Testing Simulate() leaves the configuration's sources, counts and metrics alone", func() {
+			src := c.tree[domains].src[0]
+			So(src.ltype, ShouldEqual, urls)
+			So(src.url, ShouldEqual, "http://127.0.0.1:8081/malware.txt")
+			So(src.Env, ShouldBeNil)
+			So(c.stat, ShouldBeEmpty)
+			So(c.metrics.src, ShouldBeEmpty)
+		})
+
+		unblocked := x.Unblocked
+		for _, tt := range []struct {
+			name, leaf, file, data string
+		}{
+			{
+				name: "the unbound backend",
+				leaf: "dns-backend unbound",
+				file: "/domains.malware.blacklist.conf",
+				data: "server:\nlocal-zone: \"bad.com.\" redirect\nlocal-data: \"bad.com. A 0.0.0.0\"\n",
+			},
+			{
+				name: "a per-area layout",
+				leaf: "output-layout per-area",
+				file: "/.domains.malware.kept",
+				data: "bad.com\n",
+			},
+		} {
+			tt := tt
+			Convey("Testing Simulate() reads cached output with "+tt.name, func() {
+				So(os.Remove(dir+"/domains.malware.blacklist.conf"), ShouldBeNil)
+				So(ioutil.WriteFile(dir+tt.file, []byte(tt.data), 0644), ShouldBeNil)
+
+				leaf := func(cfg string) string {
+					return strings.Replace(cfg, "disabled false", "disabled false\n\t"+tt.leaf, 1)
+				}
+				x, err := newCfg(leaf(simCurrentCfg)).Simulate(newCfg(leaf(simCandidateCfg)), strings.NewReader(queries))
+				So(err, ShouldBeNil)
+				So(x.Unblocked, ShouldResemble, unblocked)
+			})
+		}
+
+		Convey("Testing Write()", func() {
+			var b bytes.Buffer
+			So(x.Write(&b), ShouldBeNil)
+			act := b.String()
+			So(act, ShouldStartWith, "9 queries for 8 names: 3 groups newly blocked, 2 unblocked\n\nNewly blocked\nclient ")
+			So(act, ShouldContainSubstring, "\nUnblocked\n")
+			So(act, ShouldContainSubstring, fmt.Sprintf("%-10s%-13s%-9s%-20s%s\n", "10.0.0.1", "example.com", "3", "domains/aggressive", "cdn.example.com img.cdn.example.com"))
+		})
+	})
+}
+
+var simCurrentCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		source malware {
+			prefix "0.0.0.0 "
+			url http://127.0.0.1:8081/malware.txt
+		}
+	}
+	hosts {
+		source trackers {
+			file %s/trackers.txt
+		}
+	}
+}`
+
+var simCandidateCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	exclude ok.bad.com
+	domains {
+		source malware {
+			prefix "0.0.0.0 "
+			url http://127.0.0.1:8081/malware.txt
+		}
+		source aggressive {
+			file %s/aggressive.txt
+		}
+		source fresh {
+			url %u/fresh.txt
+		}
+	}
+}`
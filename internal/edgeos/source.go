@@ -9,29 +9,48 @@ import (
 	"sort"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
 
+	"github.com/britannic/blacklist/internal/fqdn"
 	"github.com/britannic/blacklist/internal/regx"
 )
 
+// rejectSample is the number of rejected lines logged per source in debug mode
+const rejectSample = 10
+
 // source struct for normalizing EdgeOS data.
 type source struct {
 	*Env
 	Objects
-	desc     string
-	disabled bool
-	err      error
-	exc      []string
-	file     string
-	inc      []string
-	ip       string
-	iface    IFace
-	ltype    string
-	nType    ntype
-	name     string
-	prefix   string
-	r        io.Reader
-	url      string
+	changeSet  bool // max-change was set on the source
+	desc       string
+	disabled   bool
+	err        error
+	exc        []string
+	fetch      time.Duration
+	file       string
+	homographs []string
+	inc        []string
+	ip         string
+	ip6        string
+	iface      IFace
+	ltype      string
+	maxChange  float64
+	minKeep    int
+	minSet     bool // min-entries was set on the source
+	mode       string
+	nType      ntype
+	name       string
+	prefix     string
+	promote    int
+	protect    []string
+	r          io.Reader
+	refresh    time.Duration // how long a download is used for, in daemon mode
+	refused    []string
+	rejects    fqdn.Report
+	set        string
+	upstream   string
+	url        string
 }
 
 func (s *source) addSource(srcName [][]byte, n string) {
@@ -47,6 +66,12 @@ func (s *source) area() string {
 		return domains
 	case rootNode:
 		return roots
+	case addresses:
+		return addresses
+	case forwarding:
+		return forwarding
+	case policy:
+		return policy
 	}
 	return hosts
 }
@@ -91,15 +116,7 @@ func newSource() *source {
 }
 
 func (s *source) setFilePrefix(format string) string {
-	switch s.nType {
-	case excDomn, preDomn:
-		return fmt.Sprintf(format, domains, s.name)
-	case excHost, preHost:
-		return fmt.Sprintf(format, hosts, s.name)
-	case excRoot, preRoot:
-		return fmt.Sprintf(format, roots, s.name)
-	}
-	return fmt.Sprintf(format, getType(s.nType), s.name)
+	return fmt.Sprintf(format, s.fileArea(), s.name)
 }
 
 func printArray(a []string) (s string) {
@@ -122,13 +139,22 @@ func (s *source) process() *bList {
 	var (
 		area                     = typeInt(s.nType)
 		b                        = bufio.NewScanner(s.r)
+		also                     []string
 		dropped, extracted, kept int
 		find                     = regx.NewRegex()
 		l                        = list{RWMutex: &sync.RWMutex{}, entry: make(entry)}
+		n                        int
 		ok                       bool
+		scanned                  int64
+		start                    = time.Now()
 	)
 
+	s.homographs = nil
+	s.refused = nil
+	s.rejects.Reset()
 	for b.Scan() {
+		n++
+		scanned += int64(len(b.Bytes()) + 1)
 		line := bytes.ToLower(bytes.TrimSpace(b.Bytes()))
 
 		switch {
@@ -136,15 +162,23 @@ func (s *source) process() *bList {
 			continue
 		case bytes.HasPrefix(line, []byte(s.prefix)):
 			if line, ok = find.StripPrefixAndSuffix(line, s.prefix); ok {
-				for _, fqdn := range find.RX[regx.FQDN].FindAll(line, -1) {
+				for _, fqdn := range fqdn.Extract(n, line, &s.rejects) {
 					extracted++
+					if s.refuse(fqdn) || s.flag(fqdn) {
+						dropped++
+						continue
+					}
 					if s.Dex.subKeyExists(fqdn) {
 						dropped++
+						s.metrics.excluded(s.Dex, fqdn)
 						continue
 					}
-					if !s.Exc.keyExists(fqdn) {
+					switch {
+					case l.keyExists(fqdn):
+					case s.Exc.keyExists(fqdn):
+						also = append(also, string(fqdn))
+					default:
 						kept++
-						s.Exc.set(fqdn)
 						l.set(fqdn)
 						continue
 					}
@@ -154,18 +188,49 @@ func (s *source) process() *bList {
 		}
 	}
 
-	switch s.nType {
-	case domn, excDomn, excRoot:
-		s.Dex.merge(&l)
+	s.logRefused()
+	s.logHomographs()
+	s.logRejects()
+	s.metrics.rejected(s, s.rejects)
+	if s.err != nil {
+		scanned = 0
+	}
+	why := s.tripped(kept)
+	if why == "" {
+		lost := s.commit(&l, also)
+		kept -= lost
+		dropped += lost
 	}
+	s.sum(dropped, extracted, kept, scanned, s.fetch+time.Since(start))
 
-	s.sum(area, dropped, extracted, kept)
+	if why != "" {
+		s.Log.Warningf("%s: not published, %s; keeping its previous output, use -force to accept it", s.name, why)
+		s.metrics.guarded(s, why)
+		s.notes.notify(eventGuard, s.area()+"/"+s.name, why, 0)
+		s.restore()
+		return &bList{file: s.filename(area)}
+	}
+
+	return s.publish(&l, kept)
+}
+
+// commit claims the source's kept names in l, once its guards have passed, and records those other
+// sources listed first; it returns the number another source claimed while this one was processed
+func (s *source) commit(l *list, also []string) int {
+	lost := s.Exc.claim(l)
+	for k := range l.entry {
+		s.tally.add(s.nType, []byte(k), s.registrable)
+		s.idx.add([]byte(k), s)
+	}
+	for _, k := range append(also, lost...) {
+		s.idx.also([]byte(k), s)
+	}
 
-	return &bList{
-		file: s.filename(area),
-		r:    formatData(getDnsmasqPrefix(s), &l),
-		size: kept,
+	switch s.nType {
+	case domn, excDomn, excRoot:
+		s.Dex.merge(l)
 	}
+	return len(lost)
 }
 
 // Stringer for *source
@@ -197,12 +262,20 @@ func (s *source) String() string {
 	)
 }
 
-func (s *source) sum(area string, dropped, extracted, kept int) {
+// logRejects logs a summary of the source's rejected tokens and, in debug mode, a sample of them
+func (s *source) logRejects() {
+	if s.rejects.Len() == 0 {
+		return
+	}
+	s.Log.Infof("%s: rejected %d invalid entries (%s)", s.name, s.rejects.Len(), s.rejects.String())
+	for _, r := range s.rejects.Sample(rejectSample) {
+		s.Debug(fmt.Sprintf("%s: rejected %s", s.name, r))
+	}
+}
+
+func (s *source) sum(dropped, extracted, kept int, scanned int64, elapsed time.Duration) {
 	// Let's do some accounting
-	ctr := s.ctr.stat
-	atomic.AddInt32(&ctr[area].dropped, int32(dropped))
-	atomic.AddInt32(&ctr[area].extracted, int32(extracted))
-	atomic.AddInt32(&ctr[area].kept, int32(kept))
+	s.ctr.add(s, dropped, extracted, kept, scanned, elapsed)
 
 	switch {
 	case kept > 0:
@@ -211,5 +284,6 @@ func (s *source) sum(area string, dropped, extracted, kept int) {
 		s.Log.Infof("%s: dropped: %d", s.name, dropped)
 	case extracted > 0 && dropped == extracted:
 		s.Log.Warningf("%s: 0 records processed - check source and/or configuration", s.name)
+		s.metrics.warn(s, "0 records processed")
 	}
 }
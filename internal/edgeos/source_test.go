@@ -1,6 +1,9 @@
 package edgeos
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
@@ -43,3 +46,38 @@ func TestArea(t *testing.T) {
 		}
 	})
 }
+
+func TestProcessRejects(t *testing.T) {
+	Convey("Testing process() rejection report", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		s := &source{
+			Env:    c.Env,
+			ip:     "0.0.0.0",
+			name:   "junk",
+			nType:  host,
+			prefix: "0.0.0.0 ",
+			r: strings.NewReader(`# comment
+0.0.0.0 ads.example.com
+0.0.0.0 -bad.example.com
+0.0.0.0 ads.example.net/#0.0.0.0
+0.0.0.0 ` + strings.Repeat("x", 64) + `.example.org
+0.0.0.0 10.0.0.1
+0.0.0.0 localhost
+0.0.0.0 ads.exa*mple.net`),
+		}
+
+		b, err := ioutil.ReadAll(s.process().r)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, "address=/ads.example.com/0.0.0.0\naddress=/ads.example.net/0.0.0.0\n")
+		So(s.rejects.Len(), ShouldEqual, 5)
+		So(s.rejects.Sample(rejectSample), ShouldResemble, []string{
+			`line 3: "-bad.example.com" (leading hyphen)`,
+			`line 5: "` + strings.Repeat("x", 64) + `.example.org" (label too long)`,
+			`line 6: "10.0.0.1" (IP literal)`,
+			`line 7: "localhost" (not fully qualified)`,
+			`line 8: "ads.exa*mple.net" (invalid character)`,
+		})
+	})
+}
@@ -0,0 +1,165 @@
+package edgeos
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// stats are a source's counts for the current run
+type stats struct {
+	area      string
+	name      string
+	bytes     int64
+	dropped   int32
+	duration  time.Duration
+	extracted int32
+	kept      int32
+}
+
+// Stat is a source's processing statistics, or an area's or the run's totals
+type Stat struct {
+	Area      string
+	Source    string
+	Bytes     int64
+	Dropped   int
+	Duration  time.Duration
+	Extracted int
+	Kept      int
+}
+
+// statKey returns the source's key in ctr.stat, so same named sources in different nodes don't share counts
+func statKey(s *source) string {
+	return typeInt(s.nType) + "/" + s.name
+}
+
+// reset clears the source's counts before it's processed
+func (c ctr) reset(s *source) {
+	c.Lock()
+	c.stat[statKey(s)] = &stats{area: typeInt(s.nType), name: s.name}
+	c.Unlock()
+}
+
+// add accumulates the source's counts
+func (c ctr) add(s *source, dropped, extracted, kept int, scanned int64, elapsed time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	x, ok := c.stat[statKey(s)]
+	if !ok {
+		x = &stats{area: typeInt(s.nType), name: s.name}
+		c.stat[statKey(s)] = x
+	}
+	x.bytes += scanned
+	x.dropped += int32(dropped)
+	x.duration += elapsed
+	x.extracted += int32(extracted)
+	x.kept += int32(kept)
+}
+
+// get returns the source's counts with key k, or zeroes if it hasn't any
+func (c ctr) get(k string) Stat {
+	c.RLock()
+	defer c.RUnlock()
+	if x, ok := c.stat[k]; ok {
+		return x.Stat()
+	}
+	return Stat{}
+}
+
+// Stat returns the counts as a Stat
+func (s *stats) Stat() Stat {
+	return Stat{
+		Area:      s.area,
+		Source:    s.name,
+		Bytes:     s.bytes,
+		Dropped:   int(s.dropped),
+		Duration:  s.duration,
+		Extracted: int(s.extracted),
+		Kept:      int(s.kept),
+	}
+}
+
+// SourceStats returns each processed source's statistics, sorted by area and source
+func (c *Config) SourceStats() []Stat {
+	c.ctr.RLock()
+	x := make([]Stat, 0, len(c.ctr.stat))
+	for _, s := range c.ctr.stat {
+		x = append(x, s.Stat())
+	}
+	c.ctr.RUnlock()
+
+	sort.Slice(x, func(i, j int) bool {
+		if x[i].Area != x[j].Area {
+			return x[i].Area < x[j].Area
+		}
+		return x[i].Source < x[j].Source
+	})
+	return x
+}
+
+// AreaStats returns the totals of each area's sources, sorted by area
+func (c *Config) AreaStats() []Stat {
+	var x []Stat
+	for _, s := range c.SourceStats() {
+		if len(x) == 0 || x[len(x)-1].Area != s.Area {
+			x = append(x, Stat{Area: s.Area})
+		}
+		x[len(x)-1].plus(s)
+	}
+	return x
+}
+
+// TotalStats returns the totals of the processed sources whose kept entries are blocked
+func (c *Config) TotalStats() Stat {
+	var t Stat
+	for _, s := range c.SourceStats() {
+		if blocks(s.Area) {
+			t.plus(s)
+		}
+	}
+	return t
+}
+
+// blocks returns true if an area's kept entries are blocked, rather than excluded, routed or forwarded
+func blocks(area string) bool {
+	switch typeStr(area) {
+	case domn, host, root, preDomn, preHost, preRoot:
+		return true
+	}
+	return false
+}
+
+// plus adds s's counts to t
+func (t *Stat) plus(s Stat) {
+	t.Bytes += s.Bytes
+	t.Dropped += s.Dropped
+	t.Duration += s.Duration
+	t.Extracted += s.Extracted
+	t.Kept += s.Kept
+}
+
+// WriteStats writes a table of each source's statistics, followed by area and run totals
+func (c *Config) WriteStats(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "area\tsource\textracted\tkept\tdropped\tbytes\ttime")
+
+	row := func(s Stat) {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%v\n",
+			s.Area, s.Source, s.Extracted, s.Kept, s.Dropped, s.Bytes, s.Duration.Round(time.Millisecond))
+	}
+
+	for _, s := range c.SourceStats() {
+		row(s)
+	}
+	for _, s := range c.AreaStats() {
+		s.Source = all
+		row(s)
+	}
+	t := c.TotalStats()
+	t.Area = total
+	row(t)
+	return tw.Flush()
+}
@@ -0,0 +1,149 @@
+package edgeos
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStats(t *testing.T) {
+	Convey("Testing per source statistics", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/malware.txt", []byte("bad.com\nworse.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/ads.txt", []byte("ads.com\nads.com\nmore-ads.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/trackers.txt", []byte("tracker.net\n"), 0644), ShouldBeNil)
+
+		So(c.TotalStats(), ShouldResemble, Stat{})
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(statsCfg, dir, dir, dir)}), ShouldBeNil)
+
+		ct, err := c.NewContent(FileObj)
+		So(err, ShouldBeNil)
+		So(c.ProcessContent(ct), ShouldBeNil)
+
+		counts := func(x []Stat) []Stat {
+			for i := range x {
+				So(x[i].Duration, ShouldBeGreaterThan, 0)
+				x[i].Duration = 0
+			}
+			return x
+		}
+
+		So(counts(c.SourceStats()), ShouldResemble, []Stat{
+			{Area: domains, Source: "ads", Bytes: 29, Dropped: 1, Extracted: 3, Kept: 2},
+			{Area: domains, Source: "malware", Bytes: 18, Extracted: 2, Kept: 2},
+			{Area: hosts, Source: "trackers", Bytes: 12, Extracted: 1, Kept: 1},
+		})
+
+		So(counts(c.AreaStats()), ShouldResemble, []Stat{
+			{Area: domains, Bytes: 47, Dropped: 1, Extracted: 5, Kept: 4},
+			{Area: hosts, Bytes: 12, Extracted: 1, Kept: 1},
+		})
+
+		tot := c.TotalStats()
+		tot.Duration = 0
+		So(tot, ShouldResemble, Stat{Bytes: 59, Dropped: 1, Extracted: 6, Kept: 5})
+
+		dropped, extracted, kept := c.GetTotalStats()
+		So([]int32{dropped, extracted, kept}, ShouldResemble, []int32{1, 6, 5})
+
+		Convey("Testing WriteStats()", func() {
+			var b bytes.Buffer
+			So(c.WriteStats(&b), ShouldBeNil)
+			lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+			So(lines, ShouldHaveLength, 7)
+			So(strings.Fields(lines[0]), ShouldResemble, []string{"area", "source", "extracted", "kept", "dropped", "bytes", "time"})
+			So(strings.Fields(lines[1])[:6], ShouldResemble, []string{domains, "ads", "3", "2", "1", "29"})
+			So(strings.Fields(lines[4])[:6], ShouldResemble, []string{domains, all, "5", "4", "1", "47"})
+			So(strings.Fields(lines[6])[:5], ShouldResemble, []string{total, "6", "5", "1", "59"})
+		})
+
+		Convey("Testing the run report uses the same counts", func() {
+			c.SetOpt(Collect(true))
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.RunDone(true), ShouldBeNil)
+
+			r := c.Report("", "")
+			So(r.Sources, ShouldHaveLength, 3)
+			for i, s := range c.SourceStats() {
+				So([]int{r.Sources[i].Extracted, r.Sources[i].Kept, r.Sources[i].Dropped}, ShouldResemble, []int{s.Extracted, s.Kept, s.Dropped})
+			}
+			So(r.Blocked, ShouldEqual, c.TotalStats().Kept)
+		})
+
+		Convey("Reprocessing a source replaces its statistics", func() {
+			ct, err := c.NewContent(FileObj)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+			So(c.SourceStats(), ShouldHaveLength, 3)
+			So(c.TotalStats().Extracted, ShouldEqual, 6)
+		})
+	})
+}
+
+func TestTotalStatsSideSources(t *testing.T) {
+	Convey("Testing TotalStats() leaves out forwarding sources", t, func() {
+		dir, err := ioutil.TempDir("", "testBlacklist")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		So(ioutil.WriteFile(dir+"/corp.txt", []byte("corp.com\nwww.corp.com\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/lab.txt", []byte("zone lab.net\n"), 0644), ShouldBeNil)
+
+		c := NewConfig(
+			Dir(dir),
+			Ext("blacklist.conf"),
+			FileNameFmt("%v/%v.%v.%v"),
+			Logger(newLog()),
+			Prefix("address=", "server="),
+		)
+		So(c.Blacklist(&CFGstatic{Cfg: fmt.Sprintf(forwardingCfg, dir, dir)}), ShouldBeNil)
+
+		for _, iface := range []IFace{PreDObj, PreHObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+		blocked := c.TotalStats()
+		So(blocked.Kept, ShouldEqual, 3)
+
+		So(c.Forwarding(), ShouldBeNil)
+		var fwds int
+		for _, s := range c.SourceStats() {
+			if s.Area == forwarding {
+				fwds++
+			}
+		}
+		So(fwds, ShouldBeGreaterThan, 0)
+		So(c.TotalStats(), ShouldResemble, blocked)
+
+		dropped, extracted, kept := c.GetTotalStats()
+		So([]int{int(dropped), int(extracted), int(kept)}, ShouldResemble, []int{blocked.Dropped, blocked.Extracted, blocked.Kept})
+	})
+}
+
+var statsCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	domains {
+		source malware {
+			file %s/malware.txt
+		}
+		source ads {
+			file %s/ads.txt
+		}
+	}
+	hosts {
+		source trackers {
+			file %s/trackers.txt
+		}
+	}
+}`
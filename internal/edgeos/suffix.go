@@ -0,0 +1,100 @@
+package edgeos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/britannic/blacklist/internal/psl"
+)
+
+const (
+	pslExempt = "public-suffix-exempt"
+	pslFile   = "public-suffix-file"
+)
+
+// suffixGuard refuses public suffixes (TLDs and eTLDs) as blacklist entries
+type suffixGuard struct {
+	exempt entry
+	list   *psl.List
+}
+
+// guard returns the configured suffixGuard, creating it on first use
+func (e *Env) guard() *suffixGuard {
+	if e.psl == nil {
+		e.psl = &suffixGuard{exempt: make(entry), list: psl.Default()}
+	}
+	return e.psl
+}
+
+// pslLabel sets the blacklist node's Public Suffix List leaves
+func (c *Config) pslLabel(leaf, val string) {
+	switch leaf {
+	case pslExempt:
+		c.guard().exempt[normalize(val)] = struct{}{}
+	case pslFile:
+		l, err := psl.Load(val)
+		if err != nil {
+			if c.Log != nil {
+				c.Log.Warningf("Using the built-in Public Suffix List, %v", err)
+			}
+			return
+		}
+		c.guard().list = l
+	}
+}
+
+// exemptions returns the sorted public suffix exemptions
+func (e *Env) exemptions() (s []string) {
+	if e.psl == nil {
+		return s
+	}
+	for k := range e.psl.exempt {
+		s = append(s, k)
+	}
+	sort.Strings(s)
+	return s
+}
+
+// isPublicSuffix returns true if fqdn is a public suffix that hasn't been exempted
+func (e *Env) isPublicSuffix(fqdn []byte) bool {
+	g := e.psl
+	if g == nil {
+		return psl.IsPublicSuffix(string(fqdn))
+	}
+	if _, ok := g.exempt[string(fqdn)]; ok {
+		return false
+	}
+	return g.list.IsPublicSuffix(string(fqdn))
+}
+
+// registrable returns the registrable domain (eTLD+1) of h
+func (e *Env) registrable(h string) string {
+	if e.psl == nil {
+		return psl.Registrable(h)
+	}
+	return e.psl.list.Registrable(h)
+}
+
+// refuse returns true if fqdn must not be blacklisted by source s, because it's a public suffix
+func (s *source) refuse(fqdn []byte) bool {
+	switch s.nType {
+	case excDomn, excHost, excRoot:
+		return false
+	}
+	if !s.isPublicSuffix(fqdn) {
+		return false
+	}
+	s.refused = append(s.refused, string(fqdn))
+	return true
+}
+
+// logRefused logs the public suffixes refused by source s
+func (s *source) logRefused() {
+	if len(s.refused) == 0 {
+		return
+	}
+	sort.Strings(s.refused)
+	s.Log.Warningf("%s: refused %d public suffix entries: %s", s.name, len(s.refused), strings.Join(s.refused, ", "))
+	s.Debug(fmt.Sprintf("%s: add entries to %s to override", s.name, pslExempt))
+}
@@ -0,0 +1,66 @@
+package edgeos
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIsPublicSuffix(t *testing.T) {
+	Convey("Testing isPublicSuffix()", t, func() {
+		e := &Env{}
+		So(e.isPublicSuffix([]byte("co.uk")), ShouldBeTrue)
+		So(e.isPublicSuffix([]byte("bbc.co.uk")), ShouldBeFalse)
+		So(e.registrable("news.bbc.co.uk"), ShouldEqual, "bbc.co.uk")
+
+		e.guard().exempt["co.uk"] = struct{}{}
+		So(e.isPublicSuffix([]byte("co.uk")), ShouldBeFalse)
+		So(e.exemptions(), ShouldResemble, []string{"co.uk"})
+	})
+}
+
+func TestRefuse(t *testing.T) {
+	Convey("Testing public suffix refusal", t, func() {
+		c, dir := newTestConfig()
+		defer os.RemoveAll(dir)
+
+		So(c.Blacklist(&CFGstatic{Cfg: pslCfg}), ShouldBeNil)
+		So(c.exemptions(), ShouldResemble, []string{"github.io"})
+
+		for _, iface := range []IFace{ExDmObj, PreDObj} {
+			ct, err := c.NewContent(iface)
+			So(err, ShouldBeNil)
+			So(c.ProcessContent(ct), ShouldBeNil)
+		}
+
+		act, err := ioutil.ReadFile(dir + "/domains.blacklisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "address=/ads.example.com/0.0.0.0\naddress=/github.io/0.0.0.0\n")
+
+		act, err = ioutil.ReadFile(dir + "/domains.whitelisted-subdomains.blacklist.conf")
+		So(err, ShouldBeNil)
+		So(string(act), ShouldEqual, "server=/com.au/#\n")
+
+		Convey("Testing refuse() keeps excludes", func() {
+			s := &source{Env: c.Env, nType: excDomn}
+			So(s.refuse([]byte("co.uk")), ShouldBeFalse)
+			s.nType = domn
+			So(s.refuse([]byte("co.uk")), ShouldBeTrue)
+			So(s.refused, ShouldResemble, []string{"co.uk"})
+		})
+	})
+}
+
+var pslCfg = `blacklist {
+	disabled false
+	dns-redirect-ip 0.0.0.0
+	public-suffix-exempt github.io
+	domains {
+		exclude com.au
+		include co.uk
+		include github.io
+		include ads.example.com
+	}
+}`
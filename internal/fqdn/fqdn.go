@@ -0,0 +1,141 @@
+// Package fqdn validates and extracts fully qualified domain names according to RFC 1035 and RFC 1123
+package fqdn
+
+import (
+	"bytes"
+	"net"
+)
+
+// Reason explains why a token isn't a valid domain name
+type Reason int
+
+// Reasons for rejecting a token
+const (
+	OK             Reason = iota // Valid domain name
+	Empty                        // Zero length token
+	TooLong                      // Name longer than 253 characters
+	LabelTooLong                 // Label longer than 63 characters
+	EmptyLabel                   // e.g. "ads..example.com" or ".example.com"
+	LeadingHyphen                // Label starts with a hyphen
+	TrailingHyphen               // Label ends with a hyphen
+	InvalidChar                  // e.g. '/', '#', ':' or '*'
+	NonASCII                     // Unicode names must be converted to punycode first
+	IPLiteral                    // IPv4 or IPv6 address
+	SingleLabel                  // e.g. "localhost"
+	NumericTLD                   // e.g. "example.123"
+	BadIDN                       // Unicode name that can't be converted to punycode
+)
+
+const (
+	// MaxName is the maximum length of a domain name in presentation format
+	MaxName = 253
+	// MaxLabel is the maximum length of a domain name label
+	MaxLabel = 63
+)
+
+// String returns a human readable Reason
+func (r Reason) String() string {
+	switch r {
+	case OK:
+		return "ok"
+	case Empty:
+		return "empty"
+	case TooLong:
+		return "name too long"
+	case LabelTooLong:
+		return "label too long"
+	case EmptyLabel:
+		return "empty label"
+	case LeadingHyphen:
+		return "leading hyphen"
+	case TrailingHyphen:
+		return "trailing hyphen"
+	case InvalidChar:
+		return "invalid character"
+	case NonASCII:
+		return "non-ASCII name"
+	case IPLiteral:
+		return "IP literal"
+	case SingleLabel:
+		return "not fully qualified"
+	case NumericTLD:
+		return "numeric TLD"
+	case BadIDN:
+		return "invalid IDN"
+	}
+	return "unknown"
+}
+
+// Validate returns OK if b is a fully qualified domain name; a single trailing root dot is accepted.
+// Underscores are accepted, since they're valid in DNS names (RFC 2181) and common in tracking hosts.
+func Validate(b []byte) Reason {
+	b = bytes.TrimSuffix(b, []byte("."))
+
+	switch {
+	case len(b) == 0:
+		return Empty
+	case net.ParseIP(string(b)) != nil:
+		return IPLiteral
+	case len(b) > MaxName:
+		return TooLong
+	}
+
+	var (
+		labels  int
+		numeric = true
+		start   int
+	)
+
+	for i := 0; i <= len(b); i++ {
+		if i < len(b) && b[i] != '.' {
+			switch c := b[i]; {
+			case c >= 0x80:
+				return NonASCII
+			case !isLDH(c):
+				return InvalidChar
+			}
+			continue
+		}
+
+		label := b[start:i]
+		switch {
+		case len(label) == 0:
+			return EmptyLabel
+		case len(label) > MaxLabel:
+			return LabelTooLong
+		case label[0] == '-':
+			return LeadingHyphen
+		case label[len(label)-1] == '-':
+			return TrailingHyphen
+		}
+		numeric = isNumeric(label)
+		labels++
+		start = i + 1
+	}
+
+	switch {
+	case labels < 2:
+		return SingleLabel
+	case numeric:
+		return NumericTLD
+	}
+	return OK
+}
+
+// isLDH returns true for letters, digits, hyphens and underscores
+func isLDH(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		return true
+	}
+	return false
+}
+
+func isNumeric(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
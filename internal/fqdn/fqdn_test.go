@@ -0,0 +1,46 @@
+package fqdn
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidate(t *testing.T) {
+	Convey("Testing Validate()", t, func() {
+		tests := []struct {
+			exp  Reason
+			name string
+		}{
+			{name: "ads.example.com", exp: OK},
+			{name: "ads.example.com.", exp: OK},
+			{name: "___id___.c.mystat-in.net", exp: OK},
+			{name: "xn--80ak6aa92e.com", exp: OK},
+			{name: "a.xn--p1ai", exp: OK},
+			{name: "", exp: Empty},
+			{name: ".", exp: Empty},
+			{name: strings.Repeat("a.", 126) + "com", exp: TooLong},
+			{name: strings.Repeat("a", 64) + ".com", exp: LabelTooLong},
+			{name: strings.Repeat("a", 63) + ".com", exp: OK},
+			{name: "ads..example.com", exp: EmptyLabel},
+			{name: ".example.com", exp: EmptyLabel},
+			{name: "-ads.example.com", exp: LeadingHyphen},
+			{name: "ads-.example.com", exp: TrailingHyphen},
+			{name: "ads.example.com/0.0.0.0", exp: InvalidChar},
+			{name: "ads.example.com#", exp: InvalidChar},
+			{name: "*.example.com", exp: InvalidChar},
+			{name: "ads.example.com:443", exp: InvalidChar},
+			{name: "bücher.de", exp: NonASCII},
+			{name: "127.0.0.1", exp: IPLiteral},
+			{name: "::1", exp: IPLiteral},
+			{name: "localhost", exp: SingleLabel},
+			{name: "example.123", exp: NumericTLD},
+		}
+
+		for _, tt := range tests {
+			So(Validate([]byte(tt.name)).String(), ShouldEqual, tt.exp.String())
+		}
+		So(Reason(99).String(), ShouldEqual, "unknown")
+	})
+}
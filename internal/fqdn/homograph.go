@@ -0,0 +1,108 @@
+package fqdn
+
+import (
+	"strings"
+	"unicode"
+)
+
+// scripts are the Unicode scripts considered when looking for mixed-script labels
+var scripts = map[string]*unicode.RangeTable{
+	"Arabic":   unicode.Arabic,
+	"Armenian": unicode.Armenian,
+	"Bopomofo": unicode.Bopomofo,
+	"Cyrillic": unicode.Cyrillic,
+	"Georgian": unicode.Georgian,
+	"Greek":    unicode.Greek,
+	"Han":      unicode.Han,
+	"Hangul":   unicode.Hangul,
+	"Hebrew":   unicode.Hebrew,
+	"Hiragana": unicode.Hiragana,
+	"Katakana": unicode.Katakana,
+	"Latin":    unicode.Latin,
+	"Thai":     unicode.Thai,
+}
+
+// cjk lists the script combinations UTS #39 allows in a single label ("highly restrictive")
+var cjk = []map[string]bool{
+	{"Latin": true, "Han": true, "Hiragana": true, "Katakana": true}, // Japanese
+	{"Latin": true, "Han": true, "Hangul": true},                     // Korean
+	{"Latin": true, "Han": true, "Bopomofo": true},                   // Chinese
+}
+
+// confusables maps characters to the Latin letter or digit they're commonly mistaken for,
+// a small subset of the Unicode confusables data covering the usual phishing lookalikes
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'ѕ': 's', 'т': 't', 'у': 'y', 'х': 'x',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ү': 'y', 'ӏ': 'l',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin lookalikes
+	'ı': 'i', 'ł': 'l', 'ǀ': 'l', 'ɑ': 'a', 'ɡ': 'g', 'ɩ': 'i', 'ʏ': 'y',
+}
+
+// script returns the name of r's script, or "" for common characters such as digits and hyphens
+func script(r rune) string {
+	for k, t := range scripts {
+		if unicode.Is(t, r) {
+			return k
+		}
+	}
+	return ""
+}
+
+// allowed returns true if the scripts found in a label may be legitimately mixed
+func allowed(found map[string]bool) bool {
+	if len(found) < 2 {
+		return true
+	}
+NEXT:
+	for _, a := range cjk {
+		for k := range found {
+			if !a[k] {
+				continue NEXT
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// MixedScript returns true if any label of name, decoded from punycode, mixes scripts
+// other than the combinations used by Chinese, Japanese and Korean
+func MixedScript(name string) bool {
+	for _, l := range strings.Split(ToUnicode(name), ".") {
+		found := make(map[string]bool)
+		for _, r := range l {
+			if s := script(r); s != "" {
+				found[s] = true
+			}
+		}
+		if !allowed(found) {
+			return true
+		}
+	}
+	return false
+}
+
+// Skeleton returns the lower case form of name with confusable characters replaced by their Latin lookalikes
+func Skeleton(name string) string {
+	return strings.Map(func(r rune) rune {
+		if c, ok := confusables[r]; ok {
+			return c
+		}
+		return r
+	}, strings.ToLower(ToUnicode(name)))
+}
+
+// Confusable returns true if name, or one of its parent domains, looks like brand without being brand
+func Confusable(name, brand string) bool {
+	if name == brand || strings.HasSuffix(name, "."+brand) {
+		return false
+	}
+	s, b := Skeleton(name), Skeleton(brand)
+	return s == b || strings.HasSuffix(s, "."+b)
+}
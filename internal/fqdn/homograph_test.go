@@ -0,0 +1,38 @@
+package fqdn
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMixedScript(t *testing.T) {
+	Convey("Testing MixedScript()", t, func() {
+		tests := []struct {
+			exp  bool
+			name string
+		}{
+			{name: "apple.com", exp: false},
+			{name: "xn--bcher-kva.de", exp: false},        // bücher.de
+			{name: "xn--e1afmkfd.xn--p1ai", exp: false},   // пример.рф
+			{name: "xn--eckwd4c7cu47r2wf.jp", exp: false}, // ドメイン名例.jp
+			{name: "xn--pple-43d.com", exp: true},         // Cyrillic а + Latin pple
+			{name: "xn--pypal-4ve.com", exp: true},        // Cyrillic а in paypal
+		}
+
+		for _, tt := range tests {
+			So(MixedScript(tt.name), ShouldEqual, tt.exp)
+		}
+	})
+}
+
+func TestConfusable(t *testing.T) {
+	Convey("Testing Skeleton() and Confusable()", t, func() {
+		So(Skeleton("xn--80ak6aa92e.com"), ShouldEqual, "apple.com")
+		So(Confusable("xn--80ak6aa92e.com", "apple.com"), ShouldBeTrue)
+		So(Confusable("login.xn--pypal-4ve.com", "paypal.com"), ShouldBeTrue)
+		So(Confusable("paypal.com", "paypal.com"), ShouldBeFalse)
+		So(Confusable("www.paypal.com", "paypal.com"), ShouldBeFalse)
+		So(Confusable("xn--bcher-kva.de", "paypal.com"), ShouldBeFalse)
+	})
+}
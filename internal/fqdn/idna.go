@@ -0,0 +1,59 @@
+package fqdn
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// profile maps names for lookup according to IDNA 2008 and UTS #46 non-transitional processing,
+// so clients and blacklist entries agree on the punycode form, e.g. "faß.de" => "xn--fa-hia.de";
+// idna.New defaults to non-transitional and this x/net release's Transitional() ignores its argument
+var profile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+)
+
+// isASCII returns true if b doesn't need IDNA processing
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// ToASCII returns the lower case punycode (A-label) form of b; ASCII names are returned unchanged
+func ToASCII(b []byte) ([]byte, error) {
+	if isASCII(b) {
+		return b, nil
+	}
+	s, err := profile.ToASCII(string(b))
+	if err != nil {
+		return b, err
+	}
+	return []byte(strings.ToLower(s)), nil
+}
+
+// ToUnicode returns the Unicode (U-label) form of an ASCII name, or s if it can't be decoded
+func ToUnicode(s string) string {
+	if !strings.Contains(s, "xn--") {
+		return s
+	}
+	u, err := idna.Punycode.ToUnicode(s)
+	if err != nil {
+		return s
+	}
+	return u
+}
+
+// IsIDN returns true if name has at least one punycode label
+func IsIDN(name string) bool {
+	for _, l := range strings.Split(name, ".") {
+		if strings.HasPrefix(l, "xn--") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package fqdn
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestToASCII(t *testing.T) {
+	Convey("Testing ToASCII()", t, func() {
+		tests := []struct {
+			err  bool
+			exp  string
+			name string
+		}{
+			{name: "ads.example.com", exp: "ads.example.com"},
+			{name: "Bücher.de", exp: "xn--bcher-kva.de"},
+			{name: "faß.de", exp: "xn--fa-hia.de"},
+			{name: "пример.рф", exp: "xn--e1afmkfd.xn--p1ai"},
+			{name: "日本語.jp", exp: "xn--wgv71a119e.jp"},
+			{name: "-ü.de", err: true},
+			{name: "a‮b.com", err: true},
+		}
+
+		for _, tt := range tests {
+			act, err := ToASCII([]byte(tt.name))
+			So(err != nil, ShouldEqual, tt.err)
+			if !tt.err {
+				So(string(act), ShouldEqual, tt.exp)
+				So(Validate(act), ShouldEqual, OK)
+			}
+		}
+	})
+}
+
+func TestToUnicode(t *testing.T) {
+	Convey("Testing ToUnicode() and IsIDN()", t, func() {
+		So(ToUnicode("xn--bcher-kva.de"), ShouldEqual, "bücher.de")
+		So(ToUnicode("ads.example.com"), ShouldEqual, "ads.example.com")
+		So(IsIDN("www.xn--bcher-kva.de"), ShouldBeTrue)
+		So(IsIDN("www.bxn--cher.de"), ShouldBeFalse)
+	})
+}
+
+func TestExtractIDN(t *testing.T) {
+	Convey("Testing Extract() with Unicode names", t, func() {
+		var r Report
+		names := Extract(3, []byte("0.0.0.0 bücher.de -ü.de"), &r)
+		So(len(names), ShouldEqual, 1)
+		So(string(names[0]), ShouldEqual, "xn--bcher-kva.de")
+		So(r.String(), ShouldEqual, "invalid IDN: 1")
+	})
+}
@@ -0,0 +1,144 @@
+package fqdn
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Lexer splits a line of source data into candidate domain name tokens
+type Lexer struct {
+	line []byte
+	pos  int
+}
+
+// Reject records a token that failed validation
+type Reject struct {
+	Line   int    `json:"line"`
+	Token  string `json:"token"`
+	Reason Reason `json:"-"`
+	Why    string `json:"reason"`
+}
+
+// MaxRejects is the number of rejected tokens a Report keeps; beyond it, only the counts by reason grow
+const MaxRejects = 100
+
+// Report collects a source's rejected tokens, keeping the first MaxRejects and counting all of them by reason
+type Report struct {
+	Total   int            `json:"total"`
+	Reasons map[string]int `json:"reasons"`
+	Rejects []Reject       `json:"rejects"`
+}
+
+// NewLexer returns a *Lexer for line
+func NewLexer(line []byte) *Lexer {
+	return &Lexer{line: line}
+}
+
+// isSep returns true for bytes that separate tokens in hosts, domain and adblock style lists
+func isSep(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '\v', '\f', ',', ';', '|', '^', '"', '\'':
+		return true
+	}
+	return false
+}
+
+// notSep returns true for runes that aren't token separators
+func notSep(c rune) bool {
+	return c >= 0x80 || !isSep(byte(c))
+}
+
+// Next returns the next token, or nil when the line is exhausted
+func (l *Lexer) Next() []byte {
+	for l.pos < len(l.line) && isSep(l.line[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	for l.pos < len(l.line) && !isSep(l.line[l.pos]) {
+		l.pos++
+	}
+	if start == l.pos {
+		return nil
+	}
+	return l.line[start:l.pos]
+}
+
+// Tokens returns all of a line's tokens
+func Tokens(line []byte) (t [][]byte) {
+	l := NewLexer(line)
+	for tok := l.Next(); tok != nil; tok = l.Next() {
+		t = append(t, tok)
+	}
+	return t
+}
+
+// Add records a rejected token found on line n
+func (r *Report) Add(n int, tok []byte, why Reason) {
+	if r.Reasons == nil {
+		r.Reasons = make(map[string]int)
+	}
+	r.Total++
+	r.Reasons[why.String()]++
+	if len(r.Rejects) < MaxRejects {
+		r.Rejects = append(r.Rejects, Reject{Line: n, Token: string(tok), Reason: why, Why: why.String()})
+	}
+}
+
+// Len returns the number of rejected tokens
+func (r *Report) Len() int {
+	if r == nil {
+		return 0
+	}
+	return r.Total
+}
+
+// Reset clears the report, leaving any copy of it untouched
+func (r *Report) Reset() {
+	*r = Report{}
+}
+
+// Sample returns up to n rejected tokens formatted with their line numbers and reasons
+func (r *Report) Sample(n int) (s []string) {
+	for i, x := range r.Rejects {
+		if i == n {
+			break
+		}
+		s = append(s, fmt.Sprintf("line %d: %q (%s)", x.Line, x.Token, x.Why))
+	}
+	return s
+}
+
+// String summarizes rejections by reason, e.g. "IP literal: 2, invalid character: 1"
+func (r *Report) String() string {
+	var a []string
+	for k, v := range r.Reasons {
+		a = append(a, fmt.Sprintf("%s: %d", k, v))
+	}
+	sort.Strings(a)
+	return strings.Join(a, ", ")
+}
+
+// Extract returns the valid domain names on line n, recording rejected tokens in r; a hosts file line's
+// leading address is skipped, and Unicode names are converted to punycode
+func Extract(n int, line []byte, r *Report) (names [][]byte) {
+	var err error
+	l := NewLexer(line)
+	for i, tok := 0, l.Next(); tok != nil; i, tok = i+1, l.Next() {
+		if i == 0 && net.ParseIP(string(tok)) != nil && bytes.IndexFunc(line[l.pos:], notSep) >= 0 {
+			continue
+		}
+		if tok, err = ToASCII(tok); err != nil {
+			r.Add(n, tok, BadIDN)
+			continue
+		}
+		if why := Validate(tok); why != OK {
+			r.Add(n, tok, why)
+			continue
+		}
+		names = append(names, bytes.TrimSuffix(tok, []byte(".")))
+	}
+	return names
+}
@@ -0,0 +1,80 @@
+package fqdn
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokens(t *testing.T) {
+	Convey("Testing Tokens()", t, func() {
+		tests := []struct {
+			exp  []string
+			line string
+		}{
+			{line: "ads.example.com", exp: []string{"ads.example.com"}},
+			{line: "  a.com\tb.com  ", exp: []string{"a.com", "b.com"}},
+			{line: "||ads.example.com^", exp: []string{"ads.example.com"}},
+			{line: `"a.com", 'b.com'; c.com`, exp: []string{"a.com", "b.com", "c.com"}},
+			{line: "", exp: nil},
+		}
+
+		for _, tt := range tests {
+			var act []string
+			for _, tok := range Tokens([]byte(tt.line)) {
+				act = append(act, string(tok))
+			}
+			So(act, ShouldResemble, tt.exp)
+		}
+	})
+}
+
+func TestExtract(t *testing.T) {
+	Convey("Testing Extract()", t, func() {
+		var r Report
+
+		names := Extract(7, []byte("ads.example.com. 127.0.0.1 bad/ads.net#x localhost"), &r)
+		So(len(names), ShouldEqual, 1)
+		So(string(names[0]), ShouldEqual, "ads.example.com")
+
+		So(r.Len(), ShouldEqual, 3)
+		So(r.String(), ShouldEqual, "IP literal: 1, invalid character: 1, not fully qualified: 1")
+		So(r.Sample(2), ShouldResemble, []string{
+			`line 7: "127.0.0.1" (IP literal)`,
+			`line 7: "bad/ads.net#x" (invalid character)`,
+		})
+
+		Convey("Testing a hosts file line's leading address is skipped", func() {
+			var r Report
+			for _, line := range []string{"127.0.0.1 ads.example.com", "::1\tads.example.net # comment"} {
+				names := Extract(1, []byte(line), &r)
+				So(names, ShouldHaveLength, 1)
+			}
+			So(Extract(2, []byte("10.0.0.1 "), &r), ShouldBeEmpty)
+			So(r.Sample(MaxRejects), ShouldResemble, []string{
+				`line 1: "#" (invalid character)`,
+				`line 1: "comment" (not fully qualified)`,
+				`line 2: "10.0.0.1" (IP literal)`,
+			})
+		})
+
+		Convey("Testing only MaxRejects rejects are kept", func() {
+			var r Report
+			for i := 0; i < MaxRejects+5; i++ {
+				Extract(i, []byte("ads.example.com localhost"), &r)
+			}
+			So(r.Len(), ShouldEqual, MaxRejects+5)
+			So(r.Rejects, ShouldHaveLength, MaxRejects)
+			So(r.String(), ShouldEqual, fmt.Sprintf("not fully qualified: %d", MaxRejects+5))
+		})
+
+		c := r
+		r.Reset()
+		So(r.Len(), ShouldEqual, 0)
+		So(c.Len(), ShouldEqual, 3)
+
+		var nilReport *Report
+		So(nilReport.Len(), ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,73 @@
+// +build ignore
+
+// gen.go regenerates table.go from the Public Suffix List, run it with go generate
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	in  = flag.String("i", "https://publicsuffix.org/list/public_suffix_list.dat", "Public Suffix List URL or file")
+	out = flag.String("o", "table.go", "Output file")
+)
+
+func main() {
+	flag.Parse()
+
+	var (
+		buf bytes.Buffer
+		err error
+		r   io.ReadCloser
+	)
+
+	switch {
+	case strings.HasPrefix(*in, "http"):
+		var resp *http.Response
+		if resp, err = http.Get(*in); err != nil {
+			log.Fatal(err)
+		}
+		r = resp.Body
+	default:
+		if r, err = os.Open(*in); err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer r.Close()
+
+	fmt.Fprintf(&buf, "// Code generated by \"go run gen.go\"; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package psl\n\n")
+	fmt.Fprintf(&buf, "// table holds the Public Suffix List rules, see https://publicsuffix.org/list/\n")
+	fmt.Fprintf(&buf, "const table = `")
+
+	b := bufio.NewScanner(r)
+	for b.Scan() {
+		line := strings.TrimSpace(b.Text())
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s\n", line)
+	}
+	if err = b.Err(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(&buf, "`\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(*out, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Package psl provides Public Suffix List lookups used to guard against blacklisting TLDs and eTLDs
+package psl
+
+//go:generate go run gen.go -o table.go
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/britannic/blacklist/internal/fqdn"
+)
+
+// kind flags Public Suffix List rule types, a name can carry more than one
+type kind uint8
+
+const (
+	normal    kind = 1 << iota // e.g. co.uk
+	wildcard                   // e.g. *.ck
+	exception                  // e.g. !www.ck
+)
+
+// List is a parsed Public Suffix List
+type List struct {
+	rules map[string]kind
+}
+
+var (
+	dflt *List
+	once sync.Once
+)
+
+// Default returns the embedded Public Suffix List
+func Default() *List {
+	once.Do(func() {
+		dflt, _ = Parse(strings.NewReader(table))
+	})
+	return dflt
+}
+
+// Load reads a Public Suffix List file, e.g. a freshly downloaded public_suffix_list.dat
+func Load(f string) (*List, error) {
+	// nolint
+	r, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return Parse(r)
+}
+
+// Parse reads Public Suffix List rules from r, ignoring comments and blank lines
+func Parse(r io.Reader) (*List, error) {
+	var (
+		b = bufio.NewScanner(r)
+		l = &List{rules: make(map[string]kind)}
+	)
+
+	for b.Scan() {
+		line := strings.TrimSpace(b.Text())
+		if i := strings.IndexAny(line, " \t"); i > 0 {
+			line = line[:i]
+		}
+		switch {
+		case line == "", strings.HasPrefix(line, "//"):
+			continue
+		case strings.HasPrefix(line, "!"):
+			l.rules[key(line[1:])] |= exception
+		case strings.HasPrefix(line, "*."):
+			l.rules[key(line[2:])] |= wildcard
+		default:
+			l.rules[key(line)] |= normal
+		}
+	}
+	return l, b.Err()
+}
+
+// key returns a rule's lower case punycode form, since blacklist entries are normalized to punycode
+func key(rule string) string {
+	b, err := fqdn.ToASCII([]byte(rule))
+	if err != nil {
+		return strings.ToLower(rule)
+	}
+	return strings.ToLower(string(b))
+}
+
+// Len returns the number of rules in the list
+func (l *List) Len() int {
+	return len(l.rules)
+}
+
+// PublicSuffix returns the public suffix of domain d
+func (l *List) PublicSuffix(d string) string {
+	d = strings.TrimSuffix(strings.ToLower(d), ".")
+	labels := strings.Split(d, ".")
+	// The implicit "*" rule makes the TLD a public suffix when no other rule matches
+	suffix := labels[len(labels)-1]
+
+	for i := len(labels) - 1; i >= 0; i-- {
+		name := strings.Join(labels[i:], ".")
+		r := l.rules[name]
+		if r&exception != 0 {
+			return strings.Join(labels[i+1:], ".")
+		}
+		if r&normal != 0 {
+			suffix = name
+		}
+		if r&wildcard != 0 && i > 0 {
+			if l.rules[strings.Join(labels[i-1:], ".")]&exception != 0 {
+				return name
+			}
+			suffix = strings.Join(labels[i-1:], ".")
+		}
+	}
+	return suffix
+}
+
+// IsPublicSuffix returns true if d is itself a public suffix, e.g. co.uk or github.io
+func (l *List) IsPublicSuffix(d string) bool {
+	d = strings.TrimSuffix(strings.ToLower(d), ".")
+	return d != "" && l.PublicSuffix(d) == d
+}
+
+// Registrable returns the registrable domain (eTLD+1) of d, or "" if d is a public suffix
+func (l *List) Registrable(d string) string {
+	d = strings.TrimSuffix(strings.ToLower(d), ".")
+	suffix := l.PublicSuffix(d)
+	if d == suffix || !strings.HasSuffix(d, "."+suffix) {
+		return ""
+	}
+	head := strings.TrimSuffix(d, "."+suffix)
+	if i := strings.LastIndex(head, "."); i >= 0 {
+		head = head[i+1:]
+	}
+	return head + "." + suffix
+}
+
+// IsPublicSuffix returns true if d is a public suffix in the embedded list
+func IsPublicSuffix(d string) bool {
+	return Default().IsPublicSuffix(d)
+}
+
+// Registrable returns the registrable domain of d using the embedded list
+func Registrable(d string) string {
+	return Default().Registrable(d)
+}
@@ -0,0 +1,100 @@
+package psl
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const rules = `// test rules
+com
+uk
+co.uk
+github.io
+*.ck
+!www.ck
+jp
+kawasaki.jp
+*.kawasaki.jp
+!city.kawasaki.jp
+`
+
+func TestParse(t *testing.T) {
+	Convey("Testing Parse()", t, func() {
+		l, err := Parse(strings.NewReader(rules))
+		So(err, ShouldBeNil)
+		So(l.Len(), ShouldEqual, 9)
+		So(l.rules["kawasaki.jp"], ShouldEqual, normal|wildcard)
+		So(l.rules["www.ck"], ShouldEqual, exception)
+	})
+}
+
+func TestPublicSuffix(t *testing.T) {
+	Convey("Testing PublicSuffix(), IsPublicSuffix() and Registrable()", t, func() {
+		l, err := Parse(strings.NewReader(rules))
+		So(err, ShouldBeNil)
+
+		tests := []struct {
+			domain string
+			reg    string
+			suffix string
+		}{
+			{domain: "com", suffix: "com", reg: ""},
+			{domain: "example.com", suffix: "com", reg: "example.com"},
+			{domain: "a.b.example.com", suffix: "com", reg: "example.com"},
+			{domain: "co.uk", suffix: "co.uk", reg: ""},
+			{domain: "bbc.co.uk", suffix: "co.uk", reg: "bbc.co.uk"},
+			{domain: "news.bbc.co.uk.", suffix: "co.uk", reg: "bbc.co.uk"},
+			{domain: "github.io", suffix: "github.io", reg: ""},
+			{domain: "britannic.github.io", suffix: "github.io", reg: "britannic.github.io"},
+			{domain: "foo.ck", suffix: "foo.ck", reg: ""},
+			{domain: "bar.foo.ck", suffix: "foo.ck", reg: "bar.foo.ck"},
+			{domain: "www.ck", suffix: "ck", reg: "www.ck"},
+			{domain: "kawasaki.jp", suffix: "kawasaki.jp", reg: ""},
+			{domain: "x.kawasaki.jp", suffix: "x.kawasaki.jp", reg: ""},
+			{domain: "city.kawasaki.jp", suffix: "kawasaki.jp", reg: "city.kawasaki.jp"},
+			{domain: "example.unlisted", suffix: "unlisted", reg: "example.unlisted"},
+		}
+
+		for _, tt := range tests {
+			So(l.PublicSuffix(tt.domain), ShouldEqual, tt.suffix)
+			So(l.Registrable(tt.domain), ShouldEqual, tt.reg)
+			So(l.IsPublicSuffix(tt.domain), ShouldEqual, tt.reg == "")
+		}
+	})
+}
+
+func TestDefault(t *testing.T) {
+	Convey("Testing Default()", t, func() {
+		So(Default().Len(), ShouldBeGreaterThan, 5000)
+		So(IsPublicSuffix("co.uk"), ShouldBeTrue)
+		So(IsPublicSuffix("github.io"), ShouldBeTrue)
+		So(IsPublicSuffix("google.com"), ShouldBeFalse)
+		So(Registrable("ads.doubleclick.net"), ShouldEqual, "doubleclick.net")
+		So(Registrable("trk.express.co.uk"), ShouldEqual, "express.co.uk")
+		So(IsPublicSuffix("xn--p1ai"), ShouldBeTrue)
+		So(Registrable("ads.xn--80ak6aa92e.xn--p1ai"), ShouldEqual, "xn--80ak6aa92e.xn--p1ai")
+	})
+}
+
+func TestLoad(t *testing.T) {
+	Convey("Testing Load()", t, func() {
+		f, err := ioutil.TempFile("/tmp", "psl")
+		So(err, ShouldBeNil)
+		defer os.Remove(f.Name())
+
+		_, err = f.WriteString(rules)
+		So(err, ShouldBeNil)
+		So(f.Close(), ShouldBeNil)
+
+		l, err := Load(f.Name())
+		So(err, ShouldBeNil)
+		So(l.IsPublicSuffix("co.uk"), ShouldBeTrue)
+
+		_, err = Load("/:~/public_suffix_list.dat")
+		So(err, ShouldNotBeNil)
+	})
+}
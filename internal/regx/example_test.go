@@ -19,6 +19,7 @@ FLIP: ^(?:address=[/][.]{0,1}.*[/])(.*)$
 FQDN: \b((?:(?:[^.-/]{0,1})[\p{L}\d-_]{1,63}[-]{0,1}[.]{1})+(?:[\p{L}]{2,63}))\b
 HOST: ^(?:address=[/][.]{0,1})(.*)(?:[/].*)$
 HTTP: (?:^(?:http|https){1}:)(?:\/|%2f){1,2}(.*)
+IPB6: ^(?:dns-redirect-ipv6)+\s([\S]+)$
 IPBH: ^(?:dns-redirect-ip)+\s([\S]+)$
 LBRC: [{]
 LEAF: ^([\S]+)+\s([\S]+)\s[{]{1}$
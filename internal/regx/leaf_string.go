@@ -15,21 +15,22 @@ func _() {
 	_ = x[FQDN-1004]
 	_ = x[HOST-1005]
 	_ = x[HTTP-1006]
-	_ = x[IPBH-1007]
-	_ = x[LEAF-1008]
-	_ = x[LBRC-1009]
-	_ = x[MISC-1010]
-	_ = x[MLTI-1011]
-	_ = x[MPTY-1012]
-	_ = x[NAME-1013]
-	_ = x[NODE-1014]
-	_ = x[RBRC-1015]
-	_ = x[SUFX-1016]
+	_ = x[IPB6-1007]
+	_ = x[IPBH-1008]
+	_ = x[LEAF-1009]
+	_ = x[LBRC-1010]
+	_ = x[MISC-1011]
+	_ = x[MLTI-1012]
+	_ = x[MPTY-1013]
+	_ = x[NAME-1014]
+	_ = x[NODE-1015]
+	_ = x[RBRC-1016]
+	_ = x[SUFX-1017]
 }
 
-const _Leaf_name = "CMNTDESCDSBLFLIPFQDNHOSTHTTPIPBHLEAFLBRCMISCMLTIMPTYNAMENODERBRCSUFX"
+const _Leaf_name = "CMNTDESCDSBLFLIPFQDNHOSTHTTPIPB6IPBHLEAFLBRCMISCMLTIMPTYNAMENODERBRCSUFX"
 
-var _Leaf_index = [...]uint8{0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 60, 64, 68}
+var _Leaf_index = [...]uint8{0, 4, 8, 12, 16, 20, 24, 28, 32, 36, 40, 44, 48, 52, 56, 60, 64, 68, 72}
 
 func (i Leaf) String() string {
 	i -= 1000
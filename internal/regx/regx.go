@@ -22,6 +22,7 @@ const (
 	FQDN
 	HOST
 	HTTP
+	IPB6
 	IPBH
 	LEAF
 	LBRC
@@ -54,6 +55,7 @@ func NewRegex() *OBJ {
 			FQDN: rx.MustCompile(`\b((?:(?:[^.-/]{0,1})[\p{L}\d-_]{1,63}[-]{0,1}[.]{1})+(?:[\p{L}]{2,63}))\b`),
 			HOST: rx.MustCompile(`^(?:address=[/][.]{0,1})(.*)(?:[/].*)$`),
 			HTTP: rx.MustCompile(`(?:^(?:http|https){1}:)(?:\/|%2f){1,2}(.*)`),
+			IPB6: rx.MustCompile(`^(?:dns-redirect-ipv6)+\s([\S]+)$`),
 			IPBH: rx.MustCompile(`^(?:dns-redirect-ip)+\s([\S]+)$`),
 			LBRC: rx.MustCompile(`[{]`),
 			LEAF: rx.MustCompile(`^([\S]+)+\s([\S]+)\s[{]{1}$`),
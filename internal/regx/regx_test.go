@@ -115,6 +115,11 @@ var (
 			input:  []byte(`https:/123pagerank.com/*=UUID:272`),
 			result: []byte(`123pagerank.com/*=UUID:272`),
 		},
+		regx.IPB6: test{
+			index:  1,
+			input:  []byte(`dns-redirect-ipv6 ::`),
+			result: []byte(`::`),
+		},
 		regx.IPBH: test{
 			index:  1,
 			input:  []byte(`dns-redirect-ip 0.0.0.0`),
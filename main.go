@@ -2,11 +2,26 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
 
 	e "github.com/britannic/blacklist/internal/edgeos"
 )
 
+const (
+	// mqttRetry is how long the daemon waits to reconnect to the mqtt-broker
+	mqttRetry = time.Minute
+	// topHits is the number of blocked domains and clients -querylog shows
+	topHits = 10
+)
+
 var (
 	// updated by go build -ldflags
 	architecture = "UNKNOWN"
@@ -16,14 +31,15 @@ var (
 	version      = "UNKNOWN"
 	// ----------------------------
 
+	daemonized   bool
 	exitCmd      = os.Exit
 	initEnvirons = initEnv
 	prog         = basename(os.Args[0])
 	prefix       = fmt.Sprintf("%s: ", prog)
-)
+	reportTo     string
 
-func main() {
-	objex := []e.IFace{
+	// objex lists the sources in processing order
+	objex = []e.IFace{
 		e.PreRObj,
 		e.PreDObj,
 		e.PreHObj,
@@ -34,7 +50,9 @@ func main() {
 		e.URLdObj,
 		e.URLhObj,
 	}
+)
 
+func main() {
 	c, err := initEnvirons()
 	if err != nil {
 		logErrorf("%s shutting down.", err.Error())
@@ -43,26 +61,108 @@ func main() {
 
 	c.Debug(fmt.Sprintf("Dumping commandline args: %v", os.Args[1:]))
 	c.Debug(fmt.Sprintf("Dumping env variables: %v", c))
+	refresh(c)
+}
+
+// refresh removes stale blacklists, runs the blacklist pipeline unless blocking is disabled or paused,
+// reloads the DNS service and records the run
+func refresh(c *e.Config) {
 	logNoticef("%v", "Starting blacklist update...")
 
+	if until, paused := c.Paused(); paused {
+		logNoticef("Blocking is paused until %s", until.Format(time.RFC3339))
+		c.SetOpt(e.Disabled(true))
+	}
+
 	logInfo("Removing stale blacklists...")
-	if err = removeStaleFiles(c); err != nil {
+	if err := removeStaleFiles(c); err != nil {
 		logFatalf("%v", err.Error())
 	}
 
 	// _, _ = context.WithTimeout(context.Background(), c.Timeout)
 
+	ok := true
 	if !c.Disabled {
-		if err := processObjects(c, objex); err != nil {
-			logErrorf("%v", err.Error())
-		}
+		ok = runUpdate(c)
 	}
 
 	c.GetTotalStats()
-	reloadDNS(c)
+	if c.Verb {
+		_ = c.WriteStats(os.Stdout)
+	}
+	if !reloadDNS(c) {
+		return
+	}
+	if err := c.HealthCheck(); err != nil {
+		logErrorf("%v", err.Error())
+	}
+	recordRun(c, ok)
 	logNoticef("%v", "Blacklist update completed......")
 }
 
+// runUpdate runs the blacklist pipeline and loads the firewall sets, returning false if any step failed
+func runUpdate(c *e.Config) bool {
+	ok := true
+	for _, step := range []func() error{
+		func() error { return processObjects(c, objex) },
+		c.Promote,
+		c.RPZ,
+		c.BlockIndex,
+		c.Finish,
+		c.Policies,
+		c.Forwarding,
+	} {
+		if err := step(); err != nil {
+			logErrorf("%v", err.Error())
+			ok = false
+		}
+	}
+	return loadSets(c) && ok
+}
+
+// recordRun records the run's outcome, then writes the Prometheus metrics-file, if one is configured,
+// and the JSON run report, unless -report is ""
+func recordRun(c *e.Config, ok bool) {
+	if err := c.RunDone(ok); err != nil {
+		logErrorf("%v", err.Error())
+	}
+	if reportTo == "" {
+		return
+	}
+	if err := writeReport(c.Report(version, githash), reportTo); err != nil {
+		logErrorf("cannot write run report: %v", err.Error())
+	}
+}
+
+// writeReport writes r to stdout if file is "-", otherwise it replaces file, creating its directory if need be
+func writeReport(r *e.Report, file string) error {
+	if file == "-" {
+		return r.Encode(os.Stdout)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	if err = r.Encode(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
 // basename removes directory components and file extensions.
 func basename(s string) string {
 	// Discard last '/' and everything before.
@@ -91,8 +191,23 @@ func files(c *e.Config) *e.CFile {
 func initEnv() (c *e.Config, err error) {
 	o := getOpts()
 	o.setArgs()
+	if *o.BlkPage != "" {
+		serveBlockPage(*o.BlkPage)
+		exitCmd(0)
+	}
 	c = o.initEdgeOS()
-	if err = c.Blacklist(o.getCFG(c)); err != nil {
+	reportTo = *o.Report
+	err = c.Blacklist(o.getCFG(c))
+	if o.analyzing() {
+		if err != nil {
+			logFatalf("%v", err.Error())
+			return c, err
+		}
+		analyze(c, o)
+		exitCmd(0)
+		return c, err
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Removing stale dnsmasq blacklist files, because %v\n", err.Error())
 		if err = files(c).Remove(); err != nil {
 			fmt.Fprintf(os.Stderr, "%v", err.Error())
@@ -100,9 +215,324 @@ func initEnv() (c *e.Config, err error) {
 		reloadDNS(c)
 		exitCmd(0)
 	}
+	if *o.MQTT {
+		serveMQTT(c, o)
+		exitCmd(0)
+	}
+	if *o.Daemon {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+		daemon(o, sig)
+		exitCmd(0)
+	}
 	return c, err
 }
 
+// analyze runs the -export, -history, -simulate or -querylog mode, none of which touch the DNS
+// configuration or reload the DNS service
+func analyze(c *e.Config, o *opts) {
+	switch {
+	case *o.Export != "":
+		exportLists(c, *o.Export, *o.ExpDir)
+	case *o.History > 0:
+		showHistory(c, *o.History)
+	case *o.Sim != "":
+		simulate(c, o.initEdgeOS(), *o.Sim, *o.QryLog)
+	case *o.QryLog != "":
+		showQueryLog(c, *o.QryLog, *o.Since)
+	}
+}
+
+// exportLists runs the blacklist pipeline in a scratch directory and exports the merged
+// lists to dir, leaving the dnsmasq configuration untouched
+func exportLists(c *e.Config, format, dir string) {
+	if err := c.Exporter(format); err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+
+	tmp, err := ioutil.TempDir("", prog)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmp)
+
+	c.SetOpt(e.Dir(tmp))
+	if err = processObjects(c, objex); err != nil {
+		logErrorf("%v", err.Error())
+	}
+	if err = c.Promote(); err != nil {
+		logErrorf("%v", err.Error())
+	}
+
+	names, err := c.Export(format, dir, version)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	for _, n := range names {
+		logNoticef("Exported %s", n)
+	}
+}
+
+// showHistory displays per-source trends over the last n runs
+func showHistory(c *e.Config, n int) {
+	if err := c.History(os.Stdout, n); err != nil {
+		logFatalf("%v", err.Error())
+	}
+}
+
+// showQueryLog displays the blocked queries in a dnsmasq query log, and which sources blocked them,
+// over the last since, or the whole log if since is 0
+func showQueryLog(c *e.Config, file string, since time.Duration) {
+	r, err := e.OpenQueryLog(file)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	defer r.Close()
+
+	var from time.Time
+	if since > 0 {
+		from = time.Now().Add(-since)
+	}
+	q, err := c.QueryLog(r, from)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	if err = q.Write(os.Stdout, topHits); err != nil {
+		logErrorf("%v", err.Error())
+	}
+}
+
+// simulate replays the queries in a dnsmasq query log, or a list of names, against the current
+// configuration and the candidate configuration in file, then displays the answers that would change
+func simulate(c, candidate *e.Config, file, queries string) {
+	if queries == "" {
+		logFatalf("-simulate needs a -querylog to replay")
+		return
+	}
+
+	r, err := e.GetFile(file)
+	if err != nil {
+		logFatalf("cannot open configuration file %s!", file)
+		return
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		logFatalf("cannot read configuration file %s!", file)
+		return
+	}
+	if err = candidate.Blacklist(&e.CFGstatic{Config: candidate, Cfg: string(b)}); err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+
+	q, err := e.OpenQueryLog(queries)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	defer q.Close()
+
+	x, err := c.Simulate(candidate, q)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	if err = x.Write(os.Stdout); err != nil {
+		logErrorf("%v", err.Error())
+	}
+}
+
+// lastRun serves the metrics of the daemon's last completed run
+type lastRun struct {
+	sync.Mutex
+	c *e.Config
+}
+
+func (l *lastRun) set(c *e.Config) {
+	l.Lock()
+	l.c = c
+	l.Unlock()
+}
+
+func (l *lastRun) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.Lock()
+	c := l.c
+	l.Unlock()
+	if c == nil {
+		http.Error(w, "no blacklist update has completed yet", http.StatusServiceUnavailable)
+		return
+	}
+	c.Metrics().ServeHTTP(w, r)
+}
+
+// serveMetrics serves the daemon's last completed run's metrics at /metrics on addr
+func serveMetrics(addr string, l *lastRun) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot serve metrics: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", l)
+	logNoticef("Serving metrics at http://%s/metrics", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			logErrorf("metrics server: %v", err.Error())
+		}
+	}()
+	return nil
+}
+
+// daemon runs an update straight away, then on the blacklist's update-schedule or update-interval, until
+// it's sent SIGINT or SIGTERM, finishing any update in progress first; URL sources with a refresh-interval
+// reuse their downloads until it has passed, and the configuration is only re-read when it's sent SIGHUP.
+// Each source's failed run count carries across runs, and with -metrics-listen the last completed run's
+// metrics are served over HTTP. With an mqtt-broker, its commands run through the same updates, and an
+// update runs as soon as a pause ends
+func daemon(o *opts, sig <-chan os.Signal) {
+	daemonized = true
+	defer func() { daemonized = false }()
+
+	var (
+		cache   = e.NewFetchCache()
+		cfg     *e.CFGstatic
+		err     error
+		last    = &lastRun{}
+		mu      sync.Mutex
+		next    = time.Now()
+		state   = e.NewSourceState()
+		updates = make(chan struct{}, 1)
+	)
+	if cfg, err = e.Snapshot(o.getCFG(o.initEdgeOS())); err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	if *o.Metrics != "" {
+		if err = serveMetrics(*o.Metrics, last); err != nil {
+			logFatalf("%v", err.Error())
+			return
+		}
+	}
+
+	// load returns a configuration read from the current snapshot, or nil if it can't be read
+	load := func() *e.Config {
+		mu.Lock()
+		x := cfg
+		mu.Unlock()
+		c := o.initEdgeOS()
+		c.SetOpt(e.Cache(cache), e.State(state))
+		if err := c.Blacklist(x); err != nil {
+			logErrorf("%v", err.Error())
+			return nil
+		}
+		return c
+	}
+	// schedule sets when the next update runs
+	schedule := func(c *e.Config) {
+		next = c.NextRun(time.Now())
+		logNoticef("Next blacklist update at %s", next.Format(time.RFC3339))
+	}
+
+	// run runs an update, then schedules the next one
+	run := func() {
+		c := load()
+		if c == nil {
+			c = o.initEdgeOS()
+		} else {
+			refresh(c)
+			last.set(c)
+		}
+		schedule(c)
+	}
+
+	go daemonMQTT(load, updates)
+	logNoticef("Running as a daemon")
+
+	for {
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-updates:
+			t.Stop()
+			run()
+		case <-t.C:
+			run()
+		case s := <-sig:
+			t.Stop()
+			if s != syscall.SIGHUP {
+				logNoticef("Received %v, shutting down", s)
+				return
+			}
+
+			logNoticef("Received %v, re-reading the configuration", s)
+			x, err := e.Snapshot(o.getCFG(o.initEdgeOS()))
+			if err != nil {
+				logErrorf("%v, keeping the current configuration", err.Error())
+				continue
+			}
+			mu.Lock()
+			cfg = x
+			mu.Unlock()
+			if c := load(); c != nil {
+				schedule(c)
+			}
+		}
+	}
+}
+
+// daemonMQTT serves the mqtt-broker's commands for the daemon, asking it to run each update through updates,
+// and reconnects mqttRetry after the broker connection fails; it returns if no mqtt-broker is configured
+func daemonMQTT(load func() *e.Config, updates chan<- struct{}) {
+	for {
+		c := load()
+		if c == nil || !c.MQTTEnabled() {
+			return
+		}
+		logNoticef("Serving MQTT commands")
+		err := c.ServeMQTT(func() {
+			select {
+			case updates <- struct{}{}:
+			default: // an update is already waiting
+			}
+		})
+		logErrorf("%v, reconnecting to the mqtt-broker in %v", err.Error(), mqttRetry)
+		time.Sleep(mqttRetry)
+	}
+}
+
+// serveMQTT applies the MQTT commands to update, pause and resume blocking until the broker connection
+// fails, running each update with a freshly loaded configuration
+func serveMQTT(c *e.Config, o *opts) {
+	logNoticef("Serving MQTT commands")
+	err := c.ServeMQTT(func() {
+		x := o.initEdgeOS()
+		if err := x.Blacklist(o.getCFG(x)); err != nil {
+			logErrorf("%v", err.Error())
+			return
+		}
+		refresh(x)
+	})
+	if err != nil {
+		logFatalf("%v", err.Error())
+	}
+}
+
+// serveBlockPage runs the block page server until it fails
+func serveBlockPage(file string) {
+	b, err := e.NewBlockPage(file)
+	if err != nil {
+		logFatalf("%v", err.Error())
+		return
+	}
+	logNoticef("Serving block pages from %s", file)
+	if err = b.ListenAndServe(); err != nil {
+		logFatalf("%v", err.Error())
+	}
+}
+
 // processObjects processes local sources, downloads Internet sources and creates
 // dnsmasq configuration files
 func processObjects(c *e.Config, objects []e.IFace) error {
@@ -118,13 +548,32 @@ func processObjects(c *e.Config, objects []e.IFace) error {
 	return nil
 }
 
-// reloadDNS reloads the latest processed dnsmasq configuration files
-func reloadDNS(c *e.Config) {
+// loadSets writes the addresses node's IP lists and loads them and the policy node's sets into the firewall
+func loadSets(c *e.Config) bool {
+	if err := c.Addresses(); err != nil {
+		logErrorf("%v", err.Error())
+		return false
+	}
+	if b, err := c.LoadSets(); err != nil {
+		logErrorf("LoadSets(): %v\n error: %v\n", string(b), err.Error())
+		return false
+	}
+	return true
+}
+
+// reloadDNS reloads the latest processed dnsmasq configuration files; if it can't, it records the failed
+// run and exits, or, if it's the daemon, returns false
+func reloadDNS(c *e.Config) bool {
 	if b, err := c.ReloadDNS(); err != nil {
 		logErrorf("ReloadDNS(): %v\n error: %v\n", string(b), err.Error())
+		recordRun(c, false)
+		if daemonized {
+			return false
+		}
 		exitCmd(1)
 	}
 	logPrintf("%s", "Successfully restarted dnsmasq")
+	return true
 }
 
 // removeStaleFiles deletes redundant files
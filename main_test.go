@@ -6,10 +6,13 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path"
 	"path/filepath"
 	"testing"
+	"time"
 
 	e "github.com/britannic/blacklist/internal/edgeos"
 	"github.com/britannic/mflag"
@@ -206,6 +209,53 @@ func TestInitEnv(t *testing.T) {
 	})
 }
 
+func TestInitEnvAnalyzing(t *testing.T) {
+	Convey("Testing initEnv() leaves the DNS configuration alone in analysis modes", t, func() {
+		dir, err := ioutil.TempDir("", "testAnalyze")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		stale := dir + "/domains.old.blacklist.conf"
+		So(ioutil.WriteFile(stale, []byte("address=/old.com/0.0.0.0\n"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(dir+"/config.boot", []byte("interfaces {\n}\n"), 0644), ShouldBeNil)
+
+		var act string
+		defer func(a []string, f func(string, ...interface{}), x func(int)) {
+			os.Args, logFatalf, exitCmd = a, f, x
+		}(os.Args, logFatalf, exitCmd)
+		exitCmd = func(int) {}
+		logFatalf = func(f string, args ...interface{}) { act = fmt.Sprintf(f, args...) }
+
+		for _, mode := range [][]string{{"-querylog", "-"}, {"-simulate", dir + "/config.boot", "-querylog", "-"}} {
+			act = ""
+			os.Args = append([]string{prog, "-tmp", dir, "-f", dir + "/config.boot"}, mode...)
+			_, err = initEnv()
+			So(err, ShouldNotBeNil)
+			So(act, ShouldEqual, "no blacklist configuration has been detected")
+			_, err = os.Stat(stale)
+			So(err, ShouldBeNil)
+		}
+	})
+}
+
+func TestDaemonMQTT(t *testing.T) {
+	Convey("Testing daemonMQTT() returns if no mqtt-broker is configured", t, func() {
+		done := make(chan struct{})
+		go func() {
+			daemonMQTT(func() *e.Config { return e.NewConfig() }, make(chan struct{}, 1))
+			close(done)
+		}()
+
+		var returned bool
+		select {
+		case <-done:
+			returned = true
+		case <-time.After(time.Second):
+		}
+		So(returned, ShouldBeTrue)
+	})
+}
+
 func TestProcessObjects(t *testing.T) {
 	c, _ := initEnv()
 	badFileError := `open EinenSieAugenBlick/domains.tasty.blacklist.conf: no such file or directory`
@@ -417,6 +467,39 @@ func TestReloadDNS(t *testing.T) {
 	})
 }
 
+func TestWriteReport(t *testing.T) {
+	Convey("Testing writeReport()", t, func() {
+		dir, err := ioutil.TempDir("", "testReport")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		c := e.NewConfig(e.Collect(true), e.Dir(dir), e.Ext("blacklist.conf"), e.FileNameFmt("%v/%v.%v.%v"))
+		So(c.RunDone(true), ShouldBeNil)
+
+		file := dir + "/run/last-run.json"
+		So(writeReport(c.Report("1.0", "abc"), file), ShouldBeNil)
+
+		b, err := ioutil.ReadFile(file)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `"version": "1.0"`)
+		So(string(b), ShouldContainSubstring, `"success": true`)
+
+		files, err := filepath.Glob(dir + "/run/.*")
+		So(err, ShouldBeNil)
+		So(files, ShouldBeEmpty)
+
+		Convey("Testing recordRun() writes the report after every update", func() {
+			So(*getOpts().Report, ShouldEqual, defReport)
+
+			defer func(s string) { reportTo = s }(reportTo)
+			reportTo = dir + "/last-run.json"
+			recordRun(c, true)
+			_, err := os.Stat(reportTo)
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
 func TestRemoveStaleFiles(t *testing.T) {
 	Convey("Testing removeStaleFiles()", t, func() {
 		c, _ := initEnv()
@@ -508,8 +591,10 @@ func TestInitEdgeOS(t *testing.T) {
 	"File name fmt": "%v/%v.%v.%v",
 	"CLI Path": "service dns forwarding",
 	"HTTP method": "GET",
+	"pdns service": "/usr/bin/rec_control reload-lua-script",
 	"Prefix": {},
 	"Timeout": 30000000000,
+	"unbound service": "/usr/sbin/unbound-control reload",
 	"Wildcard": {
 		"Node": "*s",
 		"Name": "*"
@@ -775,3 +860,21 @@ var (
 "ytimg.com":{},
 `
 )
+
+func TestServeMetrics(t *testing.T) {
+	Convey("Testing serveMetrics()", t, func() {
+		l := &lastRun{}
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		So(w.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+		l.set(e.NewConfig(e.Collect(true)))
+		w = httptest.NewRecorder()
+		l.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		So(w.Code, ShouldEqual, http.StatusOK)
+		So(w.Body.String(), ShouldContainSubstring, "blacklist_last_run_success 0\n")
+
+		So(serveMetrics("127.0.0.1:0", l), ShouldBeNil)
+		So(serveMetrics("256.0.0.1:0", l).Error(), ShouldStartWith, "cannot serve metrics: ")
+	})
+}
@@ -14,18 +14,33 @@ import (
 	"github.com/britannic/mflag"
 )
 
+// defReport is where each update's JSON run report is written, unless -report overrides it
+const defReport = "/var/run/blacklist/last-run.json"
+
 // opts struct for command line options and setting initial variables
 type opts struct {
 	*mflag.FlagSet
 	ARCH    *string
+	BlkPage *string
+	Daemon  *bool
 	Dbug    *bool
 	DNSdir  *string
 	DNStmp  *string
+	Export  *string
+	ExpDir  *string
 	File    *string
+	Force   *bool
 	Help    *bool
+	History *int
 	MIPSLE  *string
 	MIPS64  *string
+	Metrics *string
+	MQTT    *bool
 	OS      *string
+	QryLog  *string
+	Report  *string
+	Since   *time.Duration
+	Sim     *string
 	Test    *bool
 	Verb    *bool
 	Version *bool
@@ -44,6 +59,11 @@ func cleanArgs(args []string) (r []string) {
 	return r
 }
 
+// analyzing returns true if a mode that only reads the configuration and its lists was asked for
+func (o *opts) analyzing() bool {
+	return *o.Export != "" || *o.History > 0 || *o.Sim != "" || *o.QryLog != ""
+}
+
 // getCFG returns a e.ConfLoader
 func (o *opts) getCFG(c *e.Config) e.ConfLoader {
 	if *o.File != "" {
@@ -78,14 +98,26 @@ func getOpts() *opts {
 		o     = &opts{
 			FlagSet: &flags,
 			ARCH:    flags.String("arch", runtime.GOARCH, "Set EdgeOS CPU architecture", false),
+			BlkPage: flags.String("block-page", "", "`<file>` # Serve block pages using a block-page-index file", true),
+			Daemon:  flags.Bool("daemon", false, "Keep running, updating on the update-schedule or update-interval and on mqtt-broker commands; SIGHUP re-reads the configuration", true),
 			DNSdir:  flags.String("dir", "/etc/dnsmasq.d", "Override dnsmasq directory", true),
 			DNStmp:  flags.String("tmp", "/tmp", "Override dnsmasq temporary directory", false),
 			Dbug:    flags.Bool("debug", false, "Enable Debug mode", false),
+			Export:  flags.String("export", "", "`<format>` # Export the blacklist for adguard, dnscrypt or pihole", true),
+			ExpDir:  flags.String("export-dir", ".", "Export target directory", true),
 			File:    flags.String("f", "", "`<file>` # Load a config.boot file", true),
+			Force:   flags.Bool("force", false, "Publish sources even if they trip a min-entries or max-change guard", true),
 			Help:    flags.Bool("h", false, "Display help", true),
+			History: flags.Int("history", 0, "`<runs>` # Show per-source trends over the last runs in the history-file", true),
 			MIPS64:  flags.String("mips64", "mips64", "Override target EdgeOS CPU architecture", false),
 			MIPSLE:  flags.String("mipsle", "mipsle", "Override target EdgeOS CPU architecture", false),
+			Metrics: flags.String("metrics-listen", "", "`<address>` # With -daemon, serve Prometheus metrics on address, e.g. :9153", true),
+			MQTT:    flags.Bool("mqtt", false, "Serve the mqtt-broker's update-now, pause <minutes> and resume commands", true),
 			OS:      flags.String("os", runtime.GOOS, "Override native EdgeOS OS", false),
+			QryLog:  flags.String("querylog", "", "`<file>` # Show blocked-query statistics from a dnsmasq query log and its rotations, or - for stdin", true),
+			Report:  flags.String("report", defReport, "`<file>` # Write each update's JSON run report to file, - for stdout, or \"\" for none", true),
+			Sim:     flags.String("simulate", "", "`<file>` # Replay the -querylog queries against a candidate config.boot file and show what it would newly block or unblock", true),
+			Since:   flags.Duration("since", 0, "`<duration>` # Only analyze -querylog lines logged within duration, e.g. 168h", true),
 			Test:    flags.Bool("dryrun", false, "Run config and data validation tests", false),
 			Verb:    flags.Bool("v", false, "Verbose display", true),
 			Version: flags.Bool("version", false, "Show version", true),
@@ -106,6 +138,7 @@ func (o *opts) initEdgeOS() *e.Config {
 		e.API("/bin/cli-shell-api"),
 		e.Arch(runtime.GOARCH),
 		e.Bash("/bin/bash"),
+		e.Collect(*o.Report != "" || *o.Metrics != ""),
 		e.Cores(2),
 		e.Disabled(false),
 		e.Dbug(*o.Dbug),
@@ -114,12 +147,15 @@ func (o *opts) initEdgeOS() *e.Config {
 		e.Ext("blacklist.conf"),
 		e.File(*o.File),
 		e.FileNameFmt("%v/%v.%v.%v"),
+		e.Force(*o.Force),
 		e.InCLI("inSession"),
 		e.Level("service dns forwarding"),
 		e.Method("GET"),
+		e.PdnsSvc("/usr/bin/rec_control reload-lua-script"),
 		e.Prefix("address=", "server="),
 		e.Logger(log),
 		e.Timeout(30*time.Second),
+		e.UnboundSvc("/usr/sbin/unbound-control reload"),
 		e.Verb(*o.Verb),
 		e.WCard(e.Wildcard{Node: "*s", Name: "*"}),
 	)